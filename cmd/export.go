@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/exchange"
+	"github.com/Ozoniuss/olx-tracker/internal/export"
+	"github.com/Ozoniuss/olx-tracker/internal/preferences"
+)
+
+// flagSet tells whether a flag was given on the command line, to tell an
+// explicit empty value from the default.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func exportCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	username := fs.String("username", "", "user whose products are exported")
+	formatFlag := fs.String("format", "csv", "output format: csv, json or ndjson")
+	includeRawJSON := fs.Bool("raw-json", false, "include the raw JSON-LD of every snapshot")
+	output := fs.String("o", "-", "output file, - for stdout")
+	currency := fs.String("currency", "", "also export every price converted to this currency, e.g. EUR (default the preferred currency of the user, \"\" for none)")
+	fs.Parse(args)
+
+	if *username == "" {
+		return errors.New("-username is required")
+	}
+	format, err := export.ParseFormat(*formatFlag)
+	if err != nil {
+		return err
+	}
+	*currency = strings.ToUpper(*currency)
+	if *currency != "" && !exchange.ValidCurrency(*currency) {
+		return fmt.Errorf("invalid currency %q", *currency)
+	}
+
+	_, db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	userID, err := dbpkg.GetUserIDByUsername(ctx, db, *username)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	prefs, err := preferences.Load(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+	opts := export.Options{
+		IncludeRawJSON: *includeRawJSON,
+		Currency:       prefs.Currency,
+		Location:       prefs.Location,
+	}
+	if flagSet(fs, "currency") {
+		opts.Currency = *currency
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := export.WriteForUser(ctx, db, bw, userID, format, opts); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,62 @@
+// Command fakeolx serves fake OLX ad pages for manual testing of the tracker.
+// Track the printed urls, then change the ads through the control API, e.g.
+//
+//	curl -X PATCH localhost:8081/_control/ads/mouse -d '{"price": 399}'
+//	curl -X PATCH localhost:8081/_control/ads/mouse -d '{"status": "gone"}'
+//	curl -X PATCH localhost:8081/_control/ads/desk -d '{"delay": "15s"}'
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Ozoniuss/olx-tracker/internal/fakeolx"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8081", "address to listen on")
+	seed := flag.Bool("seed", true, "start with a few sample ads")
+	flag.Parse()
+
+	server := fakeolx.New()
+	if *seed {
+		for _, ad := range sampleAds {
+			server.Put(ad)
+			log.Printf("serving %s at http://%s%s\n", ad.ID, *addr, fakeolx.AdPath(ad.ID))
+		}
+	}
+
+	httpServer := &http.Server{
+		Addr:              *addr,
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("control api at http://%s/_control/ads\n", *addr)
+	log.Fatal(httpServer.ListenAndServe())
+}
+
+var sampleAds = []fakeolx.Ad{
+	{
+		ID:          "mouse",
+		Name:        "Mouse gaming Logitech Pro X Superlight",
+		Description: "Folosit cateva zile, full box.",
+		Category:    "https://www.olx.ro/electronice-si-electrocasnice/periferice-si-accesorii-laptop-pc-gaming/mouse-si-mousepad/mouse-gaming/",
+		Price:       449,
+	},
+	{
+		ID:          "bike",
+		Name:        "Bicicleta copii 16 inch",
+		Description: "Bicicleta in stare buna, roti ajutatoare incluse.",
+		Category:    "https://www.olx.ro/sport-timp-liber-arta/biciclete-fitness/biciclete/",
+		Price:       250,
+	},
+	{
+		ID:          "desk",
+		Name:        "Birou reglabil electric",
+		Description: "Birou 140x70, reglabil pe inaltime.",
+		Category:    "https://www.olx.ro/casa-gradina/mobila/birouri/",
+		Price:       1199.99,
+	},
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Ozoniuss/olx-tracker/internal/bulkimport"
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+)
+
+func importCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	username := fs.String("username", "", "user that will track the imported ads")
+	formatFlag := fs.String("format", "auto", "input format: auto, lines, csv or bookmarks")
+	chunkSize := fs.Int("chunk", bulkimport.DefaultChunkSize, "number of ads imported per transaction")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: olx-tracker import [flags] [file]")
+		fmt.Fprintln(fs.Output(), "Reads from stdin when no file, or -, is given. CSV files have a url column")
+		fmt.Fprintln(fs.Output(), "and optionally target_price, currency and notes columns.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *username == "" {
+		return errors.New("-username is required")
+	}
+	format, err := bulkimport.ParseFormat(*formatFlag)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	entries, err := bulkimport.Parse(r, format)
+	if err != nil {
+		return err
+	}
+
+	_, db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	userID, err := dbpkg.GetUserIDByUsername(ctx, db, *username)
+	if err != nil {
+		return err
+	}
+
+	results, importErr := bulkimport.Import(ctx, db, userID, entries, *chunkSize)
+
+	counts := make(map[bulkimport.Status]int)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, res := range results {
+		counts[res.Status]++
+		fmt.Fprintf(tw, "line %d\t%s\t%s\t%s\n", res.Line, res.Status, res.URL, res.Reason)
+	}
+	tw.Flush()
+
+	fmt.Printf("\n%d tracked, %d already tracked, %d invalid, %d unsupported, %d tracked by other users\n",
+		counts[bulkimport.StatusTracked],
+		counts[bulkimport.StatusAlreadyTracked],
+		counts[bulkimport.StatusInvalid],
+		counts[bulkimport.StatusUnsupported],
+		counts[bulkimport.StatusTrackedByOther],
+	)
+
+	if importErr != nil {
+		return fmt.Errorf("%w (already imported lines are kept, rerun to resume)", importErr)
+	}
+	return nil
+}
@@ -2,140 +2,286 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"database/sql"
 	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
+	// the image has no zoneinfo, the time zones of the users are embedded
+	_ "time/tzdata"
 
 	"github.com/Ozoniuss/olx-tracker/config"
+	"github.com/Ozoniuss/olx-tracker/internal/blob"
 	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/digest"
+	"github.com/Ozoniuss/olx-tracker/internal/health"
+	"github.com/Ozoniuss/olx-tracker/internal/logging"
+	"github.com/Ozoniuss/olx-tracker/internal/metrics"
 	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+	"github.com/Ozoniuss/olx-tracker/internal/tracing"
+	"github.com/Ozoniuss/olx-tracker/internal/tracker"
+	"github.com/Ozoniuss/olx-tracker/internal/web"
+	"github.com/Ozoniuss/olx-tracker/migrations"
 )
 
+const usage = `usage: olx-tracker <command> [flags]
+
+commands:
+  serve     run the dashboard and poll tracked ads periodically (default)
+  poll      poll all tracked ads once and exit
+  useradd   create a new user
+  export    export the tracked ads and their history of a user
+  import    track many ads at once from a file or stdin
+  market    manage the keywords market stats are computed for
+  search    search the tracked ads of a user and their history
+  rates     import exchange rates and convert prices
+  probe     check the health of a running server, for container health checks
+`
+
 func main() {
+	command := "serve"
+	args := os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
 
-	debug()
-	os.Exit(0)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch command {
+	case "serve":
+		err = serve(ctx, args)
+	case "poll":
+		err = poll(ctx, args)
+	case "useradd":
+		err = useradd(ctx, args)
+	case "export":
+		err = exportCmd(ctx, args)
+	case "import":
+		err = importCmd(ctx, args)
+	case "market":
+		err = marketCmd(ctx, args)
+	case "search":
+		err = searchCmd(ctx, args)
+	case "rates":
+		err = ratesCmd(ctx, args)
+	case "probe":
+		err = probe(ctx, args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		slog.Error(command+" failed", "error", err)
+		os.Exit(1)
+	}
+}
 
+func connect(ctx context.Context) (config.Config, *sql.DB, error) {
 	c, err := config.LoadConfig()
 	if err != nil {
-		log.Fatal(err)
+		return config.Config{}, nil, err
 	}
-	fmt.Println(c)
 
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	logger, err := logging.New(os.Stderr, c.LogLevel)
+	if err != nil {
+		return config.Config{}, nil, err
 	}
-	ctx := context.Background()
+	slog.SetDefault(logger)
+	slog.Debug("config loaded", "config", c)
 
-	db, err := dbpkg.ConnectToPostgres(
-		ctx,
-		dbpkg.GetPostgresURL(c.Postgres),
-	)
+	db, err := dbpkg.ConnectToPostgres(ctx, c.Postgres)
 	if err != nil {
-		log.Fatal(err)
+		return config.Config{}, nil, err
 	}
-	defer db.Close()
 
-	uid, err := dbpkg.GetUserID(ctx, db, "testuser", "testuser")
+	return c, db, nil
+}
+
+// setupTracing installs the configured trace exporter. The returned function
+// flushes the buffered spans and must be called before exiting.
+func setupTracing(ctx context.Context, c config.Config) (func(), error) {
+	exporter, err := tracing.NewExporter(ctx, c.TraceExporter, os.Stderr)
 	if err != nil {
-		if errors.Is(err, dbpkg.ErrNotFound) {
-			uid, err = dbpkg.NewUser(ctx, db, "testuser", "testuser", false)
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else {
-			log.Fatal(err)
+		return nil, err
+	}
+	shutdown := tracing.Setup(exporter)
+
+	return func() {
+		// the main context is usually cancelled by now
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			slog.Error("failed to flush traces", "error", err)
 		}
+	}, nil
+}
+
+// newImageStore opens the store images are archived in, or returns nil if
+// archiving is disabled.
+func newImageStore(c config.Config) (blob.Store, error) {
+	if c.ImageDir == "" {
+		return nil, nil
 	}
-	fmt.Printf("User ID: %s\n", uid)
+	return blob.NewFSStore(c.ImageDir)
+}
 
-	ads := []string{
-		`https://www.olx.ro/d/oferta/mouse-gaming-logitech-pro-x-superlight-IDkbEDA.html`,
-		`https://www.olx.ro/d/oferta/motocicleta-ktm-790-duke-24-IDgV8Gy.html`,
-		`https://www.olx.ro/d/oferta/inchiriere-apartament-2-camere-IDkdRuG.html`,
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
 	}
+}
 
-	// track the adds if they aren't there
-	for _, adurl := range ads {
-		err = dbpkg.TrackAddForUser(ctx, db, uid, adurl)
-		if err != nil {
-			if errors.Is(err, dbpkg.ErrAlreadyExists) {
-				fmt.Println("Product is already being tracked for this user.")
-			}
-		}
+func newMailer(c config.SMTPConfig) digest.SMTP {
+	return digest.SMTP{
+		Host:     c.Host,
+		Port:     c.Port,
+		Username: c.Username,
+		Password: c.Password,
+		From:     c.From,
+	}
+}
 
+func serve(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Parse(args)
+
+	c, db, err := connect(ctx)
+	if err != nil {
+		return err
 	}
+	defer db.Close()
 
-	trackedProducts, err := dbpkg.ListTrackedProductsForUser(ctx, db, uid)
+	flushTraces, err := setupTracing(ctx, c)
 	if err != nil {
-		log.Fatal(err)
-	}
-	fmt.Printf("Tracked URLs for user %s: %v\n", uid, trackedProducts)
-
-	for _, tp := range trackedProducts {
-		product, err := productpkg.FetchProduct(
-			ctx,
-			client,
-			tp.URL,
-		)
-		if err != nil {
-			log.Fatal(err)
-		}
+		return err
+	}
+	defer flushTraces()
 
-		if tp.URL != product.URL {
-			log.Fatalf("Fetched product URL (%s) does not match requested URL (%s)", product.URL, tp.URL)
-		}
+	images, err := newImageStore(c)
+	if err != nil {
+		return err
+	}
+
+	server, err := web.NewServer(db, c.FeedSecret, images)
+	if err != nil {
+		return err
+	}
 
-		productpkg.PrintRelevantProductInfo(product)
+	m := metrics.New(db)
+	productpkg.SetFetchObserver(m)
+	dbpkg.SetQueryObserver(m)
 
-		rawjson, err := json.Marshal(product)
-		if err != nil {
-			log.Fatal(err)
-		}
+	expectedMigration, err := migrations.Latest()
+	if err != nil {
+		return err
+	}
+
+	tr := tracker.New(db, newHTTPClient(), m)
+	m.WatchPoller(tr)
+	if images != nil {
+		tr.ArchiveImagesTo(images)
+	}
+	if c.ExchangeRatesURL != "" {
+		tr.ImportExchangeRatesFrom(c.ExchangeRatesURL)
+	}
+	if c.SMTP.Host != "" {
+		tr.SendDigestsWith(newMailer(c.SMTP))
+	}
+	go tr.Run(ctx, c.PollInterval)
+
+	// a poll cycle may take a while, only report a stall once one is overdue
+	checker := health.NewChecker(db, expectedMigration, tr, 2*c.PollInterval)
 
-		dbpkg.StoreNextAddSnapshot(ctx,
-			db,
-			tp.ID,
-			product.Name,
-			product.Description,
-			int64(product.Offers.Price*100),
-			product.Offers.PriceCurrency,
-			product.Offers.Availability,
-			rawjson,
-		)
-		fmt.Println("Stored snapshot for", product.URL)
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", m.Handler())
+	mux.HandleFunc("GET /healthz", health.Healthz)
+	mux.HandleFunc("GET /readyz", checker.Readyz)
+	mux.HandleFunc("GET /version", health.Version)
+	mux.Handle("/", logging.Middleware(server))
+
+	httpServer := &http.Server{
+		Addr:              fmt.Sprintf(":%d", c.Port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("listening", "addr", httpServer.Addr)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
-func debug() {
+func poll(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("poll", flag.ExitOnError)
+	fs.Parse(args)
 
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	c, db, err := connect(ctx)
+	if err != nil {
+		return err
 	}
-	ctx := context.Background()
+	defer db.Close()
 
-	ads := []string{
-		// `https://www.olx.ro/d/oferta/mouse-gaming-logitech-pro-x-superlight-IDkbEDA.html`,
-		// `https://www.olx.ro/d/oferta/motocicleta-ktm-790-duke-24-IDgV8Gy.html`,
-		// `https://www.olx.ro/d/oferta/inchiriere-apartament-2-camere-IDkdRuG.html`,
-		// `https://www.olx.ro/d/oferta/apple-magic-mouse-2-reincarcabil-port-lightning-sdasjasd.html`,
-		`https://www.olx.ro/d/oferta/apple-magic-mouse-2-reincarcabil-port-lightning-IDjTmhe.html`,
+	flushTraces, err := setupTracing(ctx, c)
+	if err != nil {
+		return err
 	}
+	defer flushTraces()
 
-	for _, ad := range ads {
-		product, err := productpkg.FetchProduct(
-			ctx,
-			client,
-			ad,
-		)
-		if err != nil {
-			log.Fatal(err)
-		}
-		productpkg.PrintRelevantProductInfo(product)
+	images, err := newImageStore(c)
+	if err != nil {
+		return err
+	}
 
+	tr := tracker.New(db, newHTTPClient(), nil)
+	if images != nil {
+		tr.ArchiveImagesTo(images)
+	}
+	if c.ExchangeRatesURL != "" {
+		tr.ImportExchangeRatesFrom(c.ExchangeRatesURL)
 	}
+	if c.SMTP.Host != "" {
+		tr.SendDigestsWith(newMailer(c.SMTP))
+	}
+	return tr.PollOnce(ctx)
+}
+
+func useradd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("useradd", flag.ExitOnError)
+	username := fs.String("username", "", "name of the new user")
+	password := fs.String("password", "", "password of the new user")
+	fs.Parse(args)
+
+	if *username == "" || *password == "" {
+		return errors.New("both -username and -password are required")
+	}
+
+	_, db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	uid, err := dbpkg.NewUser(ctx, db, *username, *password, true)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("User ID: %s\n", uid)
+
+	return nil
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/market"
+)
+
+func marketCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("market", flag.ExitOnError)
+	add := fs.String("add-keyword", "", "start computing the market stats of a keyword query")
+	remove := fs.String("remove-keyword", "", "stop computing the market stats of a keyword query")
+	refresh := fs.Bool("refresh", false, "compute the market stats now instead of after the next poll cycle")
+	fs.Parse(args)
+
+	if *add != "" && *remove != "" {
+		return errors.New("only one of -add-keyword and -remove-keyword can be given")
+	}
+
+	_, db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch {
+	case *add != "":
+		keyword := market.NormalizeKeyword(*add)
+		if keyword == "" {
+			return errors.New("the keyword has no letters or digits")
+		}
+		if err := dbpkg.AddMarketKeyword(ctx, db, keyword); err != nil {
+			if errors.Is(err, dbpkg.ErrAlreadyExists) {
+				return fmt.Errorf("keyword %q was already added", keyword)
+			}
+			return err
+		}
+	case *remove != "":
+		keyword := market.NormalizeKeyword(*remove)
+		if err := dbpkg.RemoveMarketKeyword(ctx, db, keyword); err != nil {
+			if errors.Is(err, dbpkg.ErrNotFound) {
+				return fmt.Errorf("keyword %q was not added", keyword)
+			}
+			return err
+		}
+	}
+
+	if *refresh {
+		if err := dbpkg.RefreshMarketStats(ctx, db); err != nil {
+			return err
+		}
+	}
+
+	keywords, err := dbpkg.ListMarketKeywords(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, k := range keywords {
+		fmt.Println(k)
+	}
+	return nil
+}
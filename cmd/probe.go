@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Ozoniuss/olx-tracker/config"
+)
+
+// probe requests a health endpoint of the server running in the same
+// container and fails unless it responds with 200. The scratch image has no
+// shell or curl, so this is what its health checks run.
+func probe(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("probe", flag.ExitOnError)
+	path := fs.String("path", "/healthz", "endpoint to probe, e.g. /readyz")
+	timeout := fs.Duration("timeout", 3*time.Second, "how long to wait for a response")
+	fs.Parse(args)
+
+	// the probe runs next to the server, so it sees the same config
+	c, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", c.Port, *path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to probe %s: %w", *path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("probe %s: unexpected status %s", *path, resp.Status)
+	}
+	return nil
+}
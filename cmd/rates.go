@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/exchange"
+	"github.com/Ozoniuss/olx-tracker/internal/money"
+)
+
+func ratesCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("rates", flag.ExitOnError)
+	importFile := fs.String("import", "", "import an ECB or BNR reference rates XML file, - for stdin")
+	fetch := fs.Bool("fetch", false, "import the reference rates from -url")
+	fetchURL := fs.String("url", "", "where -fetch downloads the rates from, defaults to exchange_rates_url or the daily ECB rates")
+	convert := fs.String("convert", "", `convert a price, e.g. "449.50 RON"`)
+	to := fs.String("to", "EUR", "currency -convert converts to")
+	date := fs.String("date", "", "day -convert uses the rates of, e.g. 2026-10-16, defaults to today")
+	fs.Parse(args)
+
+	if *importFile != "" && *fetch {
+		return errors.New("only one of -import and -fetch can be given")
+	}
+	if *importFile == "" && !*fetch && *convert == "" {
+		return errors.New("one of -import, -fetch or -convert is required")
+	}
+
+	c, db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var source string
+	var rates []dbpkg.ExchangeRate
+	switch {
+	case *importFile != "":
+		var r io.Reader = os.Stdin
+		if *importFile != "-" {
+			f, err := os.Open(*importFile)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		source, rates, err = exchange.Parse(r)
+	case *fetch:
+		u := *fetchURL
+		if u == "" {
+			u = c.ExchangeRatesURL
+		}
+		if u == "" {
+			u = exchange.DefaultURL
+		}
+		source, rates, err = exchange.Fetch(ctx, newHTTPClient(), u)
+	}
+	if err != nil {
+		return err
+	}
+	if len(rates) > 0 {
+		if err := dbpkg.StoreExchangeRates(ctx, db, source, rates); err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d %s rates\n", len(rates), source)
+	}
+
+	if *convert == "" {
+		return nil
+	}
+	amount, from, ok := strings.Cut(strings.TrimSpace(*convert), " ")
+	if !ok {
+		return errors.New(`-convert needs a price and its currency, e.g. "449.50 RON"`)
+	}
+	smallUnit, err := money.ParseMajorUnits(amount)
+	if err != nil {
+		return err
+	}
+	at := time.Now()
+	if *date != "" {
+		if at, err = time.Parse(time.DateOnly, *date); err != nil {
+			return fmt.Errorf("invalid -date: %w", err)
+		}
+	}
+
+	all, err := exchange.Load(ctx, db)
+	if err != nil {
+		return err
+	}
+	converted, err := all.Convert(smallUnit, strings.ToUpper(strings.TrimSpace(from)), strings.ToUpper(*to), at)
+	if err != nil {
+		return err
+	}
+	fmt.Println(money.Format(converted, strings.ToUpper(*to)))
+	return nil
+}
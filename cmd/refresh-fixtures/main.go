@@ -0,0 +1,101 @@
+// Command refresh-fixtures downloads the live OLX pages behind the parser
+// fixtures in internal/product/testdata, replacing the captured pages and
+// their recorded status codes. Fixtures without a url are written by hand and
+// left alone. Afterwards, regenerate the golden files with
+//
+//	go test ./internal/product -update
+//
+// and review the diff: a changed golden file means OLX changed its pages.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fixture mirrors the entries of testdata/fixtures.json.
+type fixture struct {
+	Name   string `json:"name"`
+	URL    string `json:"url,omitempty"`
+	Status int    `json:"status"`
+}
+
+func main() {
+	dir := flag.String("dir", "internal/product/testdata", "directory holding fixtures.json and the captured pages")
+	only := flag.String("only", "", "refresh only the fixture with this name")
+	flag.Parse()
+
+	if err := refresh(*dir, *only); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func refresh(dir, only string) error {
+	manifest := filepath.Join(dir, "fixtures.json")
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to read fixtures: %w", err)
+	}
+	var fixtures []fixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return fmt.Errorf("failed to parse fixtures: %w", err)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	var errs []error
+	for i, f := range fixtures {
+		if f.URL == "" || (only != "" && f.Name != only) {
+			continue
+		}
+
+		status, err := download(client, f.URL, filepath.Join(dir, f.Name+".html"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.Name, err))
+			continue
+		}
+		if status != f.Status {
+			fmt.Printf("%s: status changed from %d to %d\n", f.Name, f.Status, status)
+		}
+		fixtures[i].Status = status
+		fmt.Printf("%s: refreshed from %s\n", f.Name, f.URL)
+	}
+
+	out, err := json.MarshalIndent(fixtures, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(manifest, append(out, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write fixtures: %w", err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// download stores the page, whatever its status, since error pages are
+// fixtures too.
+func download(client *http.Client, url, path string) (int, error) {
+	// fetched like the tracker does, so the fixtures match what it sees
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	page, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read response: %w", err)
+	}
+	if err := os.WriteFile(path, page, 0o644); err != nil {
+		return 0, fmt.Errorf("failed to write page: %w", err)
+	}
+
+	return resp.StatusCode, nil
+}
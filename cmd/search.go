@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/preferences"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+func searchCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	username := fs.String("username", "", "user whose products are searched")
+	limit := fs.Int("limit", 20, "maximum number of results")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: olx-tracker search -username <name> [flags] <query>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	query := strings.Join(fs.Args(), " ")
+	if *username == "" || strings.TrimSpace(query) == "" {
+		return errors.New("both -username and a query are required")
+	}
+	if *limit < 1 {
+		return errors.New("-limit must be positive")
+	}
+
+	_, db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	userID, err := dbpkg.GetUserIDByUsername(ctx, db, *username)
+	if err != nil {
+		return err
+	}
+
+	prefs, err := preferences.Load(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+
+	results, err := dbpkg.SearchProductsForUser(ctx, db, userID, query, *limit)
+	if err != nil {
+		return err
+	}
+
+	highlight := plainHighlight
+	if isTerminal(os.Stdout) {
+		highlight = boldHighlight
+	}
+	for i, r := range results {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s  %s\n", highlight.Replace(r.NameHighlight), productpkg.FormatPrice(prefs.Locale, productpkg.PriceKind(r.PriceKind), r.PriceSmallUnit, r.HighPriceSmallUnit, r.Currency))
+		fmt.Printf("  %s (version %d of %s, %d matching)\n", r.URL, r.Version, prefs.FormatTime(r.RetrievedAt), r.MatchingVersions)
+		if r.DescriptionHighlight != "" {
+			fmt.Printf("  %s\n", highlight.Replace(r.DescriptionHighlight))
+		}
+	}
+	return nil
+}
+
+var (
+	plainHighlight = strings.NewReplacer(dbpkg.HighlightStart, "", dbpkg.HighlightEnd, "")
+	boldHighlight  = strings.NewReplacer(dbpkg.HighlightStart, "\x1b[1m", dbpkg.HighlightEnd, "\x1b[0m")
+)
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
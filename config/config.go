@@ -1,16 +1,102 @@
 package config
 
-//go:generate go tool genconfig -struct=Config -project=OlxTracker -env=.all
+import "time"
+
+// Config is loaded in layers: the defaults below, then the optional config
+// file, then the environment. Every field can be set in the environment with
+// a variable named after its yaml path, e.g. OLXTRACKER_POSTGRES_HOST for
+// postgres.host. Fields tagged as secret can also be read from the file named
+// by the variable with a _FILE suffix, and are redacted when printed.
 type Config struct {
-	Port     string
-	Postgres PostgresConfig
+	Port int `yaml:"port" toml:"port"`
+	// LogLevel is one of debug, info, warn or error.
+	LogLevel string `yaml:"log_level" toml:"log_level"`
+	// TraceExporter is one of none, stdout or otlp. The otlp exporter is
+	// configured with the standard OTEL_EXPORTER_OTLP_* variables.
+	TraceExporter string `yaml:"trace_exporter" toml:"trace_exporter"`
+	// PollInterval is how often every tracked ad is fetched.
+	PollInterval time.Duration `yaml:"poll_interval" toml:"poll_interval"`
+	// FeedSecret signs the feed urls handed out to users.
+	FeedSecret string `yaml:"feed_secret" toml:"feed_secret" secret:"true"`
+	// ImageDir is where the images of the tracked ads are archived. Images
+	// aren't archived if empty.
+	ImageDir string `yaml:"image_dir" toml:"image_dir"`
+	// ExchangeRatesURL is where the ECB or BNR reference rates are imported
+	// from at the start of every poll cycle. They aren't imported if empty.
+	ExchangeRatesURL string         `yaml:"exchange_rates_url" toml:"exchange_rates_url"`
+	Postgres         PostgresConfig `yaml:"postgres" toml:"postgres"`
+	// SMTP is the mail server digests are sent through.
+	SMTP SMTPConfig `yaml:"smtp" toml:"smtp"`
+}
+
+// SMTPConfig is a mail submission server. STARTTLS is used whenever the
+// server offers it, and credentials are only sent over TLS or to localhost.
+type SMTPConfig struct {
+	// Host is the mail server, digests aren't sent if empty.
+	Host     string `yaml:"host" toml:"host"`
+	Port     int    `yaml:"port" toml:"port"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password" secret:"true"`
+	// From is the address digests are sent from.
+	From string `yaml:"from" toml:"from"`
 }
 
 type PostgresConfig struct {
-	User     string
-	Password string
-	Host     string
-	Port     int
-	Database string
-	Schema   string
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password" secret:"true"`
+	Host     string `yaml:"host" toml:"host"`
+	Port     int    `yaml:"port" toml:"port"`
+	Database string `yaml:"database" toml:"database"`
+	Schema   string `yaml:"schema" toml:"schema"`
+	// SSLMode is one of disable, require, verify-ca or verify-full.
+	SSLMode string `yaml:"ssl_mode" toml:"ssl_mode"`
+	// SSLRootCert is the path of the CA certificates used to verify the
+	// server with verify-ca and verify-full. The system roots are used if
+	// empty.
+	SSLRootCert string `yaml:"ssl_root_cert" toml:"ssl_root_cert"`
+	// SSLCert and SSLKey are the paths of the client certificate and its key,
+	// for servers that authenticate clients by certificate.
+	SSLCert string `yaml:"ssl_cert" toml:"ssl_cert"`
+	SSLKey  string `yaml:"ssl_key" toml:"ssl_key"`
+	// ApplicationName shows up in pg_stat_activity.
+	ApplicationName string `yaml:"application_name" toml:"application_name"`
+	// StatementTimeout aborts statements running for longer. Zero disables
+	// the timeout.
+	StatementTimeout time.Duration `yaml:"statement_timeout" toml:"statement_timeout"`
+
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+	// ConnectTimeout is how long connecting at startup is retried, e.g.
+	// while the database is still starting.
+	ConnectTimeout time.Duration `yaml:"connect_timeout" toml:"connect_timeout"`
+}
+
+// Default returns the configuration used for everything that is set neither
+// in the config file nor in the environment. Credentials and secrets have no
+// defaults.
+func Default() Config {
+	return Config{
+		Port:          8080,
+		LogLevel:      "info",
+		TraceExporter: "none",
+		PollInterval:  time.Hour,
+		Postgres: PostgresConfig{
+			Host:             "127.0.0.1",
+			Port:             5432,
+			Schema:           "public",
+			SSLMode:          "disable",
+			ApplicationName:  "olx-tracker",
+			StatementTimeout: 30 * time.Second,
+			MaxOpenConns:     10,
+			MaxIdleConns:     5,
+			ConnMaxLifetime:  30 * time.Minute,
+			ConnMaxIdleTime:  5 * time.Minute,
+			ConnectTimeout:   30 * time.Second,
+		},
+		SMTP: SMTPConfig{
+			Port: 587,
+		},
+	}
 }
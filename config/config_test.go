@@ -0,0 +1,147 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var requiredEnv = map[string]string{
+	"OLXTRACKER_FEED_SECRET":       "secret",
+	"OLXTRACKER_POSTGRES_USER":     "user",
+	"OLXTRACKER_POSTGRES_PASSWORD": "password",
+	"OLXTRACKER_POSTGRES_DATABASE": "db",
+}
+
+func TestLoadDefaults(t *testing.T) {
+	c, err := load("", env(requiredEnv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Default()
+	want.FeedSecret = "secret"
+	want.Postgres.User = "user"
+	want.Postgres.Password = "password"
+	want.Postgres.Database = "db"
+	if c != want {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+}
+
+func TestLoadExampleFile(t *testing.T) {
+	c, err := load("example.yaml", env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Postgres.Schema != "olxtracker" || c.PollInterval != time.Hour {
+		t.Errorf("example file not loaded: %+v", c)
+	}
+}
+
+func TestLoadFileWithEnvOverrides(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+port: 9000
+poll_interval: 30m
+feed_secret: from-file
+postgres:
+  user: file-user
+  password: file-password
+  database: file-db
+`,
+		"config.toml": `
+port = 9000
+poll_interval = "30m"
+feed_secret = "from-file"
+
+[postgres]
+user = "file-user"
+password = "file-password"
+database = "file-db"
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := writeFile(t, name, content)
+			c, err := load(path, env(map[string]string{
+				"OLXTRACKER_POLL_INTERVAL":               "2h",
+				"OLXTRACKER_POSTGRES_HOST":               "db.internal",
+				"OLXTRACKER_POSTGRES_CONN_MAX_IDLE_TIME": "1m",
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c.Port != 9000 || c.FeedSecret != "from-file" || c.Postgres.User != "file-user" {
+				t.Errorf("file values not loaded: %+v", c)
+			}
+			if c.PollInterval != 2*time.Hour || c.Postgres.Host != "db.internal" || c.Postgres.ConnMaxIdleTime != time.Minute {
+				t.Errorf("env overrides not applied: %+v", c)
+			}
+			if c.LogLevel != "info" || c.Postgres.Port != 5432 {
+				t.Errorf("defaults not kept: %+v", c)
+			}
+		})
+	}
+}
+
+func TestLoadReportsAllErrors(t *testing.T) {
+	_, err := load("", env(map[string]string{
+		"OLXTRACKER_PORT":          "http",
+		"OLXTRACKER_POLL_INTERVAL": "often",
+		"OLXTRACKER_LOG_LEVEL":     "verbose",
+		"OLXTRACKER_POSTGRES_PORT": "70000",
+		"OLXTRACKER_SMTP_HOST":     "mail.example.com",
+		"OLXTRACKER_SMTP_FROM":     "OLX Tracker",
+	}))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, want := range []string{
+		`OLXTRACKER_PORT: invalid integer "http"`,
+		`OLXTRACKER_POLL_INTERVAL: invalid duration "often"`,
+		`log level "verbose"`,
+		"postgres port 70000 is out of range",
+		"feed secret is not set",
+		"postgres password is not set",
+		`smtp from "OLX Tracker" is not an email address`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %q", err, want)
+		}
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	for name, content := range map[string]string{
+		"config.yaml": "prot: 8080\n",
+		"config.toml": "prot = 8080\n",
+		"config.json": "{}",
+	} {
+		path := writeFile(t, name, content)
+		if _, err := load(path, env(requiredEnv)); err == nil {
+			t.Errorf("expected an error for %s", name)
+		}
+	}
+}
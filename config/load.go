@@ -0,0 +1,218 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "OLXTRACKER"
+
+// FileEnv names the variable holding the path of the optional config file.
+// The format is picked by the extension: .yaml, .yml or .toml.
+const FileEnv = envPrefix + "_CONFIG"
+
+// LoadConfig layers the config file named by FileEnv, if any, and the
+// environment over the defaults and validates the result. All problems are
+// reported together.
+func LoadConfig() (Config, error) {
+	return load(os.Getenv(FileEnv), os.LookupEnv)
+}
+
+func load(path string, lookupEnv func(string) (string, bool)) (Config, error) {
+	c := Default()
+
+	if path != "" {
+		if err := decodeFile(path, &c); err != nil {
+			return Config{}, err
+		}
+	}
+
+	errs := applyEnv(reflect.ValueOf(&c).Elem(), envPrefix, lookupEnv)
+	errs = append(errs, c.validate()...)
+	if len(errs) > 0 {
+		return Config{}, fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+
+	return c, nil
+}
+
+func decodeFile(path string, c *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		// a file without any values decodes to io.EOF, which is fine
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("failed to parse config file %s: unknown keys %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("unsupported config file %s, use .yaml, .yml or .toml", path)
+	}
+
+	return nil
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// applyEnv overrides the fields of the struct v with the variables named
+// prefix_FIELD, recursing into nested structs as prefix_STRUCT_FIELD. FIELD
+// is the upper-cased yaml key, so the variables match the config file.
+func applyEnv(v reflect.Value, prefix string, lookupEnv func(string) (string, bool)) []error {
+	var errs []error
+
+	for i := range v.NumField() {
+		field := v.Field(i)
+		name := prefix + "_" + envName(v.Type().Field(i))
+
+		if field.Kind() == reflect.Struct {
+			errs = append(errs, applyEnv(field, name, lookupEnv)...)
+			continue
+		}
+
+		raw, ok := lookupEnv(name)
+		if isSecret(v.Type().Field(i)) {
+			fromFile, found, err := readSecretFile(name, lookupEnv)
+			switch {
+			case err != nil:
+				errs = append(errs, err)
+				continue
+			case found && ok:
+				errs = append(errs, fmt.Errorf("%s: only one of %s and %s_FILE may be set", name, name, name))
+				continue
+			case found:
+				raw, ok = fromFile, true
+			}
+		}
+		if !ok {
+			continue
+		}
+		if err := setField(field, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	return errs
+}
+
+func envName(f reflect.StructField) string {
+	key, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if key == "" {
+		key = f.Name
+	}
+	return strings.ToUpper(key)
+}
+
+func setField(field reflect.Value, raw string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+func (c Config) validate() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(validPort(c.Port), "port %d is out of range", c.Port)
+	check(slices.Contains([]string{"debug", "info", "warn", "error"}, strings.ToLower(c.LogLevel)),
+		"log level %q is not one of debug, info, warn or error", c.LogLevel)
+	check(slices.Contains([]string{"none", "stdout", "otlp"}, c.TraceExporter),
+		"trace exporter %q is not one of none, stdout or otlp", c.TraceExporter)
+	check(c.PollInterval >= time.Minute, "poll interval %s is shorter than a minute", c.PollInterval)
+	check(c.FeedSecret != "", "feed secret is not set")
+	if c.ExchangeRatesURL != "" {
+		u, err := url.Parse(c.ExchangeRatesURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"exchange rates url %q is not an http(s) url", c.ExchangeRatesURL)
+	}
+
+	check(c.Postgres.User != "", "postgres user is not set")
+	check(c.Postgres.Password != "", "postgres password is not set")
+	check(c.Postgres.Host != "", "postgres host is not set")
+	check(validPort(c.Postgres.Port), "postgres port %d is out of range", c.Postgres.Port)
+	check(c.Postgres.Database != "", "postgres database is not set")
+	check(c.Postgres.Schema != "", "postgres schema is not set")
+	check(slices.Contains([]string{"disable", "require", "verify-ca", "verify-full"}, c.Postgres.SSLMode),
+		"postgres ssl mode %q is not one of disable, require, verify-ca or verify-full", c.Postgres.SSLMode)
+	for _, path := range []string{c.Postgres.SSLRootCert, c.Postgres.SSLCert, c.Postgres.SSLKey} {
+		if path != "" {
+			_, err := os.Stat(path)
+			check(err == nil, "postgres tls file: %v", err)
+		}
+	}
+	check((c.Postgres.SSLCert == "") == (c.Postgres.SSLKey == ""),
+		"postgres ssl cert and ssl key must be set together")
+	check(c.Postgres.StatementTimeout >= 0, "postgres statement timeout is negative")
+	check(c.Postgres.MaxOpenConns >= 0, "postgres max open conns is negative")
+	check(c.Postgres.MaxIdleConns >= 0, "postgres max idle conns is negative")
+	check(c.Postgres.MaxOpenConns == 0 || c.Postgres.MaxIdleConns <= c.Postgres.MaxOpenConns,
+		"postgres max idle conns %d is more than max open conns %d", c.Postgres.MaxIdleConns, c.Postgres.MaxOpenConns)
+	check(c.Postgres.ConnectTimeout > 0, "postgres connect timeout must be positive")
+
+	if c.SMTP.Host != "" {
+		check(validPort(c.SMTP.Port), "smtp port %d is out of range", c.SMTP.Port)
+		from, err := mail.ParseAddress(c.SMTP.From)
+		check(err == nil && from.Address == c.SMTP.From, "smtp from %q is not an email address", c.SMTP.From)
+	}
+
+	return errs
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
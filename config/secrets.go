@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+func isSecret(f reflect.StructField) bool {
+	return f.Tag.Get("secret") == "true"
+}
+
+// readSecretFile reads the secret from the file named by name_FILE, as
+// mounted by Docker and Kubernetes secrets. A single trailing newline is
+// dropped.
+func readSecretFile(name string, lookupEnv func(string) (string, bool)) (string, bool, error) {
+	path, ok := lookupEnv(name + "_FILE")
+	if !ok {
+		return "", false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: failed to read secret: %w", name, err)
+	}
+
+	secret := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(secret, "\r"), true, nil
+}
+
+// redact replaces every non-empty secret of the struct v with a placeholder.
+func redact(v reflect.Value) {
+	for i := range v.NumField() {
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			redact(field)
+		case isSecret(v.Type().Field(i)) && field.String() != "":
+			field.SetString(redacted)
+		}
+	}
+}
+
+// logValue groups the fields of the struct v under their config file keys.
+func logValue(v reflect.Value) slog.Value {
+	attrs := make([]slog.Attr, 0, v.NumField())
+	for i := range v.NumField() {
+		f := v.Type().Field(i)
+		key, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if v.Field(i).Kind() == reflect.Struct {
+			attrs = append(attrs, slog.Attr{Key: key, Value: logValue(v.Field(i))})
+			continue
+		}
+		attrs = append(attrs, slog.Any(key, v.Field(i).Interface()))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// Redacted returns a copy of the config with the secrets replaced by a
+// placeholder.
+func (c Config) Redacted() Config {
+	redact(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+// String prints the config with the secrets redacted.
+func (c Config) String() string {
+	type plain Config
+	return fmt.Sprintf("%+v", plain(c.Redacted()))
+}
+
+// LogValue logs the config with the secrets redacted.
+func (c Config) LogValue() slog.Value {
+	return logValue(reflect.ValueOf(c.Redacted()))
+}
+
+// Redacted returns a copy of the config with the password replaced by a
+// placeholder.
+func (c PostgresConfig) Redacted() PostgresConfig {
+	redact(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+// String prints the config with the password redacted.
+func (c PostgresConfig) String() string {
+	type plain PostgresConfig
+	return fmt.Sprintf("%+v", plain(c.Redacted()))
+}
+
+// LogValue logs the config with the password redacted.
+func (c PostgresConfig) LogValue() slog.Value {
+	return logValue(reflect.ValueOf(c.Redacted()))
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	password := filepath.Join(dir, "password")
+	if err := os.WriteFile(password, []byte("p@ss word\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	vars := map[string]string{}
+	for k, v := range requiredEnv {
+		vars[k] = v
+	}
+	delete(vars, "OLXTRACKER_POSTGRES_PASSWORD")
+	vars["OLXTRACKER_POSTGRES_PASSWORD_FILE"] = password
+
+	c, err := load("", env(vars))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Postgres.Password != "p@ss word" {
+		t.Errorf("got password %q from file", c.Postgres.Password)
+	}
+
+	vars["OLXTRACKER_POSTGRES_PASSWORD"] = "also-set"
+	if _, err := load("", env(vars)); err == nil || !strings.Contains(err.Error(), "only one of") {
+		t.Errorf("expected an error when both are set, got %v", err)
+	}
+
+	delete(vars, "OLXTRACKER_POSTGRES_PASSWORD")
+	vars["OLXTRACKER_FEED_SECRET_FILE"] = filepath.Join(dir, "missing")
+	if _, err := load("", env(vars)); err == nil {
+		t.Error("expected an error for a missing secret file")
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	c := Default()
+	c.FeedSecret = "feed-secret"
+	c.Postgres.User = "olxtracker"
+	c.Postgres.Password = "db-password"
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("loaded", "config", c)
+
+	printed := map[string]string{
+		"String":          c.String(),
+		"Println":         fmt.Sprintln(c),
+		"Postgres.String": c.Postgres.String(),
+		"LogValue":        buf.String(),
+	}
+	for how, out := range printed {
+		if strings.Contains(out, "feed-secret") || strings.Contains(out, "db-password") {
+			t.Errorf("%s leaks a secret: %s", how, out)
+		}
+		if !strings.Contains(out, "olxtracker") || !strings.Contains(out, redacted) {
+			t.Errorf("%s doesn't show the redacted config: %s", how, out)
+		}
+	}
+
+	if c.Postgres.Password != "db-password" {
+		t.Error("redacting modified the config")
+	}
+}
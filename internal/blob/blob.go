@@ -0,0 +1,33 @@
+// Package blob stores files by their content. A blob is keyed by the hex
+// SHA-256 of its content, so the same content stored twice is kept once and
+// a key always refers to the same bytes.
+package blob
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store is a content-addressed blob store. The filesystem store is the only
+// one so far, but nothing here prevents an S3 compatible one.
+type Store interface {
+	// Put stores the content read from r and returns its key and size.
+	Put(ctx context.Context, r io.Reader) (key string, size int64, err error)
+	// Open returns the content of a blob, or ErrNotFound.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// ValidKey reports whether key looks like a key returned by Put, which
+// stores can rely on before turning a key into a path.
+func ValidKey(key string) bool {
+	if len(key) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil && key == strings.ToLower(key)
+}
@@ -0,0 +1,134 @@
+package bulkimport
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+type Status string
+
+const (
+	StatusTracked        Status = "tracked"
+	StatusAlreadyTracked Status = "already tracked"
+	StatusInvalid        Status = "invalid"
+	StatusUnsupported    Status = "unsupported"
+	// StatusTrackedByOther means another user tracks the url already, urls
+	// are unique across users.
+	StatusTrackedByOther Status = "tracked by another user"
+)
+
+// Result is the outcome for a single input line.
+type Result struct {
+	Line   int
+	URL    string
+	Status Status
+	Reason string
+}
+
+// DefaultChunkSize is how many urls are inserted per transaction.
+const DefaultChunkSize = 100
+
+// Import validates and normalizes the entries and tracks them for the user,
+// chunkSize urls per transaction. Results are returned in input order.
+//
+// If a chunk fails, the results of the chunks committed before it are
+// returned together with the error. Urls that are already tracked are
+// reported as such, so running the same import again resumes where the
+// failed one stopped.
+func Import(
+	ctx context.Context,
+	db *sql.DB,
+	userID uuid.UUID,
+	entries []Entry,
+	chunkSize int,
+) ([]Result, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	results := make([]Result, len(entries))
+	var (
+		pending  []int // indexes into entries and results
+		requests []dbpkg.TrackRequest
+	)
+	seen := make(map[string]int)
+
+	for i, e := range entries {
+		results[i] = Result{Line: e.Line, URL: e.URL}
+
+		if e.Err != nil {
+			results[i].Status = StatusInvalid
+			results[i].Reason = e.Err.Error()
+			continue
+		}
+
+		normalized, err := productpkg.NormalizeURL(e.URL)
+		if err != nil {
+			results[i].Status = StatusInvalid
+			if errors.Is(err, productpkg.ErrUnsupportedURL) {
+				results[i].Status = StatusUnsupported
+			}
+			results[i].Reason = err.Error()
+			continue
+		}
+		results[i].URL = normalized
+
+		if line, ok := seen[normalized]; ok {
+			results[i].Status = StatusAlreadyTracked
+			results[i].Reason = fmt.Sprintf("duplicate of line %d", line)
+			continue
+		}
+		seen[normalized] = e.Line
+
+		pending = append(pending, i)
+		requests = append(requests, dbpkg.TrackRequest{
+			URL:                  normalized,
+			TargetPriceSmallUnit: e.TargetPriceSmallUnit,
+			TargetPriceCurrency:  e.TargetPriceCurrency,
+			Notes:                e.Notes,
+		})
+	}
+
+	for start := 0; start < len(requests); start += chunkSize {
+		end := min(start+chunkSize, len(requests))
+
+		outcomes, err := dbpkg.TrackAddsForUser(ctx, db, userID, requests[start:end])
+		if err != nil {
+			return completed(results), fmt.Errorf("failed to import lines %d-%d: %w",
+				entries[pending[start]].Line, entries[pending[end-1]].Line, err)
+		}
+
+		for j, outcome := range outcomes {
+			i := pending[start+j]
+			switch outcome {
+			case dbpkg.TrackInserted:
+				results[i].Status = StatusTracked
+			case dbpkg.TrackAlreadyTracked:
+				results[i].Status = StatusAlreadyTracked
+			case dbpkg.TrackTrackedByOther:
+				results[i].Status = StatusTrackedByOther
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// completed drops the results that were never decided because their chunk
+// wasn't committed.
+func completed(results []Result) []Result {
+	var done []Result
+	for _, r := range results {
+		if r.Status != "" {
+			done = append(done, r)
+		}
+	}
+	return done
+}
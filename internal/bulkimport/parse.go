@@ -0,0 +1,212 @@
+package bulkimport
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/Ozoniuss/olx-tracker/internal/exchange"
+	"github.com/Ozoniuss/olx-tracker/internal/money"
+)
+
+type Format string
+
+const (
+	FormatAuto      Format = "auto"
+	FormatLines     Format = "lines"
+	FormatCSV       Format = "csv"
+	FormatBookmarks Format = "bookmarks"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatAuto, FormatLines, FormatCSV, FormatBookmarks:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported import format %q", s)
+	}
+}
+
+// Entry is a single url read from the input, with the line it was found on.
+// Err is set when the line itself is malformed, e.g. has an unparsable
+// target price.
+type Entry struct {
+	Line                 int
+	URL                  string
+	TargetPriceSmallUnit sql.NullInt64
+	TargetPriceCurrency  string
+	Notes                string
+	Err                  error
+}
+
+// Parse reads all entries from r. With FormatAuto the format is guessed from
+// the content: bookmark exports are HTML, CSV files must start with a header
+// that has a "url" column, anything else is one url per line.
+func Parse(r io.Reader, format Format) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	if format == FormatAuto {
+		format = detectFormat(data)
+	}
+
+	switch format {
+	case FormatCSV:
+		return parseCSV(data)
+	case FormatBookmarks:
+		return parseBookmarks(data)
+	default:
+		return parseLines(data), nil
+	}
+}
+
+func detectFormat(data []byte) Format {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("<")) {
+		return FormatBookmarks
+	}
+
+	firstLine, _, _ := bytes.Cut(trimmed, []byte("\n"))
+	for _, column := range strings.Split(string(firstLine), ",") {
+		if normalizeColumn(column) == "url" {
+			return FormatCSV
+		}
+	}
+
+	return FormatLines
+}
+
+func parseLines(data []byte) []Entry {
+	var entries []Entry
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, Entry{Line: i + 1, URL: line})
+	}
+	return entries
+}
+
+func parseCSV(data []byte) ([]Entry, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	urlCol, priceCol, currencyCol, notesCol := -1, -1, -1, -1
+	for i, column := range header {
+		switch normalizeColumn(column) {
+		case "url":
+			urlCol = i
+		case "target_price":
+			priceCol = i
+		case "currency":
+			currencyCol = i
+		case "notes":
+			notesCol = i
+		default:
+			return nil, fmt.Errorf("unsupported csv column %q, the supported ones are url, target_price, currency and notes", column)
+		}
+	}
+	if urlCol == -1 {
+		return nil, errors.New(`csv header has no "url" column`)
+	}
+
+	field := func(record []string, col int) string {
+		if col < 0 || col >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[col])
+	}
+
+	var entries []Entry
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv: %w", err)
+		}
+
+		line, _ := r.FieldPos(0)
+		entry := Entry{
+			Line:  line,
+			URL:   field(record, urlCol),
+			Notes: field(record, notesCol),
+		}
+		if price := field(record, priceCol); price != "" {
+			entry.TargetPriceSmallUnit, entry.TargetPriceCurrency, entry.Err = parseTargetPrice(price, field(record, currencyCol))
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// parseBookmarks extracts every link from a browser bookmarks export
+// (the Netscape bookmark file format all browsers use).
+func parseBookmarks(data []byte) ([]Entry, error) {
+	var entries []Entry
+
+	line := 1
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if errors.Is(z.Err(), io.EOF) {
+				return entries, nil
+			}
+			return nil, fmt.Errorf("failed to parse bookmarks: %w", z.Err())
+		}
+
+		// Raw has to be read before Token, which consumes it.
+		tokenLine := line
+		line += bytes.Count(z.Raw(), []byte("\n"))
+
+		if tt != html.StartTagToken {
+			continue
+		}
+		t := z.Token()
+		if t.Data != "a" {
+			continue
+		}
+		for _, a := range t.Attr {
+			if a.Key == "href" {
+				entries = append(entries, Entry{Line: tokenLine, URL: a.Val})
+			}
+		}
+	}
+}
+
+// parseTargetPrice parses a target price such as "449.50" and the currency
+// it is in, which is required as ads are priced in both RON and EUR.
+func parseTargetPrice(price, currency string) (sql.NullInt64, string, error) {
+	smallUnit, err := money.ParseMajorUnits(price)
+	if err != nil {
+		return sql.NullInt64{}, "", fmt.Errorf("invalid target price %q", price)
+	}
+	currency = strings.ToUpper(currency)
+	if !exchange.ValidCurrency(currency) {
+		return sql.NullInt64{}, "", fmt.Errorf("target price %q needs a currency code such as RON", price)
+	}
+	return sql.NullInt64{Int64: smallUnit, Valid: true}, currency, nil
+}
+
+func normalizeColumn(column string) string {
+	column = strings.ToLower(strings.TrimSpace(column))
+	return strings.ReplaceAll(column, " ", "_")
+}
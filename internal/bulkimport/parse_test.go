@@ -0,0 +1,103 @@
+package bulkimport
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLines(t *testing.T) {
+	input := `# ads to look at
+https://www.olx.ro/d/oferta/a-IDa.html
+
+https://www.olx.ro/d/oferta/b-IDb.html
+`
+	entries, err := Parse(strings.NewReader(input), FormatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", entries)
+	}
+	if entries[0].Line != 2 || entries[1].Line != 4 {
+		t.Errorf("unexpected line numbers: %v", entries)
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	input := `URL, Target Price, Currency, Notes
+https://www.olx.ro/d/oferta/a-IDa.html,449.5,ron,"for the office, maybe"
+https://www.olx.ro/d/oferta/b-IDb.html,,,
+https://www.olx.ro/d/oferta/c-IDc.html,cheap,RON,
+https://www.olx.ro/d/oferta/d-IDd.html,300,,
+`
+	entries, err := Parse(strings.NewReader(input), FormatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %v", entries)
+	}
+
+	first := entries[0]
+	if first.Line != 2 || first.URL != "https://www.olx.ro/d/oferta/a-IDa.html" {
+		t.Errorf("unexpected first entry: %+v", first)
+	}
+	if !first.TargetPriceSmallUnit.Valid || first.TargetPriceSmallUnit.Int64 != 44950 || first.TargetPriceCurrency != "RON" {
+		t.Errorf("unexpected target price: %+v", first)
+	}
+	if first.Notes != "for the office, maybe" {
+		t.Errorf("unexpected notes: %q", first.Notes)
+	}
+
+	if entries[1].TargetPriceSmallUnit.Valid || entries[1].Err != nil {
+		t.Errorf("empty target price should be left unset: %+v", entries[1])
+	}
+	if entries[2].Err == nil {
+		t.Errorf("expected an error for an invalid target price")
+	}
+	if entries[3].Err == nil {
+		t.Errorf("expected an error for a target price without currency")
+	}
+}
+
+func TestParseCSVUnsupportedColumn(t *testing.T) {
+	_, err := Parse(strings.NewReader("url,target price,price alert\nx,1,y\n"), FormatCSV)
+	if err == nil {
+		t.Fatal("expected an error for an unsupported column")
+	}
+}
+
+func TestParseCSVWithoutURLColumn(t *testing.T) {
+	_, err := Parse(strings.NewReader("link,notes\nx,y\n"), FormatCSV)
+	if err == nil {
+		t.Fatal("expected an error for a header without url column")
+	}
+}
+
+func TestParseBookmarks(t *testing.T) {
+	input := `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3>OLX</H3>
+    <DL><p>
+        <DT><A HREF="https://www.olx.ro/d/oferta/a-IDa.html" ADD_DATE="1700000000">Ad A</A>
+        <DT><A HREF="https://example.com/">Not an ad</A>
+    </DL><p>
+</DL><p>
+`
+	entries, err := Parse(strings.NewReader(input), FormatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", entries)
+	}
+	if entries[0].URL != "https://www.olx.ro/d/oferta/a-IDa.html" || entries[0].Line != 8 {
+		t.Errorf("unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].URL != "https://example.com/" || entries[1].Line != 9 {
+		t.Errorf("unexpected second entry: %+v", entries[1])
+	}
+}
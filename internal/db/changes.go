@@ -0,0 +1,249 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+type ChangeKind string
+
+const (
+	// ChangeTracked is the first snapshot of a newly tracked ad.
+	ChangeTracked ChangeKind = "tracked"
+	// ChangePrice is a change of a fixed price to another fixed price, so
+	// the two can be compared.
+	ChangePrice ChangeKind = "price"
+	// ChangePriceTerms is any other change of the price: its kind changed,
+	// e.g. from fixed to on request, or the ends of a range moved.
+	ChangePriceTerms   ChangeKind = "price_terms"
+	ChangeAvailability ChangeKind = "availability"
+	ChangeDeactivated  ChangeKind = "deactivated"
+	// ChangeWatchMatch is a snapshot that matched a watch rule of the user,
+	// see ListWatchMatchesForUser.
+	ChangeWatchMatch ChangeKind = "watch_match"
+)
+
+// ProductChange is a snapshot that differs from the one before it in price,
+// currency or availability, or the deactivation of an ad. The Previous*
+// fields hold the values of the preceding snapshot; for a deactivation they
+// are the values of the last snapshot. PriceKind tells how to read the
+// prices, see product.PriceKind; the high prices are only set for ranges.
+type ProductChange struct {
+	Kind      ChangeKind
+	ProductID uuid.UUID
+	URL       string
+	Version   int
+	At        time.Time
+	Name      string
+
+	PriceSmallUnit     int64
+	HighPriceSmallUnit sql.NullInt64
+	PriceKind          string
+	Currency           string
+	Availability       string
+
+	PreviousPriceSmallUnit     int64
+	PreviousHighPriceSmallUnit sql.NullInt64
+	PreviousPriceKind          string
+	PreviousCurrency           string
+	PreviousAvailability       string
+
+	// RiskScore and RiskReasons are the risk assessment of the snapshot, a
+	// zero score if it wasn't assessed.
+	RiskScore   int
+	RiskReasons RiskReasons
+
+	// WatchRuleID and WatchRule are the id and name of the rule a
+	// ChangeWatchMatch is about.
+	WatchRuleID uuid.UUID
+	WatchRule   string
+}
+
+// ListProductChangesForUser returns the most recent meaningful changes of
+// the user's products, newest first. If productID is valid only the changes
+// of that product are returned.
+func ListProductChangesForUser(
+	ctx context.Context,
+	db *sql.DB,
+	userID uuid.UUID,
+	productID uuid.NullUUID,
+	limit int,
+) (_ []ProductChange, err error) {
+	defer observe("ListProductChangesForUser", time.Now(), &err)
+
+	return listProductChanges(ctx, db, userID, productID, sql.NullTime{}, sql.NullTime{}, sql.NullInt64{Int64: int64(limit), Valid: true})
+}
+
+// ListProductChangesForUserBetween returns all changes of the user's
+// products that happened from since until before until, newest first.
+func ListProductChangesForUserBetween(
+	ctx context.Context,
+	db *sql.DB,
+	userID uuid.UUID,
+	since, until time.Time,
+) (_ []ProductChange, err error) {
+	defer observe("ListProductChangesForUserBetween", time.Now(), &err)
+
+	return listProductChanges(ctx, db, userID, uuid.NullUUID{},
+		sql.NullTime{Time: since, Valid: true},
+		sql.NullTime{Time: until, Valid: true},
+		sql.NullInt64{},
+	)
+}
+
+// listProductChanges returns the changes of the user's products, of a single
+// product if productID is valid, optionally in a time window and limited.
+// The window only filters the changes, they are still found by comparing to
+// the snapshots before it.
+func listProductChanges(
+	ctx context.Context,
+	db *sql.DB,
+	userID uuid.UUID,
+	productID uuid.NullUUID,
+	since, until sql.NullTime,
+	limit sql.NullInt64,
+) ([]ProductChange, error) {
+	const query = `
+		SELECT deactivated, product_id, url, version, at, name,
+			price, high_price, price_kind, currency, availability,
+			prev_price, prev_high_price, prev_price_kind, prev_currency, prev_availability,
+			risk_score, risk_reasons
+		FROM (
+			SELECT false AS deactivated, product_id, url, version, retrieved_at AS at, name,
+				price, high_price, price_kind, currency, availability,
+				prev_price, prev_high_price, prev_price_kind, prev_currency, prev_availability,
+				risk_score, risk_reasons
+			FROM (
+				SELECT
+					p.id AS product_id,
+					p.url,
+					pv.version,
+					pv.retrieved_at,
+					pv.name,
+					pv.price_small_unit AS price,
+					pv.high_price_small_unit AS high_price,
+					pv.price_kind,
+					pv.currency,
+					COALESCE(pv.availability, '') AS availability,
+					LAG(pv.price_small_unit) OVER w AS prev_price,
+					LAG(pv.high_price_small_unit) OVER w AS prev_high_price,
+					LAG(pv.price_kind) OVER w AS prev_price_kind,
+					LAG(pv.currency) OVER w AS prev_currency,
+					LAG(COALESCE(pv.availability, '')) OVER w AS prev_availability,
+					COALESCE(pv.risk_score, 0) AS risk_score,
+					pv.risk_reasons
+				FROM products p
+				INNER JOIN product_versions pv
+					ON pv.product_id = p.id
+				WHERE p.user_id = $1 AND ($2::uuid IS NULL OR p.id = $2::uuid)
+				WINDOW w AS (PARTITION BY pv.product_id ORDER BY pv.version)
+			) versions
+			WHERE prev_price IS NULL
+				OR prev_price <> price
+				OR prev_high_price IS DISTINCT FROM high_price
+				OR prev_price_kind <> price_kind
+				OR prev_currency <> currency
+				OR prev_availability <> availability
+
+			UNION ALL
+
+			SELECT true, p.id, p.url, latest.version, p.deactivated_at, latest.name,
+				latest.price_small_unit, latest.high_price_small_unit, latest.price_kind,
+				latest.currency, COALESCE(latest.availability, ''),
+				latest.price_small_unit, latest.high_price_small_unit, latest.price_kind,
+				latest.currency, COALESCE(latest.availability, ''),
+				COALESCE(latest.risk_score, 0), latest.risk_reasons
+			FROM products p
+			INNER JOIN LATERAL (
+				SELECT version, name, price_small_unit, high_price_small_unit, price_kind,
+					currency, availability, risk_score, risk_reasons
+				FROM product_versions
+				WHERE product_id = p.id
+				ORDER BY version DESC
+				LIMIT 1
+			) latest ON true
+			WHERE p.user_id = $1 AND ($2::uuid IS NULL OR p.id = $2::uuid)
+				AND p.deactivated_at IS NOT NULL
+		) changes
+		WHERE ($4::timestamptz IS NULL OR at >= $4::timestamptz)
+			AND ($5::timestamptz IS NULL OR at < $5::timestamptz)
+		ORDER BY at DESC, version DESC
+		LIMIT $3
+	`
+
+	rows, err := db.QueryContext(ctx, query, userID, productID, limit, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	fixed := string(productpkg.PriceFixed)
+	var changes []ProductChange
+	for rows.Next() {
+		var (
+			c                ProductChange
+			deactivated      bool
+			prevPrice        sql.NullInt64
+			prevPriceKind    sql.NullString
+			prevCurrency     sql.NullString
+			prevAvailability sql.NullString
+		)
+		if err := rows.Scan(
+			&deactivated,
+			&c.ProductID,
+			&c.URL,
+			&c.Version,
+			&c.At,
+			&c.Name,
+			&c.PriceSmallUnit,
+			&c.HighPriceSmallUnit,
+			&c.PriceKind,
+			&c.Currency,
+			&c.Availability,
+			&prevPrice,
+			&c.PreviousHighPriceSmallUnit,
+			&prevPriceKind,
+			&prevCurrency,
+			&prevAvailability,
+			&c.RiskScore,
+			&c.RiskReasons,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		c.PreviousPriceSmallUnit = prevPrice.Int64
+		c.PreviousPriceKind = prevPriceKind.String
+		c.PreviousCurrency = prevCurrency.String
+		c.PreviousAvailability = prevAvailability.String
+
+		priceChanged := c.PreviousPriceSmallUnit != c.PriceSmallUnit ||
+			c.PreviousHighPriceSmallUnit != c.HighPriceSmallUnit ||
+			c.PreviousPriceKind != c.PriceKind ||
+			c.PreviousCurrency != c.Currency
+		switch {
+		case deactivated:
+			c.Kind = ChangeDeactivated
+		case !prevPrice.Valid:
+			c.Kind = ChangeTracked
+		case priceChanged && c.PriceKind == fixed && c.PreviousPriceKind == fixed:
+			c.Kind = ChangePrice
+		case priceChanged:
+			c.Kind = ChangePriceTerms
+		default:
+			c.Kind = ChangeAvailability
+		}
+
+		changes = append(changes, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return changes, nil
+}
@@ -5,44 +5,133 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/Ozoniuss/olx-tracker/config"
+	"github.com/Ozoniuss/olx-tracker/internal/tracing"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const tracerName = "github.com/Ozoniuss/olx-tracker/internal/db"
+
 var (
 	ErrAlreadyExists = fmt.Errorf("already exists")
 	ErrNotFound      = fmt.Errorf("not found")
 )
 
+// GetPostgresURL builds the connection URL, escaping every component. The
+// URL contains the password, so it must not end up in logs or errors.
 func GetPostgresURL(cfg config.PostgresConfig) string {
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable search_path=%s",
-		cfg.Host,
-		cfg.Port,
-		cfg.User,
-		cfg.Password,
-		cfg.Database,
-		cfg.Schema)
-	return dsn
+	query := url.Values{}
+	query.Set("sslmode", cfg.SSLMode)
+	query.Set("search_path", cfg.Schema)
+	if cfg.SSLRootCert != "" {
+		query.Set("sslrootcert", cfg.SSLRootCert)
+	}
+	if cfg.SSLCert != "" {
+		query.Set("sslcert", cfg.SSLCert)
+		query.Set("sslkey", cfg.SSLKey)
+	}
+	if cfg.ApplicationName != "" {
+		query.Set("application_name", cfg.ApplicationName)
+	}
+	// sent as a run-time parameter, so it applies to every pooled connection
+	query.Set("statement_timeout", strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10))
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Path:     "/" + cfg.Database,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
 }
 
-func ConnectToPostgres(ctx context.Context, dsn string) (*sql.DB, error) {
+// ConnectToPostgres opens the connection pool and waits for the database to
+// accept connections, retrying with backoff for up to cfg.ConnectTimeout.
+// Errors that retrying can't fix, such as wrong credentials, are returned
+// right away.
+func ConnectToPostgres(ctx context.Context, cfg config.PostgresConfig) (_ *sql.DB, err error) {
+	defer observe("ConnectToPostgres", time.Now(), &err)
+
 	// Connect to database
-	db, err := sql.Open("postgres", dsn)
+	db, err := sql.Open("postgres", GetPostgresURL(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
 
 	// Test database connection
-	if err := db.PingContext(ctx); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	var pingErr error
+	for attempt := 0; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return db, nil
+		}
+		if permanentConnectError(err) {
+			db.Close()
+			return nil, fmt.Errorf("failed to ping database: %w", err)
+		}
+		// keep the reason of the last real attempt rather than the timeout
+		if pingErr == nil || ctx.Err() == nil {
+			pingErr = err
+		}
+
+		delay := retryDelay(attempt)
+		select {
+		case <-ctx.Done():
+			db.Close()
+			return nil, fmt.Errorf("failed to ping database after %d attempts: %w", attempt+1, pingErr)
+		case <-time.After(delay):
+			slog.WarnContext(ctx, "database not reachable yet", "attempt", attempt+1, "error", pingErr)
+		}
 	}
+}
 
-	return db, nil
+// permanentConnectError reports whether the server refused the connection
+// for a reason that doesn't go away by waiting: failed authentication
+// (class 28) or a database that doesn't exist (class 3D).
+func permanentConnectError(err error) bool {
+	var pgErr *pq.Error
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.Code.Class() {
+	case "28", "3D":
+		return true
+	default:
+		return false
+	}
+}
+
+// retryDelay doubles the wait after every failed attempt, up to 5 seconds.
+func retryDelay(attempt int) time.Duration {
+	const (
+		initial = 250 * time.Millisecond
+		limit   = 5 * time.Second
+	)
+	if attempt >= 5 {
+		return limit
+	}
+	return min(initial<<attempt, limit)
 }
 
 type ProductWithUrl struct {
@@ -58,12 +147,22 @@ type ProductSnapshot struct {
 	Name           string
 	Description    string
 	PriceSmallUnit int64
-	Currency       string
-	Availability   string
-	RawJSON        []byte
+	// HighPriceSmallUnit is only set when the price is a range, and then
+	// PriceSmallUnit is the low end of it.
+	HighPriceSmallUnit sql.NullInt64
+	// PriceKind is one of the product.PriceKind values.
+	PriceKind    string
+	Currency     string
+	Availability string
+	RawJSON      []byte
+	// RiskScore is not valid until the snapshot was assessed.
+	RiskScore   sql.NullInt64
+	RiskReasons RiskReasons
 }
 
-func ListTrackedProductsForUser(ctx context.Context, db *sql.DB, userID uuid.UUID) ([]ProductWithUrl, error) {
+func ListTrackedProductsForUser(ctx context.Context, db *sql.DB, userID uuid.UUID) (_ []ProductWithUrl, err error) {
+	defer observe("ListTrackedProductsForUser", time.Now(), &err)
+
 	const query = `
 		SELECT id, url
 		FROM products
@@ -93,13 +192,15 @@ func ListTrackedProductsForUser(ctx context.Context, db *sql.DB, userID uuid.UUI
 	return tracked, nil
 }
 
-func TrackAddForUser(ctx context.Context, db *sql.DB, userID uuid.UUID, url string) error {
+func TrackAddForUser(ctx context.Context, db *sql.DB, userID uuid.UUID, url string) (err error) {
+	defer observe("TrackAddForUser", time.Now(), &err)
+
 	const query = `
 		INSERT INTO products (id, user_id, url)
 		VALUES ($1, $2, $3)
 	`
 
-	_, err := db.ExecContext(ctx, query, uuid.New(), userID, url)
+	_, err = db.ExecContext(ctx, query, uuid.New(), userID, url)
 	if err != nil {
 		var pgErr *pq.Error
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
@@ -111,6 +212,9 @@ func TrackAddForUser(ctx context.Context, db *sql.DB, userID uuid.UUID, url stri
 	return nil
 }
 
+// StoreNextAddSnapshot stores a new snapshot of the product and returns its
+// version. Concurrent stores for the same product fail with
+// ErrAlreadyExists.
 func StoreNextAddSnapshot(
 	ctx context.Context,
 	db *sql.DB,
@@ -118,19 +222,34 @@ func StoreNextAddSnapshot(
 	name string,
 	description string,
 	priceSmallUnit int64,
+	highPriceSmallUnit sql.NullInt64,
+	priceKind string,
 	currency string,
 	availability string,
 	rawJSON []byte,
-) error {
+) (_ int, err error) {
+	defer observe("StoreNextAddSnapshot", time.Now(), &err)
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "StoreNextAddSnapshot",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			attribute.String("product.id", productID.String()),
+		),
+	)
+	defer tracing.End(span, &err)
+
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to start transaction: %w", err)
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
 	}
 	defer func() {
 		if err != nil {
 			_ = tx.Rollback()
+			span.AddEvent("rollback")
 		}
 	}()
+	span.AddEvent("begin")
 
 	const selectQuery = `
 		SELECT COALESCE(MAX(version), 0)
@@ -140,10 +259,11 @@ func StoreNextAddSnapshot(
 
 	var currentVersion int
 	if err = tx.QueryRowContext(ctx, selectQuery, productID).Scan(&currentVersion); err != nil {
-		return err
+		return 0, err
 	}
 
 	nextVersion := currentVersion + 1 // first version will be 1
+	span.SetAttributes(attribute.Int("product.version", nextVersion))
 
 	const insertQuery = `
 		INSERT INTO product_versions (
@@ -153,11 +273,13 @@ func StoreNextAddSnapshot(
 			name,
 			description,
 			price_small_unit,
+			high_price_small_unit,
+			price_kind,
 			currency,
 			availability,
 			raw_json
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
 
 	_, err = tx.ExecContext(
@@ -169,6 +291,8 @@ func StoreNextAddSnapshot(
 		name,
 		description,
 		priceSmallUnit,
+		highPriceSmallUnit,
+		priceKind,
 		currency,
 		availability,
 		rawJSON,
@@ -177,12 +301,101 @@ func StoreNextAddSnapshot(
 		var pgErr *pq.Error
 		// optimistic locking concurrency control
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			return ErrAlreadyExists
+			return 0, ErrAlreadyExists
+		}
+		return 0, err
+	}
+
+	// the first snapshot and every price change are lifecycle events
+	const eventQuery = `
+		INSERT INTO product_events (
+			product_id, kind, at, version,
+			price_small_unit, high_price_small_unit, price_kind,
+			previous_price_small_unit, previous_high_price_small_unit, previous_price_kind,
+			currency, availability
+		)
+		SELECT cur.product_id,
+			CASE WHEN prev.version IS NULL THEN 'first_seen' ELSE 'price_change' END,
+			cur.retrieved_at, cur.version,
+			cur.price_small_unit, cur.high_price_small_unit, cur.price_kind,
+			prev.price_small_unit, prev.high_price_small_unit, prev.price_kind,
+			cur.currency, COALESCE(cur.availability, '')
+		FROM product_versions cur
+		LEFT JOIN product_versions prev
+			ON prev.product_id = cur.product_id AND prev.version = cur.version - 1
+		WHERE cur.product_id = $1 AND cur.version = $2
+			AND (
+				prev.version IS NULL
+				OR prev.price_small_unit <> cur.price_small_unit
+				OR prev.high_price_small_unit IS DISTINCT FROM cur.high_price_small_unit
+				OR prev.price_kind <> cur.price_kind
+				OR prev.currency <> cur.currency
+			)
+	`
+
+	if _, err = tx.ExecContext(ctx, eventQuery, productID, nextVersion); err != nil {
+		return 0, fmt.Errorf("failed to record lifecycle event: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	span.AddEvent("commit")
+	return nextVersion, nil
+}
+
+// GetLatestSnapshot returns the newest snapshot of a product, or ErrNotFound
+// if it was never stored.
+func GetLatestSnapshot(ctx context.Context, db *sql.DB, productID uuid.UUID) (_ ProductSnapshot, err error) {
+	defer observe("GetLatestSnapshot", time.Now(), &err)
+
+	const query = `
+		SELECT
+			id,
+			product_id,
+			version,
+			retrieved_at,
+			name,
+			description,
+			price_small_unit,
+			high_price_small_unit,
+			price_kind,
+			currency,
+			availability,
+			raw_json,
+			risk_score,
+			risk_reasons
+		FROM product_versions
+		WHERE product_id = $1
+		ORDER BY version DESC
+		LIMIT 1
+	`
+
+	var snapshot ProductSnapshot
+	err = db.QueryRowContext(ctx, query, productID).Scan(
+		&snapshot.ID,
+		&snapshot.ProductID,
+		&snapshot.Version,
+		&snapshot.RetrievedAt,
+		&snapshot.Name,
+		&snapshot.Description,
+		&snapshot.PriceSmallUnit,
+		&snapshot.HighPriceSmallUnit,
+		&snapshot.PriceKind,
+		&snapshot.Currency,
+		&snapshot.Availability,
+		&snapshot.RawJSON,
+		&snapshot.RiskScore,
+		&snapshot.RiskReasons,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ProductSnapshot{}, ErrNotFound
 		}
-		return err
+		return ProductSnapshot{}, fmt.Errorf("failed to execute query: %w", err)
 	}
 
-	return tx.Commit()
+	return snapshot, nil
 }
 
 func ListAddSnapshotsForUser(
@@ -190,7 +403,9 @@ func ListAddSnapshotsForUser(
 	db *sql.DB,
 	userID uuid.UUID,
 	productID uuid.UUID,
-) ([]ProductSnapshot, error) {
+) (_ []ProductSnapshot, err error) {
+	defer observe("ListAddSnapshotsForUser", time.Now(), &err)
+
 	const query = `
 		SELECT
 			pv.id,
@@ -200,9 +415,13 @@ func ListAddSnapshotsForUser(
 			pv.name,
 			pv.description,
 			pv.price_small_unit,
+			pv.high_price_small_unit,
+			pv.price_kind,
 			pv.currency,
 			pv.availability,
-			pv.raw_json
+			pv.raw_json,
+			pv.risk_score,
+			pv.risk_reasons
 		FROM products p
 		INNER JOIN product_versions pv
 			ON pv.product_id = p.id
@@ -227,9 +446,13 @@ func ListAddSnapshotsForUser(
 			&snapshot.Name,
 			&snapshot.Description,
 			&snapshot.PriceSmallUnit,
+			&snapshot.HighPriceSmallUnit,
+			&snapshot.PriceKind,
 			&snapshot.Currency,
 			&snapshot.Availability,
 			&snapshot.RawJSON,
+			&snapshot.RiskScore,
+			&snapshot.RiskReasons,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
@@ -244,7 +467,9 @@ func ListAddSnapshotsForUser(
 	return snapshots, nil
 }
 
-func GetUserID(ctx context.Context, db *sql.DB, username, password string) (uuid.UUID, error) {
+func GetUserID(ctx context.Context, db *sql.DB, username, password string) (_ uuid.UUID, err error) {
+	defer observe("GetUserID", time.Now(), &err)
+
 	const query = `
 		SELECT id
 		FROM users
@@ -252,7 +477,30 @@ func GetUserID(ctx context.Context, db *sql.DB, username, password string) (uuid
 	`
 
 	var userID uuid.UUID
-	err := db.QueryRowContext(ctx, query, username, password).Scan(&userID)
+	err = db.QueryRowContext(ctx, query, username, password).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, ErrNotFound
+		}
+		return uuid.Nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return userID, nil
+}
+
+// GetUserIDByUsername looks a user up without checking the password. It is
+// meant for the CLI, which already has direct access to the database.
+func GetUserIDByUsername(ctx context.Context, db *sql.DB, username string) (_ uuid.UUID, err error) {
+	defer observe("GetUserIDByUsername", time.Now(), &err)
+
+	const query = `
+		SELECT id
+		FROM users
+		WHERE username = $1
+	`
+
+	var userID uuid.UUID
+	err = db.QueryRowContext(ctx, query, username).Scan(&userID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return uuid.Nil, ErrNotFound
@@ -263,7 +511,8 @@ func GetUserID(ctx context.Context, db *sql.DB, username, password string) (uuid
 	return userID, nil
 }
 
-func NewUser(ctx context.Context, db *sql.DB, username, password string, shouldHash bool) (uuid.UUID, error) {
+func NewUser(ctx context.Context, db *sql.DB, username, password string, shouldHash bool) (_ uuid.UUID, err error) {
+	defer observe("NewUser", time.Now(), &err)
 
 	var passwordHash string
 	if shouldHash {
@@ -283,7 +532,7 @@ func NewUser(ctx context.Context, db *sql.DB, username, password string, shouldH
 	`
 
 	var userID uuid.UUID
-	err := db.QueryRowContext(ctx, query, uuid.New(), username, passwordHash).Scan(&userID)
+	err = db.QueryRowContext(ctx, query, uuid.New(), username, passwordHash).Scan(&userID)
 	if err != nil {
 		var pgErr *pq.Error
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
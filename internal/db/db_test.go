@@ -3,12 +3,16 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/Ozoniuss/olx-tracker/config"
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -37,7 +41,13 @@ func (s *BaseRepositoryTestSuite) SetupSuite() {
 }
 
 func (s *BaseRepositoryTestSuite) AfterTest(suiteName, testName string) {
-	_, err := s.DB.Exec("DELETE FROM product_versions")
+	_, err := s.DB.Exec("DELETE FROM sessions")
+	s.Require().NoError(err)
+
+	_, err = s.DB.Exec("DELETE FROM product_versions")
+	s.Require().NoError(err)
+
+	_, err = s.DB.Exec("DELETE FROM images")
 	s.Require().NoError(err)
 
 	_, err = s.DB.Exec("DELETE FROM products")
@@ -45,6 +55,15 @@ func (s *BaseRepositoryTestSuite) AfterTest(suiteName, testName string) {
 
 	_, err = s.DB.Exec("DELETE FROM users")
 	s.Require().NoError(err)
+
+	_, err = s.DB.Exec("DELETE FROM market_stats")
+	s.Require().NoError(err)
+
+	_, err = s.DB.Exec("DELETE FROM market_keywords")
+	s.Require().NoError(err)
+
+	_, err = s.DB.Exec("DELETE FROM exchange_rates")
+	s.Require().NoError(err)
 }
 
 func (s *BaseRepositoryTestSuite) TearDownSuite() {
@@ -162,19 +181,22 @@ func (s *BaseRepositoryTestSuite) TestStoreAndListAddSnapshotsForUser() {
 		},
 	}
 
-	for _, in := range inputs {
-		err = StoreNextAddSnapshot(
+	for i, in := range inputs {
+		version, err := StoreNextAddSnapshot(
 			ctx,
 			s.DB,
 			productID,
 			in.name,
 			in.description,
 			in.price,
+			sql.NullInt64{},
+			"fixed",
 			in.currency,
 			in.availability,
 			in.rawJSON,
 		)
 		s.Require().NoError(err)
+		s.Equal(i+1, version)
 	}
 
 	snapshots, err := ListAddSnapshotsForUser(ctx, s.DB, userID, productID)
@@ -191,6 +213,8 @@ func (s *BaseRepositoryTestSuite) TestStoreAndListAddSnapshotsForUser() {
 		s.False(snapshot.RetrievedAt.IsZero())
 
 		s.Equal(expected.name, snapshot.Name)
+		s.Equal("fixed", snapshot.PriceKind)
+		s.False(snapshot.HighPriceSmallUnit.Valid)
 		s.Equal(expected.description, snapshot.Description)
 		s.Equal(expected.price, snapshot.PriceSmallUnit)
 		s.Equal(expected.currency, snapshot.Currency)
@@ -199,6 +223,1015 @@ func (s *BaseRepositoryTestSuite) TestStoreAndListAddSnapshotsForUser() {
 	}
 }
 
+func (s *BaseRepositoryTestSuite) TestAuthenticateUserAndSessions() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "session-user", "session-password", true)
+	s.Require().NoError(err)
+
+	authenticatedID, err := AuthenticateUser(ctx, s.DB, "session-user", "session-password")
+	s.Require().NoError(err)
+	s.Equal(userID, authenticatedID)
+
+	_, err = AuthenticateUser(ctx, s.DB, "session-user", "wrong-password")
+	s.ErrorIs(err, ErrNotFound)
+
+	_, err = AuthenticateUser(ctx, s.DB, "missing-user", "session-password")
+	s.ErrorIs(err, ErrNotFound)
+
+	token, err := CreateSession(ctx, s.DB, userID, time.Hour)
+	s.Require().NoError(err)
+	s.NotEmpty(token)
+
+	sessionUserID, err := GetSessionUserID(ctx, s.DB, token)
+	s.Require().NoError(err)
+	s.Equal(userID, sessionUserID)
+
+	err = DeleteSession(ctx, s.DB, token)
+	s.Require().NoError(err)
+
+	_, err = GetSessionUserID(ctx, s.DB, token)
+	s.ErrorIs(err, ErrNotFound)
+
+	expiredToken, err := CreateSession(ctx, s.DB, userID, -time.Minute)
+	s.Require().NoError(err)
+
+	_, err = GetSessionUserID(ctx, s.DB, expiredToken)
+	s.ErrorIs(err, ErrNotFound)
+}
+
+func (s *BaseRepositoryTestSuite) TestListProductSummariesForUser() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "summary-user", "summary-password", false)
+	s.Require().NoError(err)
+
+	err = TrackAddForUser(ctx, s.DB, userID, "https://example.com/summary-fetched")
+	s.Require().NoError(err)
+	err = TrackAddForUser(ctx, s.DB, userID, "https://example.com/summary-never-fetched")
+	s.Require().NoError(err)
+
+	tracked, err := ListTrackedProductsForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	s.Require().Len(tracked, 2)
+	fetched := tracked[1]
+
+	for _, price := range []int64{1000, 1200, 900} {
+		_, err = StoreNextAddSnapshot(ctx, s.DB, fetched.ID, "Summary ad", "", price, sql.NullInt64{}, "fixed", "RON", "in_stock", []byte(`{}`))
+		s.Require().NoError(err)
+	}
+
+	summaries, err := ListProductSummariesForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	s.Require().Len(summaries, 2)
+
+	s.Equal(tracked[0].ID, summaries[0].ID)
+	s.Zero(summaries[0].Versions)
+	s.True(summaries[0].LatestRetrievedAt.IsZero())
+
+	s.Equal(fetched.ID, summaries[1].ID)
+	s.Equal(3, summaries[1].Versions)
+	s.Equal("Summary ad", summaries[1].Name)
+	s.Equal(int64(1000), summaries[1].FirstPriceSmallUnit)
+	s.Equal(int64(900), summaries[1].LatestPriceSmallUnit)
+	s.Equal("fixed", summaries[1].FirstPriceKind)
+	s.Equal("fixed", summaries[1].LatestPriceKind)
+	s.False(summaries[1].LatestHighPriceSmallUnit.Valid)
+	s.Equal("RON", summaries[1].FirstCurrency)
+	s.Equal("RON", summaries[1].Currency)
+
+	product, err := GetTrackedProductForUser(ctx, s.DB, userID, fetched.ID)
+	s.Require().NoError(err)
+	s.Equal(fetched, product)
+
+	_, err = GetTrackedProductForUser(ctx, s.DB, uuid.New(), fetched.ID)
+	s.ErrorIs(err, ErrNotFound)
+
+	all, err := ListAllTrackedProducts(ctx, s.DB)
+	s.Require().NoError(err)
+	s.Len(all, 2)
+}
+
+func (s *BaseRepositoryTestSuite) TestStreamExportRowsForUser() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "export-user", "export-password", false)
+	s.Require().NoError(err)
+
+	err = TrackAddForUser(ctx, s.DB, userID, "https://example.com/export-ad")
+	s.Require().NoError(err)
+	err = TrackAddForUser(ctx, s.DB, userID, "https://example.com/export-never-fetched")
+	s.Require().NoError(err)
+
+	tracked, err := ListTrackedProductsForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	productID := tracked[1].ID
+
+	for _, price := range []int64{1000, 900} {
+		_, err = StoreNextAddSnapshot(ctx, s.DB, productID, "Export ad", "", price, sql.NullInt64{}, "fixed", "RON", "in_stock", []byte(`{"a":1}`))
+		s.Require().NoError(err)
+	}
+
+	for _, includeRawJSON := range []bool{false, true} {
+		var rows []ExportRow
+		err = StreamExportRowsForUser(ctx, s.DB, userID, includeRawJSON, func(row ExportRow) error {
+			rows = append(rows, row)
+			return nil
+		})
+		s.Require().NoError(err)
+		s.Require().Len(rows, 3)
+
+		s.Equal(productID, rows[0].ProductID)
+		s.Equal(1, rows[0].Version)
+		s.Equal(int64(1000), rows[0].PriceSmallUnit)
+		s.Equal("fixed", rows[0].PriceKind)
+		s.Equal(2, rows[1].Version)
+		s.Equal(int64(900), rows[1].PriceSmallUnit)
+		s.Equal(0, rows[2].Version)
+		s.Equal("", rows[2].PriceKind)
+		s.True(rows[2].RetrievedAt.IsZero())
+
+		if includeRawJSON {
+			s.JSONEq(`{"a":1}`, string(rows[0].RawJSON))
+		} else {
+			s.Nil(rows[0].RawJSON)
+		}
+	}
+}
+
+func (s *BaseRepositoryTestSuite) TestTrackAddsForUser() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "import-user", "import-password", false)
+	s.Require().NoError(err)
+	otherID, err := NewUser(ctx, s.DB, "import-other-user", "import-password", false)
+	s.Require().NoError(err)
+
+	err = TrackAddForUser(ctx, s.DB, userID, "https://example.com/import-existing")
+	s.Require().NoError(err)
+	err = TrackAddForUser(ctx, s.DB, otherID, "https://example.com/import-taken")
+	s.Require().NoError(err)
+
+	outcomes, err := TrackAddsForUser(ctx, s.DB, userID, []TrackRequest{
+		{
+			URL:                  "https://example.com/import-new",
+			TargetPriceSmallUnit: sql.NullInt64{Int64: 40000, Valid: true},
+			TargetPriceCurrency:  "RON",
+			Notes:                "cheap",
+		},
+		{URL: "https://example.com/import-existing"},
+		{URL: "https://example.com/import-taken"},
+		{URL: "https://example.com/import-other"},
+	})
+	s.Require().NoError(err)
+	s.Equal([]TrackOutcome{TrackInserted, TrackAlreadyTracked, TrackTrackedByOther, TrackInserted}, outcomes)
+
+	tracked, err := ListTrackedProductsForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	s.Len(tracked, 3)
+
+	for _, p := range tracked {
+		notes, err := GetProductNotesForUser(ctx, s.DB, userID, p.ID)
+		s.Require().NoError(err)
+		if p.URL == "https://example.com/import-new" {
+			s.Equal(ProductNotes{
+				TargetPriceSmallUnit: sql.NullInt64{Int64: 40000, Valid: true},
+				TargetPriceCurrency:  "RON",
+				Notes:                "cheap",
+			}, notes)
+		} else {
+			s.Equal(ProductNotes{}, notes)
+		}
+	}
+
+	_, err = GetProductNotesForUser(ctx, s.DB, otherID, tracked[0].ID)
+	s.ErrorIs(err, ErrNotFound)
+}
+
+func (s *BaseRepositoryTestSuite) TestListProductChangesForUser() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "changes-user", "changes-password", false)
+	s.Require().NoError(err)
+
+	err = TrackAddForUser(ctx, s.DB, userID, "https://example.com/changes-ad")
+	s.Require().NoError(err)
+	err = TrackAddForUser(ctx, s.DB, userID, "https://example.com/changes-other")
+	s.Require().NoError(err)
+
+	tracked, err := ListTrackedProductsForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	productID := tracked[1].ID
+
+	snapshots := []struct {
+		price        int64
+		availability string
+	}{
+		{1000, "in_stock"},
+		{1000, "in_stock"}, // unchanged, not a change
+		{900, "in_stock"},
+		{900, "out_of_stock"},
+	}
+	for _, snap := range snapshots {
+		_, err = StoreNextAddSnapshot(ctx, s.DB, productID, "Changes ad", "", snap.price, sql.NullInt64{}, "fixed", "RON", snap.availability, []byte(`{}`))
+		s.Require().NoError(err)
+	}
+
+	err = MarkProductDeactivated(ctx, s.DB, productID)
+	s.Require().NoError(err)
+
+	changes, err := ListProductChangesForUser(ctx, s.DB, userID, uuid.NullUUID{UUID: productID, Valid: true}, 10)
+	s.Require().NoError(err)
+	s.Require().Len(changes, 4)
+
+	s.Equal(ChangeDeactivated, changes[0].Kind)
+	s.Equal(4, changes[0].Version)
+
+	s.Equal(ChangeAvailability, changes[1].Kind)
+	s.Equal("in_stock", changes[1].PreviousAvailability)
+	s.Equal("out_of_stock", changes[1].Availability)
+
+	s.Equal(ChangePrice, changes[2].Kind)
+	s.Equal(3, changes[2].Version)
+	s.Equal(int64(1000), changes[2].PreviousPriceSmallUnit)
+	s.Equal(int64(900), changes[2].PriceSmallUnit)
+
+	s.Equal(ChangeTracked, changes[3].Kind)
+	s.Equal(1, changes[3].Version)
+
+	limited, err := ListProductChangesForUser(ctx, s.DB, userID, uuid.NullUUID{}, 2)
+	s.Require().NoError(err)
+	s.Len(limited, 2)
+
+	// deactivated products are no longer polled
+	active, err := ListAllTrackedProducts(ctx, s.DB)
+	s.Require().NoError(err)
+	s.Require().Len(active, 1)
+	s.Equal(tracked[0].ID, active[0].ID)
+}
+
+func (s *BaseRepositoryTestSuite) TestListProductChangesPriceKinds() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "price-kinds-user", "price-kinds-password", false)
+	s.Require().NoError(err)
+	err = TrackAddForUser(ctx, s.DB, userID, "https://example.com/price-kinds-ad")
+	s.Require().NoError(err)
+	tracked, err := ListTrackedProductsForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+
+	snapshots := []struct {
+		price int64
+		high  sql.NullInt64
+		kind  string
+	}{
+		{1000, sql.NullInt64{}, "fixed"},
+		{0, sql.NullInt64{}, "on_request"},
+		{800, sql.NullInt64{Int64: 1200, Valid: true}, "range"},
+		{800, sql.NullInt64{Int64: 1100, Valid: true}, "range"},
+		{900, sql.NullInt64{}, "fixed"},
+		{850, sql.NullInt64{}, "fixed"},
+	}
+	for _, snap := range snapshots {
+		_, err = StoreNextAddSnapshot(ctx, s.DB, tracked[0].ID, "Desk", "", snap.price, snap.high, snap.kind, "RON", "in_stock", []byte(`{}`))
+		s.Require().NoError(err)
+	}
+
+	changes, err := ListProductChangesForUser(ctx, s.DB, userID, uuid.NullUUID{}, 10)
+	s.Require().NoError(err)
+	kinds := make([]ChangeKind, len(changes))
+	for i, c := range changes {
+		kinds[i] = c.Kind
+	}
+	// only the last one compares two fixed prices
+	s.Equal([]ChangeKind{ChangePrice, ChangePriceTerms, ChangePriceTerms, ChangePriceTerms, ChangePriceTerms, ChangeTracked}, kinds)
+
+	s.Equal("range", changes[2].PriceKind)
+	s.Equal(int64(1100), changes[2].HighPriceSmallUnit.Int64)
+	s.Equal(int64(1200), changes[2].PreviousHighPriceSmallUnit.Int64)
+	s.Equal("on_request", changes[4].PriceKind)
+	s.Equal("fixed", changes[4].PreviousPriceKind)
+}
+
+func (s *BaseRepositoryTestSuite) TestLatestSnapshotAndProductStatus() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "status-user", "status-password", false)
+	s.Require().NoError(err)
+
+	err = TrackAddForUser(ctx, s.DB, userID, "https://example.com/status-active")
+	s.Require().NoError(err)
+	err = TrackAddForUser(ctx, s.DB, userID, "https://example.com/status-deactivated")
+	s.Require().NoError(err)
+
+	tracked, err := ListTrackedProductsForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	active, deactivated := tracked[1], tracked[0]
+
+	_, err = GetLatestSnapshot(ctx, s.DB, active.ID)
+	s.ErrorIs(err, ErrNotFound)
+
+	for _, price := range []int64{1000, 800} {
+		_, err = StoreNextAddSnapshot(ctx, s.DB, active.ID, "Status ad", "desc", price, sql.NullInt64{}, "fixed", "RON", "in_stock", []byte(`{}`))
+		s.Require().NoError(err)
+	}
+
+	latest, err := GetLatestSnapshot(ctx, s.DB, active.ID)
+	s.Require().NoError(err)
+	s.Equal(2, latest.Version)
+	s.Equal(int64(800), latest.PriceSmallUnit)
+
+	err = MarkProductChecked(ctx, s.DB, active.ID)
+	s.Require().NoError(err)
+	err = MarkProductDeactivated(ctx, s.DB, deactivated.ID)
+	s.Require().NoError(err)
+
+	summaries, err := ListProductSummariesForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	s.True(summaries[0].LastCheckedAt.IsZero())
+	s.False(summaries[1].LastCheckedAt.IsZero())
+
+	counts, err := CountTrackedProductsByStatus(ctx, s.DB)
+	s.Require().NoError(err)
+	s.Equal(map[string]int{"active": 1, "deactivated": 1}, counts)
+}
+
+func (s *BaseRepositoryTestSuite) TestSnapshotImages() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "images-user", "images-password", false)
+	s.Require().NoError(err)
+	otherUserID, err := NewUser(ctx, s.DB, "images-other-user", "images-password", false)
+	s.Require().NoError(err)
+
+	err = TrackAddForUser(ctx, s.DB, userID, "https://example.com/images")
+	s.Require().NoError(err)
+	tracked, err := ListTrackedProductsForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	productID := tracked[0].ID
+
+	err = StoreSnapshotImages(ctx, s.DB, productID, 1, nil)
+	s.ErrorIs(err, ErrNotFound)
+
+	front := Image{Hash: "aa11", ContentType: "image/jpeg", Size: 100}
+	back := Image{Hash: "bb22", ContentType: "image/webp", Size: 200}
+	for version, images := range [][]SnapshotImage{
+		{{Image: front, Position: 0, SourceURL: "https://cdn/front"}},
+		{{Image: back, Position: 0, SourceURL: "https://cdn/back"}, {Image: front, Position: 1, SourceURL: "https://cdn/front"}},
+	} {
+		_, err = StoreNextAddSnapshot(ctx, s.DB, productID, "Images ad", "", 100, sql.NullInt64{}, "fixed", "RON", "in_stock", []byte(`{}`))
+		s.Require().NoError(err)
+		err = StoreSnapshotImages(ctx, s.DB, productID, version+1, images)
+		s.Require().NoError(err)
+	}
+
+	images, err := ListSnapshotImagesForUser(ctx, s.DB, userID, productID, 2)
+	s.Require().NoError(err)
+	s.Require().Len(images, 2)
+	s.Equal(back, images[0].Image)
+	s.Equal("https://cdn/front", images[1].SourceURL)
+
+	images, err = ListSnapshotImagesForUser(ctx, s.DB, otherUserID, productID, 2)
+	s.Require().NoError(err)
+	s.Empty(images)
+
+	archived, err := ListArchivedImages(ctx, s.DB, productID)
+	s.Require().NoError(err)
+	s.Equal(map[string]Image{"https://cdn/front": front, "https://cdn/back": back}, archived)
+
+	img, err := GetImageForUser(ctx, s.DB, userID, front.Hash)
+	s.Require().NoError(err)
+	s.Equal(front, img)
+
+	_, err = GetImageForUser(ctx, s.DB, otherUserID, front.Hash)
+	s.ErrorIs(err, ErrNotFound)
+}
+
+func (s *BaseRepositoryTestSuite) TestReposts() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "repost-user", "repost-password", false)
+	s.Require().NoError(err)
+	for _, url := range []string{"https://example.com/repost-1", "https://example.com/repost-2", "https://example.com/repost-3"} {
+		err = TrackAddForUser(ctx, s.DB, userID, url)
+		s.Require().NoError(err)
+	}
+	tracked, err := ListTrackedProductsForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	// newest first
+	third, second, first := tracked[0], tracked[1], tracked[2]
+
+	fp := ProductFingerprint{ProductID: first.ID, ImageHashes: []int64{-1, 42}, Shingles: []int64{7}, Location: "Iasi"}
+	s.Require().NoError(StoreFingerprint(ctx, s.DB, fp))
+	s.Require().NoError(StoreFingerprint(ctx, s.DB, ProductFingerprint{ProductID: second.ID}))
+
+	stored := fp
+	stored.ImageURLs = []string{"https://example.com/1.jpg", "https://example.com/2.jpg"}
+	s.Require().NoError(StoreFingerprint(ctx, s.DB, stored))
+	got, err := GetFingerprint(ctx, s.DB, first.ID)
+	s.Require().NoError(err)
+	s.Equal(stored, got)
+	_, err = GetFingerprint(ctx, s.DB, third.ID)
+	s.ErrorIs(err, ErrNotFound)
+
+	// only deactivated products are candidates
+	candidates, err := ListRepostCandidates(ctx, s.DB, third.ID)
+	s.Require().NoError(err)
+	s.Empty(candidates)
+
+	s.Require().NoError(MarkProductDeactivated(ctx, s.DB, first.ID))
+	candidates, err = ListRepostCandidates(ctx, s.DB, second.ID)
+	s.Require().NoError(err)
+	s.Equal([]ProductFingerprint{fp}, candidates)
+
+	s.Require().NoError(LinkRepost(ctx, s.DB, second.ID, first.ID))
+	s.ErrorIs(LinkRepost(ctx, s.DB, third.ID, first.ID), ErrAlreadyExists)
+
+	// a continued product is no longer a candidate
+	candidates, err = ListRepostCandidates(ctx, s.DB, third.ID)
+	s.Require().NoError(err)
+	s.Empty(candidates)
+
+	s.Require().NoError(MarkProductDeactivated(ctx, s.DB, second.ID))
+	s.Require().NoError(LinkRepost(ctx, s.DB, third.ID, second.ID))
+
+	chain, err := ListRepostChainForUser(ctx, s.DB, userID, third.ID)
+	s.Require().NoError(err)
+	s.Equal([]ProductWithUrl{second, first}, chain)
+}
+
+func (s *BaseRepositoryTestSuite) TestSnapshotRisk() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "risk-user", "risk-password", false)
+	s.Require().NoError(err)
+	var ids []uuid.UUID
+	for i, price := range []int64{1000, 2000, 3000, 50000} {
+		err = TrackAddForUser(ctx, s.DB, userID, fmt.Sprintf("https://example.com/risk-%d", i))
+		s.Require().NoError(err)
+		tracked, err := ListTrackedProductsForUser(ctx, s.DB, userID)
+		s.Require().NoError(err)
+		id := tracked[0].ID
+		ids = append(ids, id)
+
+		_, err = StoreNextAddSnapshot(ctx, s.DB, id, "Risk ad", "", price, sql.NullInt64{}, "fixed", "RON", "in_stock", []byte(`{"category":"https://www.olx.ro/phones/"}`))
+		s.Require().NoError(err)
+		err = StoreFingerprint(ctx, s.DB, ProductFingerprint{ProductID: id, ImageHashes: []int64{int64(i), 99}, Seller: fmt.Sprintf("seller-%d", i)})
+		s.Require().NoError(err)
+	}
+
+	median, ads, err := GetCategoryPriceMedian(ctx, s.DB, ids[0], "https://www.olx.ro/phones/", "RON")
+	s.Require().NoError(err)
+	s.Equal(3, ads)
+	s.Equal(int64(3000), median)
+
+	_, ads, err = GetCategoryPriceMedian(ctx, s.DB, ids[0], "https://www.olx.ro/phones/", "EUR")
+	s.Require().NoError(err)
+	s.Zero(ads)
+
+	// every ad shares the image hashed as 99
+	reuse, err := CountImageReuse(ctx, s.DB, ids[0])
+	s.Require().NoError(err)
+	s.Equal(3, reuse)
+
+	latest, err := GetLatestSnapshot(ctx, s.DB, ids[0])
+	s.Require().NoError(err)
+	s.False(latest.RiskScore.Valid)
+	s.Empty(latest.RiskReasons)
+
+	reasons := RiskReasons{{Code: "reused_images", Detail: "images also show up in 3 ads", Points: 30}}
+	s.Require().NoError(SetSnapshotRisk(ctx, s.DB, ids[0], 1, 30, reasons))
+	s.ErrorIs(SetSnapshotRisk(ctx, s.DB, ids[0], 2, 30, reasons), ErrNotFound)
+
+	latest, err = GetLatestSnapshot(ctx, s.DB, ids[0])
+	s.Require().NoError(err)
+	s.Equal(int64(30), latest.RiskScore.Int64)
+	s.Equal(reasons, latest.RiskReasons)
+
+	changes, err := ListProductChangesForUser(ctx, s.DB, userID, uuid.NullUUID{UUID: ids[0], Valid: true}, 10)
+	s.Require().NoError(err)
+	s.Require().Len(changes, 1)
+	s.Equal(30, changes[0].RiskScore)
+	s.Equal(reasons, changes[0].RiskReasons)
+}
+
+func (s *BaseRepositoryTestSuite) TestMarketStats() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "market-user", "market-password", false)
+	s.Require().NoError(err)
+
+	names := []string{"iPhone 13 Pro", "Iphone-13 mini", "Samsung S21", "iPhone 130"}
+	for i, price := range []int64{3000, 1000, 2000, 4000} {
+		err = TrackAddForUser(ctx, s.DB, userID, fmt.Sprintf("https://example.com/market-%d", i))
+		s.Require().NoError(err)
+		tracked, err := ListTrackedProductsForUser(ctx, s.DB, userID)
+		s.Require().NoError(err)
+
+		_, err = StoreNextAddSnapshot(ctx, s.DB, tracked[0].ID, names[i], "", price, sql.NullInt64{}, "fixed", "RON", "in_stock", []byte(`{"category":"https://www.olx.ro/phones/"}`))
+		s.Require().NoError(err)
+	}
+
+	s.Require().NoError(AddMarketKeyword(ctx, s.DB, "iphone 13"))
+	s.ErrorIs(AddMarketKeyword(ctx, s.DB, "iphone 13"), ErrAlreadyExists)
+
+	s.Require().NoError(RefreshMarketStats(ctx, s.DB))
+	// refreshing again replaces the stats of today
+	s.Require().NoError(RefreshMarketStats(ctx, s.DB))
+
+	stat, err := GetLatestMarketStat(ctx, s.DB, MarketCategory, "https://www.olx.ro/phones/", "RON")
+	s.Require().NoError(err)
+	s.Equal(4, stat.Listings)
+	s.Equal(int64(1000), stat.MinSmallUnit)
+	s.Equal(int64(2000), stat.MedianSmallUnit)
+	s.Equal(int64(4000), stat.MaxSmallUnit)
+
+	stats, err := ListMarketStats(ctx, s.DB, MarketKeyword, "iphone 13", "RON", time.Now().AddDate(0, 0, -7))
+	s.Require().NoError(err)
+	s.Require().Len(stats, 1)
+	s.Equal(2, stats[0].Listings)
+	s.Equal(int64(1000), stats[0].MedianSmallUnit)
+
+	_, err = GetLatestMarketStat(ctx, s.DB, MarketCategory, "https://www.olx.ro/phones/", "EUR")
+	s.ErrorIs(err, ErrNotFound)
+
+	keywords, err := ListMarketKeywords(ctx, s.DB)
+	s.Require().NoError(err)
+	s.Equal([]string{"iphone 13"}, keywords)
+
+	s.Require().NoError(RemoveMarketKeyword(ctx, s.DB, "iphone 13"))
+	s.ErrorIs(RemoveMarketKeyword(ctx, s.DB, "iphone 13"), ErrNotFound)
+	_, err = GetLatestMarketStat(ctx, s.DB, MarketKeyword, "iphone 13", "RON")
+	s.ErrorIs(err, ErrNotFound)
+}
+
+func (s *BaseRepositoryTestSuite) TestSellThrough() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "sell-through-user", "sell-through-password", false)
+	s.Require().NoError(err)
+
+	ads := []struct {
+		prices       []int64
+		kind         string
+		availability string
+		deactivated  bool
+	}{
+		{[]int64{1000, 900, 800}, "fixed", "https://schema.org/InStock", true},
+		{[]int64{2000}, "fixed", "https://schema.org/InStock", true},
+		{[]int64{3000}, "fixed", "https://schema.org/OutOfStock", true},
+		{[]int64{4000, 4500}, "fixed", "https://schema.org/InStock", false},
+		// sold, but without a price to band it by
+		{[]int64{0}, "on_request", "https://schema.org/InStock", true},
+	}
+	for i, ad := range ads {
+		err = TrackAddForUser(ctx, s.DB, userID, fmt.Sprintf("https://example.com/sell-through-%d", i))
+		s.Require().NoError(err)
+		tracked, err := ListTrackedProductsForUser(ctx, s.DB, userID)
+		s.Require().NoError(err)
+		id := tracked[0].ID
+
+		for _, price := range ad.prices {
+			_, err = StoreNextAddSnapshot(ctx, s.DB, id, "Desk", "", price, sql.NullInt64{}, ad.kind, "RON", ad.availability, []byte(`{"category":"https://www.olx.ro/desks/"}`))
+			s.Require().NoError(err)
+		}
+		if ad.deactivated {
+			s.Require().NoError(MarkProductDeactivated(ctx, s.DB, id))
+			// only the first deactivation is recorded
+			s.Require().NoError(MarkProductDeactivated(ctx, s.DB, id))
+		}
+
+		events, err := ListProductEventsForUser(ctx, s.DB, userID, id)
+		s.Require().NoError(err)
+		want := len(ad.prices)
+		if ad.deactivated {
+			want += 2
+		}
+		s.Len(events, want)
+	}
+
+	reports, err := ListSellThrough(ctx, s.DB, "", time.Time{})
+	s.Require().NoError(err)
+	s.Require().Len(reports, 1)
+	r := reports[0]
+	s.Equal("https://www.olx.ro/desks/", r.Category)
+	s.Equal(1, r.Active)
+	s.Equal(3, r.Sold)
+	s.Equal(1, r.Withdrawn)
+	s.InDelta(1.0/3, r.AvgPriceCuts, 1e-9)
+	s.Equal(int64(800), r.MedianFinalPriceSmallUnit)
+	s.Equal(int64(1000), r.MedianFirstPriceSmallUnit)
+	s.Require().Len(r.Bands, 2)
+	s.Equal(int64(800), r.Bands[0].MinPriceSmallUnit)
+	s.Equal(int64(2000), r.Bands[1].MaxPriceSmallUnit)
+
+	reports, err = ListSellThrough(ctx, s.DB, "https://www.olx.ro/chairs/", time.Time{})
+	s.Require().NoError(err)
+	s.Empty(reports)
+}
+
+func (s *BaseRepositoryTestSuite) TestSearchProductsForUser() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "search-user", "search-password", false)
+	s.Require().NoError(err)
+	otherID, err := NewUser(ctx, s.DB, "search-other", "search-password", false)
+	s.Require().NoError(err)
+
+	snapshots := []struct {
+		userID      uuid.UUID
+		url         string
+		name        string
+		description string
+	}{
+		{userID, "https://example.com/search-mouse", "Mouse Logitech G Pro X Superlight", "Garanția e valabilă încă un an."},
+		{userID, "https://example.com/search-mouse", "Mouse Logitech G Pro X Superlight", "Vândut fără cutie."},
+		{userID, "https://example.com/search-keyboard", "Tastatura mecanica", "Are garantie 2 ani, cutie originala."},
+		{otherID, "https://example.com/search-other", "Mouse Superlight", "Garantie."},
+	}
+	for _, snap := range snapshots {
+		err = TrackAddForUser(ctx, s.DB, snap.userID, snap.url)
+		if !errors.Is(err, ErrAlreadyExists) {
+			s.Require().NoError(err)
+		}
+		tracked, err := ListTrackedProductsForUser(ctx, s.DB, snap.userID)
+		s.Require().NoError(err)
+		var id uuid.UUID
+		for _, p := range tracked {
+			if p.URL == snap.url {
+				id = p.ID
+			}
+		}
+
+		_, err = StoreNextAddSnapshot(ctx, s.DB, id, snap.name, snap.description, 100, sql.NullInt64{}, "fixed", "RON", "in_stock", []byte(`{}`))
+		s.Require().NoError(err)
+	}
+
+	results, err := SearchProductsForUser(ctx, s.DB, userID, "superlight", 10)
+	s.Require().NoError(err)
+	s.Require().Len(results, 1)
+	s.Equal("https://example.com/search-mouse", results[0].URL)
+	s.Equal(2, results[0].MatchingVersions)
+	s.Equal("fixed", results[0].PriceKind)
+	s.False(results[0].HighPriceSmallUnit.Valid)
+	s.Contains(results[0].NameHighlight, HighlightStart+"Superlight"+HighlightEnd)
+
+	// stems and diacritics don't matter, and the history is searched too
+	results, err = SearchProductsForUser(ctx, s.DB, userID, "garantie", 10)
+	s.Require().NoError(err)
+	s.Require().Len(results, 2)
+	for _, r := range results {
+		s.Contains(r.DescriptionHighlight, HighlightStart)
+	}
+
+	results, err = SearchProductsForUser(ctx, s.DB, userID, "garantie -tastatura", 10)
+	s.Require().NoError(err)
+	s.Require().Len(results, 1)
+	s.Equal("https://example.com/search-mouse", results[0].URL)
+	s.Equal(1, results[0].Version)
+}
+
+func (s *BaseRepositoryTestSuite) TestWatchRules() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "watch-user", "watch-password", false)
+	s.Require().NoError(err)
+	otherID, err := NewUser(ctx, s.DB, "watch-other", "watch-password", false)
+	s.Require().NoError(err)
+
+	rule := WatchRule{
+		UserID:   userID,
+		Name:     "cheap mice",
+		Keywords: "superlight -defect",
+		MaxPrice: sql.NullInt64{Int64: 50000, Valid: true},
+		Currency: "RON",
+	}
+	ruleID, err := CreateWatchRule(ctx, s.DB, rule)
+	s.Require().NoError(err)
+
+	_, err = CreateWatchRule(ctx, s.DB, rule)
+	s.Require().ErrorIs(err, ErrAlreadyExists)
+
+	rule.UserID = otherID
+	otherRuleID, err := CreateWatchRule(ctx, s.DB, rule)
+	s.Require().NoError(err, "names only need to be unique per user")
+
+	rules, err := ListWatchRulesForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	s.Require().Len(rules, 1)
+	s.Equal(ruleID, rules[0].ID)
+	s.Equal("superlight -defect", rules[0].Keywords)
+	s.False(rules[0].MinPrice.Valid)
+	s.Equal(int64(50000), rules[0].MaxPrice.Int64)
+
+	all, err := ListAllWatchRules(ctx, s.DB)
+	s.Require().NoError(err)
+	s.Len(all, 2)
+
+	// the matched ad is tracked by the other user
+	err = TrackAddForUser(ctx, s.DB, otherID, "https://example.com/watch-mouse")
+	s.Require().NoError(err)
+	tracked, err := ListTrackedProductsForUser(ctx, s.DB, otherID)
+	s.Require().NoError(err)
+	s.Require().Len(tracked, 1)
+	productID := tracked[0].ID
+
+	_, err = StoreNextAddSnapshot(ctx, s.DB, productID, "Mouse Superlight", "", 45000, sql.NullInt64{}, "fixed", "RON", "in_stock", []byte(`{}`))
+	s.Require().NoError(err)
+
+	recorded, err := RecordWatchMatch(ctx, s.DB, ruleID, productID, 1)
+	s.Require().NoError(err)
+	s.True(recorded)
+	recorded, err = RecordWatchMatch(ctx, s.DB, ruleID, productID, 1)
+	s.Require().NoError(err)
+	s.False(recorded, "a product matches a rule only once")
+	recorded, err = RecordWatchMatch(ctx, s.DB, otherRuleID, productID, 1)
+	s.Require().NoError(err)
+	s.False(recorded, "the own products of a user don't match their rules")
+
+	matches, err := ListWatchMatchesForUser(ctx, s.DB, userID, 10)
+	s.Require().NoError(err)
+	s.Require().Len(matches, 1)
+	s.Equal(ChangeWatchMatch, matches[0].Kind)
+	s.Equal(ruleID, matches[0].WatchRuleID)
+	s.Equal("cheap mice", matches[0].WatchRule)
+	s.Equal(productID, matches[0].ProductID)
+	s.Equal("Mouse Superlight", matches[0].Name)
+	s.Equal(int64(45000), matches[0].PriceSmallUnit)
+
+	matches, err = ListWatchMatchesForUser(ctx, s.DB, otherID, 10)
+	s.Require().NoError(err)
+	s.Empty(matches)
+
+	s.Require().ErrorIs(DeleteWatchRuleForUser(ctx, s.DB, otherID, ruleID), ErrNotFound)
+	s.Require().NoError(DeleteWatchRuleForUser(ctx, s.DB, userID, ruleID))
+	s.Require().ErrorIs(DeleteWatchRuleForUser(ctx, s.DB, userID, ruleID), ErrNotFound)
+
+	matches, err = ListWatchMatchesForUser(ctx, s.DB, userID, 10)
+	s.Require().NoError(err)
+	s.Empty(matches)
+}
+
+func (s *BaseRepositoryTestSuite) TestExchangeRates() {
+	ctx := context.Background()
+	day := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+
+	err := StoreExchangeRates(ctx, s.DB, "ecb", []ExchangeRate{
+		{Currency: "EUR", Quote: "USD", Day: day, Rate: "1.1650"},
+		{Currency: "EUR", Quote: "RON", Day: day, Rate: "5.0850"},
+		{Currency: "EUR", Quote: "RON", Day: day.AddDate(0, 0, -1), Rate: "5.0800"},
+	})
+	s.Require().NoError(err)
+
+	// importing the same day again replaces its rates
+	err = StoreExchangeRates(ctx, s.DB, "ecb", []ExchangeRate{
+		{Currency: "EUR", Quote: "RON", Day: day, Rate: "5.0862"},
+	})
+	s.Require().NoError(err)
+
+	rates, err := ListExchangeRates(ctx, s.DB)
+	s.Require().NoError(err)
+	s.Require().Len(rates, 3)
+	s.Equal("RON", rates[0].Quote)
+	s.True(day.AddDate(0, 0, -1).Equal(rates[0].Day))
+	s.Equal("5.0800", rates[0].Rate)
+	s.Equal("5.0862", rates[1].Rate)
+	s.Equal("USD", rates[2].Quote)
+}
+
+func (s *BaseRepositoryTestSuite) TestUserPreferences() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "prefs-user", "prefs-password", false)
+	s.Require().NoError(err)
+	otherID, err := NewUser(ctx, s.DB, "prefs-other", "prefs-password", false)
+	s.Require().NoError(err)
+
+	prefs, err := GetUserPreferences(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	s.Equal(UserPreferences{}, prefs, "users without preferences get the defaults")
+
+	_, err = GetUserPreferences(ctx, s.DB, uuid.New())
+	s.Require().ErrorIs(err, ErrNotFound)
+
+	want := UserPreferences{
+		Currency:     "EUR",
+		Timezone:     "Europe/Bucharest",
+		Locale:       "ro",
+		PollInterval: 6 * time.Hour,
+		QuietStart:   sql.NullInt16{Int16: 22 * 60, Valid: true},
+		QuietEnd:     sql.NullInt16{Int16: 7 * 60, Valid: true},
+		Email:        "prefs@example.com",
+		Digest:       "daily",
+	}
+	s.Require().NoError(SetUserPreferences(ctx, s.DB, userID, want))
+	prefs, err = GetUserPreferences(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	s.Equal(want, prefs)
+
+	// products of users with a poll interval are only due once it passed
+	s.Require().NoError(TrackAddForUser(ctx, s.DB, userID, "https://example.com/prefs-mouse"))
+	s.Require().NoError(TrackAddForUser(ctx, s.DB, otherID, "https://example.com/prefs-keyboard"))
+	due, err := ListTrackedProductsDueForPoll(ctx, s.DB)
+	s.Require().NoError(err)
+	s.Require().Len(due, 2, "products that were never checked are due")
+
+	for _, p := range due {
+		s.Require().NoError(MarkProductChecked(ctx, s.DB, p.ID))
+	}
+	due, err = ListTrackedProductsDueForPoll(ctx, s.DB)
+	s.Require().NoError(err)
+	s.Require().Len(due, 1)
+	s.Equal("https://example.com/prefs-keyboard", due[0].URL)
+
+	// replacing the preferences resets the omitted ones
+	s.Require().NoError(SetUserPreferences(ctx, s.DB, userID, UserPreferences{Currency: "USD"}))
+	prefs, err = GetUserPreferences(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	s.Equal(UserPreferences{Currency: "USD"}, prefs)
+
+	due, err = ListTrackedProductsDueForPoll(ctx, s.DB)
+	s.Require().NoError(err)
+	s.Len(due, 2)
+}
+
+func (s *BaseRepositoryTestSuite) TestDigests() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "digest-user", "digest-password", false)
+	s.Require().NoError(err)
+	_, err = NewUser(ctx, s.DB, "digest-other", "digest-password", false)
+	s.Require().NoError(err)
+
+	s.Require().NoError(SetUserPreferences(ctx, s.DB, userID, UserPreferences{Email: "digest@example.com", Digest: "daily"}))
+	subscribers, err := ListDigestSubscribers(ctx, s.DB)
+	s.Require().NoError(err)
+	s.Equal([]uuid.UUID{userID}, subscribers)
+
+	_, err = GetLastDigestEnd(ctx, s.DB, userID)
+	s.Require().ErrorIs(err, ErrNotFound)
+
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	period := DigestPeriod{UserID: userID, Frequency: "daily", Start: start, End: start.AddDate(0, 0, 1)}
+
+	claimed, err := ClaimDigest(ctx, s.DB, period)
+	s.Require().NoError(err)
+	s.True(claimed)
+	claimed, err = ClaimDigest(ctx, s.DB, period)
+	s.Require().NoError(err)
+	s.False(claimed, "a digest that is being sent can't be claimed again")
+
+	// failed digests are claimed again, sent ones never
+	s.Require().NoError(FinishDigest(ctx, s.DB, period, DigestFailed, "connection refused"))
+	_, err = GetLastDigestEnd(ctx, s.DB, userID)
+	s.Require().ErrorIs(err, ErrNotFound, "failed digests don't count")
+	claimed, err = ClaimDigest(ctx, s.DB, period)
+	s.Require().NoError(err)
+	s.True(claimed)
+	s.Require().NoError(FinishDigest(ctx, s.DB, period, DigestSent, ""))
+	claimed, err = ClaimDigest(ctx, s.DB, period)
+	s.Require().NoError(err)
+	s.False(claimed)
+
+	end, err := GetLastDigestEnd(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	s.True(period.End.Equal(end))
+
+	unknown := period
+	unknown.Start = start.AddDate(0, 0, -1)
+	s.Require().ErrorIs(FinishDigest(ctx, s.DB, unknown, DigestSent, ""), ErrNotFound)
+
+	// the changes of a digest are those in its period
+	s.Require().NoError(TrackAddForUser(ctx, s.DB, userID, "https://example.com/digest-mouse"))
+	tracked, err := ListTrackedProductsForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	s.Require().Len(tracked, 1)
+	_, err = StoreNextAddSnapshot(ctx, s.DB, tracked[0].ID, "Mouse", "", 50000, sql.NullInt64{}, "fixed", "RON", "in_stock", []byte(`{}`))
+	s.Require().NoError(err)
+	_, err = StoreNextAddSnapshot(ctx, s.DB, tracked[0].ID, "Mouse", "", 45000, sql.NullInt64{}, "fixed", "RON", "in_stock", []byte(`{}`))
+	s.Require().NoError(err)
+
+	now := time.Now()
+	changes, err := ListProductChangesForUserBetween(ctx, s.DB, userID, now.Add(-time.Hour), now.Add(time.Hour))
+	s.Require().NoError(err)
+	s.Require().Len(changes, 2)
+	s.Equal(ChangePrice, changes[0].Kind)
+	s.Equal(int64(50000), changes[0].PreviousPriceSmallUnit)
+
+	changes, err = ListProductChangesForUserBetween(ctx, s.DB, userID, period.Start, period.End)
+	s.Require().NoError(err)
+	s.Empty(changes)
+
+	matches, err := ListWatchMatchesForUserBetween(ctx, s.DB, userID, now.Add(-time.Hour), now.Add(time.Hour))
+	s.Require().NoError(err)
+	s.Empty(matches)
+}
+
+func (s *BaseRepositoryTestSuite) TestGetMigrationVersion() {
+	version, dirty, err := GetMigrationVersion(context.Background(), s.DB)
+	s.Require().NoError(err)
+	s.NotZero(version)
+	s.False(dirty)
+}
+
+func TestGetPostgresURL(t *testing.T) {
+	cfg := config.PostgresConfig{
+		User:             "olx tracker",
+		Password:         "p@ss:w/rd?#",
+		Host:             "db.internal",
+		Port:             5432,
+		Database:         "olxtracker",
+		Schema:           "olxtracker",
+		SSLMode:          "verify-full",
+		SSLRootCert:      "/etc/ssl/rds.pem",
+		SSLCert:          "/etc/ssl/client.pem",
+		SSLKey:           "/etc/ssl/client.key",
+		ApplicationName:  "olx-tracker",
+		StatementTimeout: 15 * time.Second,
+	}
+
+	u, err := url.Parse(GetPostgresURL(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _ := u.User.Password()
+	if u.User.Username() != cfg.User || password != cfg.Password {
+		t.Errorf("got credentials %q/%q", u.User.Username(), password)
+	}
+	if u.Host != "db.internal:5432" || u.Path != "/olxtracker" {
+		t.Errorf("got host %q and path %q", u.Host, u.Path)
+	}
+	query := u.Query()
+	if query.Get("sslmode") != "verify-full" || query.Get("sslrootcert") != "/etc/ssl/rds.pem" || query.Get("search_path") != "olxtracker" {
+		t.Errorf("got query %v", query)
+	}
+	if query.Get("sslcert") != cfg.SSLCert || query.Get("sslkey") != cfg.SSLKey {
+		t.Errorf("got client cert %q and key %q", query.Get("sslcert"), query.Get("sslkey"))
+	}
+	if query.Get("application_name") != "olx-tracker" || query.Get("statement_timeout") != "15000" {
+		t.Errorf("got query %v", query)
+	}
+}
+
+func TestConnectToPostgresGivesUp(t *testing.T) {
+	cfg := config.Default().Postgres
+	// nothing listens on port 1
+	cfg.Port = 1
+	cfg.ConnectTimeout = 600 * time.Millisecond
+
+	start := time.Now()
+	_, err := ConnectToPostgres(context.Background(), cfg)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed < cfg.ConnectTimeout || elapsed > 5*time.Second {
+		t.Errorf("gave up after %s, want about %s", elapsed, cfg.ConnectTimeout)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error hides the connection failure: %v", err)
+	}
+}
+
+func TestPermanentConnectError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		// invalid_password
+		{&pq.Error{Code: "28P01"}, true},
+		// invalid_catalog_name
+		{fmt.Errorf("ping: %w", &pq.Error{Code: "3D000"}), true},
+		// cannot_connect_now, the server is starting up
+		{&pq.Error{Code: "57P03"}, false},
+		{errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := permanentConnectError(tt.err); got != tt.want {
+			t.Errorf("permanentConnectError(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	want := []time.Duration{
+		250 * time.Millisecond,
+		500 * time.Millisecond,
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		5 * time.Second,
+		5 * time.Second,
+	}
+	for attempt, d := range want {
+		if got := retryDelay(attempt); got != d {
+			t.Errorf("retryDelay(%d) = %s, want %s", attempt, got, d)
+		}
+	}
+	if got := retryDelay(100); got != 5*time.Second {
+		t.Errorf("retryDelay(100) = %s, want the limit", got)
+	}
+}
+
 func testDatabaseURL() string {
 	if databaseURL := os.Getenv("TEST_DATABASE_URL"); databaseURL != "" {
 		return databaseURL
@@ -228,3 +1261,32 @@ func getenvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func (s *BaseRepositoryTestSuite) TestPriceKindChangeEvents() {
+	ctx := context.Background()
+
+	userID, err := NewUser(ctx, s.DB, "price-kind-events-user", "price-kind-events-password", false)
+	s.Require().NoError(err)
+	s.Require().NoError(TrackAddForUser(ctx, s.DB, userID, "https://example.com/price-kind-events"))
+	tracked, err := ListTrackedProductsForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	id := tracked[0].ID
+
+	_, err = StoreNextAddSnapshot(ctx, s.DB, id, "Desk", "", 1000, sql.NullInt64{}, "fixed", "RON", "in_stock", []byte(`{}`))
+	s.Require().NoError(err)
+	// the same amount, now the low end of a range
+	_, err = StoreNextAddSnapshot(ctx, s.DB, id, "Desk", "", 1000, sql.NullInt64{Int64: 1500, Valid: true}, "range", "RON", "in_stock", []byte(`{}`))
+	s.Require().NoError(err)
+	_, err = StoreNextAddSnapshot(ctx, s.DB, id, "Desk", "", 1000, sql.NullInt64{Int64: 1500, Valid: true}, "range", "RON", "in_stock", []byte(`{}`))
+	s.Require().NoError(err)
+
+	events, err := ListProductEventsForUser(ctx, s.DB, userID, id)
+	s.Require().NoError(err)
+	s.Require().Len(events, 2)
+	e := events[1]
+	s.Equal(EventPriceChange, e.Kind)
+	s.Equal("range", e.PriceKind)
+	s.Equal(sql.NullInt64{Int64: 1500, Valid: true}, e.HighPriceSmallUnit)
+	s.Equal(sql.NullString{String: "fixed", Valid: true}, e.PreviousPriceKind)
+	s.False(e.PreviousHighPriceSmallUnit.Valid)
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DigestStatus string
+
+const (
+	// DigestSending is a claimed digest that is being sent, or whose sender
+	// stopped before it knew whether it was sent.
+	DigestSending DigestStatus = "sending"
+	DigestSent    DigestStatus = "sent"
+	// DigestFailed digests are claimed again by the next attempt.
+	DigestFailed DigestStatus = "failed"
+	// DigestSkipped digests had no changes to send.
+	DigestSkipped DigestStatus = "skipped"
+)
+
+// DigestPeriod identifies the digest of a user for a period, e.g. a day in
+// the time zone of the user.
+type DigestPeriod struct {
+	UserID    uuid.UUID
+	Frequency string
+	Start     time.Time
+	End       time.Time
+}
+
+// ListDigestSubscribers returns the users who opted in to digests.
+func ListDigestSubscribers(ctx context.Context, db *sql.DB) (_ []uuid.UUID, err error) {
+	defer observe("ListDigestSubscribers", time.Now(), &err)
+
+	const query = `
+		SELECT user_id
+		FROM user_preferences
+		WHERE digest <> ''
+		ORDER BY user_id
+	`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var users []uuid.UUID
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		users = append(users, userID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return users, nil
+}
+
+// GetLastDigestEnd returns the end of the period of the last digest that was
+// sent or skipped for a user, of any frequency. It returns ErrNotFound if
+// there was none yet.
+func GetLastDigestEnd(ctx context.Context, db *sql.DB, userID uuid.UUID) (_ time.Time, err error) {
+	defer observe("GetLastDigestEnd", time.Now(), &err)
+
+	const query = `
+		SELECT max(period_end)
+		FROM digests
+		WHERE user_id = $1 AND status IN ('sent', 'skipped')
+	`
+
+	var end sql.NullTime
+	if err := db.QueryRowContext(ctx, query, userID).Scan(&end); err != nil {
+		return time.Time{}, fmt.Errorf("failed to execute query: %w", err)
+	}
+	if !end.Valid {
+		return time.Time{}, ErrNotFound
+	}
+	return end.Time, nil
+}
+
+// ClaimDigest records that the digest of a period is about to be sent. It
+// returns false if it was claimed before and didn't fail, so a digest is
+// sent at most once even across restarts and concurrent senders.
+func ClaimDigest(ctx context.Context, db *sql.DB, p DigestPeriod) (_ bool, err error) {
+	defer observe("ClaimDigest", time.Now(), &err)
+
+	const query = `
+		INSERT INTO digests (user_id, frequency, period_start, period_end, status)
+		VALUES ($1, $2, $3, $4, 'sending')
+		ON CONFLICT (user_id, frequency, period_start) DO UPDATE
+		SET status = 'sending',
+			attempts = digests.attempts + 1,
+			error = '',
+			updated_at = now()
+		WHERE digests.status = 'failed'
+		RETURNING true
+	`
+
+	var claimed bool
+	err = db.QueryRowContext(ctx, query, p.UserID, p.Frequency, p.Start, p.End).Scan(&claimed)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to execute query: %w", err)
+	}
+	return claimed, nil
+}
+
+// FinishDigest records the outcome of a claimed digest, with the error that
+// made it fail if any.
+func FinishDigest(ctx context.Context, db *sql.DB, p DigestPeriod, status DigestStatus, failure string) (err error) {
+	defer observe("FinishDigest", time.Now(), &err)
+
+	const query = `
+		UPDATE digests
+		SET status = $4, error = $5, updated_at = now()
+		WHERE user_id = $1 AND frequency = $2 AND period_start = $3
+	`
+
+	res, err := db.ExecContext(ctx, query, p.UserID, p.Frequency, p.Start, status, failure)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
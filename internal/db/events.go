@@ -0,0 +1,272 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EventKind string
+
+const (
+	EventFirstSeen   EventKind = "first_seen"
+	EventPriceChange EventKind = "price_change"
+	// EventLastSeen is when the ad was last fetched successfully before it
+	// was deactivated.
+	EventLastSeen    EventKind = "last_seen"
+	EventDeactivated EventKind = "deactivated"
+)
+
+// ProductEvent is a step in the lifecycle of an ad. The snapshot fields are
+// those of the snapshot the event was recorded from, which for EventLastSeen
+// and EventDeactivated is the latest one.
+type ProductEvent struct {
+	Kind    EventKind
+	At      time.Time
+	Version int
+
+	PriceSmallUnit     int64
+	HighPriceSmallUnit sql.NullInt64
+	// PriceKind is one of the product.PriceKind values.
+	PriceKind string
+	// The previous prices are only valid for price changes.
+	PreviousPriceSmallUnit     sql.NullInt64
+	PreviousHighPriceSmallUnit sql.NullInt64
+	PreviousPriceKind          sql.NullString
+	Currency                   string
+	Availability               string
+}
+
+// ListProductEventsForUser returns the lifecycle events of a product of the
+// user, oldest first.
+func ListProductEventsForUser(ctx context.Context, db *sql.DB, userID, productID uuid.UUID) (_ []ProductEvent, err error) {
+	defer observe("ListProductEventsForUser", time.Now(), &err)
+
+	const query = `
+		SELECT
+			e.kind,
+			e.at,
+			COALESCE(e.version, 0),
+			COALESCE(e.price_small_unit, 0),
+			e.high_price_small_unit,
+			e.price_kind,
+			e.previous_price_small_unit,
+			e.previous_high_price_small_unit,
+			e.previous_price_kind,
+			e.currency,
+			e.availability
+		FROM product_events e
+		INNER JOIN products p
+			ON p.id = e.product_id
+		WHERE p.user_id = $1 AND p.id = $2
+		ORDER BY e.at, e.id
+	`
+
+	rows, err := db.QueryContext(ctx, query, userID, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var events []ProductEvent
+	for rows.Next() {
+		var e ProductEvent
+		if err := rows.Scan(
+			&e.Kind,
+			&e.At,
+			&e.Version,
+			&e.PriceSmallUnit,
+			&e.HighPriceSmallUnit,
+			&e.PriceKind,
+			&e.PreviousPriceSmallUnit,
+			&e.PreviousHighPriceSmallUnit,
+			&e.PreviousPriceKind,
+			&e.Currency,
+			&e.Availability,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return events, nil
+}
+
+// SellThroughBand is how fast the sold ads of a category sold within a
+// price range.
+type SellThroughBand struct {
+	MinPriceSmallUnit int64
+	MaxPriceSmallUnit int64
+	Sold              int
+	MedianDaysToSell  float64
+	AvgPriceCuts      float64
+}
+
+// SellThrough is how the ads of a category fared. An ad is taken to be sold
+// when it was deactivated while its latest snapshot was in stock; ads
+// deactivated otherwise are counted as withdrawn.
+type SellThrough struct {
+	Category string
+	Currency string
+
+	Active    int
+	Sold      int
+	Withdrawn int
+
+	// The medians and the average are over the sold ads, the price medians
+	// over those with a fixed price.
+	MedianDaysToSell          float64
+	AvgPriceCuts              float64
+	MedianFirstPriceSmallUnit int64
+	MedianFinalPriceSmallUnit int64
+	// MedianDaysActive is how long the active ads are on the market so far.
+	MedianDaysActive float64
+
+	// Bands split the sold ads with a fixed final price in quartiles by
+	// that price, the cheapest first.
+	Bands []SellThroughBand
+}
+
+// ListSellThrough reports the sell-through of the ads of all users that were
+// first seen since a time, by category and currency, the categories with
+// the most sold ads first. An empty category reports all categories.
+func ListSellThrough(ctx context.Context, db *sql.DB, category string, since time.Time) (_ []SellThrough, err error) {
+	defer observe("ListSellThrough", time.Now(), &err)
+
+	// A price cut is a price change from a fixed price to a lower fixed
+	// price in the same currency.
+	// The band of a sold ad with a fixed price is its price quartile among
+	// those ads of the category, the total of the category is the row
+	// without a band. Prices that aren't fixed are left out of the price
+	// medians.
+	const query = `
+		WITH ads AS (
+			SELECT
+				latest.raw_json->>'category' AS category,
+				latest.currency,
+				latest.price_small_unit AS final_price,
+				latest.price_kind = 'fixed' AS final_fixed,
+				first.price_small_unit AS first_price,
+				first.price_kind = 'fixed' AS first_fixed,
+				p.deactivated_at IS NOT NULL
+					AND latest.availability LIKE '%InStock' AS sold,
+				p.deactivated_at IS NOT NULL
+					AND latest.availability NOT LIKE '%InStock' AS withdrawn,
+				EXTRACT(EPOCH FROM COALESCE(p.deactivated_at, now()) - first.retrieved_at) / 86400 AS days,
+				(
+					SELECT COUNT(*)
+					FROM product_events e
+					WHERE e.product_id = p.id
+						AND e.kind = 'price_change'
+						AND e.price_kind = 'fixed'
+						AND e.previous_price_kind = 'fixed'
+						AND e.price_small_unit < e.previous_price_small_unit
+				) AS price_cuts
+			FROM products p
+			INNER JOIN LATERAL (
+				SELECT price_small_unit, price_kind, retrieved_at
+				FROM product_versions
+				WHERE product_id = p.id
+				ORDER BY version ASC
+				LIMIT 1
+			) first ON true
+			INNER JOIN LATERAL (
+				SELECT price_small_unit, price_kind, currency, COALESCE(availability, '') AS availability, raw_json
+				FROM product_versions
+				WHERE product_id = p.id
+				ORDER BY version DESC
+				LIMIT 1
+			) latest ON true
+			WHERE first.retrieved_at >= $2
+		),
+		banded AS (
+			SELECT ads.*,
+				CASE WHEN sold AND final_fixed THEN ntile(4) OVER (PARTITION BY category, currency, sold AND final_fixed ORDER BY final_price) END AS band
+			FROM ads
+			WHERE COALESCE(category, '') <> ''
+				AND ($1 = '' OR category = $1)
+		)
+		SELECT
+			category,
+			currency,
+			COALESCE(band, 0),
+			COUNT(*) FILTER (WHERE NOT sold AND NOT withdrawn),
+			COUNT(*) FILTER (WHERE sold),
+			COUNT(*) FILTER (WHERE withdrawn),
+			COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY days) FILTER (WHERE sold), 0),
+			COALESCE(AVG(price_cuts) FILTER (WHERE sold), 0),
+			COALESCE(percentile_disc(0.5) WITHIN GROUP (ORDER BY final_price) FILTER (WHERE sold AND final_fixed), 0),
+			COALESCE(percentile_disc(0.5) WITHIN GROUP (ORDER BY first_price) FILTER (WHERE sold AND first_fixed), 0),
+			COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY days) FILTER (WHERE NOT sold AND NOT withdrawn), 0),
+			COALESCE(MIN(final_price) FILTER (WHERE sold AND final_fixed), 0),
+			COALESCE(MAX(final_price) FILTER (WHERE sold AND final_fixed), 0)
+		FROM banded
+		GROUP BY GROUPING SETS ((category, currency), (category, currency, band))
+		HAVING GROUPING(band) = 1 OR band IS NOT NULL
+		ORDER BY category, currency, COALESCE(band, 0)
+	`
+
+	rows, err := db.QueryContext(ctx, query, category, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var reports []SellThrough
+	for rows.Next() {
+		var (
+			r    SellThrough
+			band int
+			b    SellThroughBand
+		)
+		if err := rows.Scan(
+			&r.Category,
+			&r.Currency,
+			&band,
+			&r.Active,
+			&r.Sold,
+			&r.Withdrawn,
+			&r.MedianDaysToSell,
+			&r.AvgPriceCuts,
+			&r.MedianFinalPriceSmallUnit,
+			&r.MedianFirstPriceSmallUnit,
+			&r.MedianDaysActive,
+			&b.MinPriceSmallUnit,
+			&b.MaxPriceSmallUnit,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		// the total of a category comes right before its bands
+		if band == 0 {
+			reports = append(reports, r)
+			continue
+		}
+		if len(reports) == 0 {
+			return nil, fmt.Errorf("got band %d of %s before its total", band, r.Category)
+		}
+		b.Sold = r.Sold
+		b.MedianDaysToSell = r.MedianDaysToSell
+		b.AvgPriceCuts = r.AvgPriceCuts
+		last := &reports[len(reports)-1]
+		last.Bands = append(last.Bands, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	slices.SortStableFunc(reports, func(a, b SellThrough) int {
+		return cmp.Compare(b.Sold, a.Sold)
+	})
+	return reports, nil
+}
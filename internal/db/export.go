@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExportRow is one snapshot of a tracked product, flattened for exporting.
+// Products that have no snapshot yet are exported once with Version 0.
+type ExportRow struct {
+	ProductID      uuid.UUID
+	URL            string
+	TrackedAt      time.Time
+	Version        int
+	RetrievedAt    time.Time
+	Name           string
+	PriceSmallUnit int64
+	// PriceKind tells how to read the prices, see product.PriceKind.
+	// HighPriceSmallUnit is only set for ranges.
+	PriceKind          string
+	HighPriceSmallUnit sql.NullInt64
+	Currency           string
+	Availability       string
+	RawJSON            []byte
+}
+
+// StreamExportRowsForUser calls fn for every snapshot of every product the
+// user tracks, oldest product and version first. Rows are handed over while
+// iterating the result set, so memory use doesn't grow with the history.
+// The raw_json column is only read when includeRawJSON is set.
+func StreamExportRowsForUser(
+	ctx context.Context,
+	db *sql.DB,
+	userID uuid.UUID,
+	includeRawJSON bool,
+	fn func(ExportRow) error,
+) (err error) {
+	defer observe("StreamExportRowsForUser", time.Now(), &err)
+
+	const query = `
+		SELECT
+			p.id,
+			p.url,
+			p.created_at,
+			COALESCE(pv.version, 0),
+			pv.retrieved_at,
+			COALESCE(pv.name, ''),
+			COALESCE(pv.price_small_unit, 0),
+			COALESCE(pv.price_kind, ''),
+			pv.high_price_small_unit,
+			COALESCE(pv.currency, ''),
+			COALESCE(pv.availability, ''),
+			CASE WHEN $2 THEN pv.raw_json END
+		FROM products p
+		LEFT JOIN product_versions pv
+			ON pv.product_id = p.id
+		WHERE p.user_id = $1
+		ORDER BY p.created_at ASC, p.id, pv.version ASC
+	`
+
+	rows, err := db.QueryContext(ctx, query, userID, includeRawJSON)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			row         ExportRow
+			retrievedAt sql.NullTime
+		)
+		if err := rows.Scan(
+			&row.ProductID,
+			&row.URL,
+			&row.TrackedAt,
+			&row.Version,
+			&retrievedAt,
+			&row.Name,
+			&row.PriceSmallUnit,
+			&row.PriceKind,
+			&row.HighPriceSmallUnit,
+			&row.Currency,
+			&row.Availability,
+			&row.RawJSON,
+		); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		row.RetrievedAt = retrievedAt.Time
+
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Image is an image archived in the blob store, under its Hash.
+type Image struct {
+	Hash        string
+	ContentType string
+	Size        int64
+}
+
+// SnapshotImage is an archived image of a snapshot, at Position in the
+// image list of the ad.
+type SnapshotImage struct {
+	Image
+	Position  int
+	SourceURL string
+}
+
+// StoreSnapshotImages links archived images to a snapshot. Images archived
+// before, e.g. for an older version, are shared rather than stored again.
+func StoreSnapshotImages(
+	ctx context.Context,
+	db *sql.DB,
+	productID uuid.UUID,
+	version int,
+	images []SnapshotImage,
+) (err error) {
+	defer observe("StoreSnapshotImages", time.Now(), &err)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var versionID uuid.UUID
+	const versionQuery = `
+		SELECT id
+		FROM product_versions
+		WHERE product_id = $1 AND version = $2
+	`
+	if err = tx.QueryRowContext(ctx, versionQuery, productID, version).Scan(&versionID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	const imageQuery = `
+		INSERT INTO images (hash, content_type, size)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (hash) DO NOTHING
+	`
+	const linkQuery = `
+		INSERT INTO product_version_images (product_version_id, position, source_url, image_hash)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (product_version_id, position) DO NOTHING
+	`
+	for _, img := range images {
+		if _, err = tx.ExecContext(ctx, imageQuery, img.Hash, img.ContentType, img.Size); err != nil {
+			return fmt.Errorf("failed to store image: %w", err)
+		}
+		if _, err = tx.ExecContext(ctx, linkQuery, versionID, img.Position, img.SourceURL, img.Hash); err != nil {
+			return fmt.Errorf("failed to link image: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListArchivedImages returns the images archived for any snapshot of a
+// product by their source url, so they aren't downloaded again.
+func ListArchivedImages(ctx context.Context, db *sql.DB, productID uuid.UUID) (_ map[string]Image, err error) {
+	defer observe("ListArchivedImages", time.Now(), &err)
+
+	const query = `
+		SELECT DISTINCT ON (pvi.source_url) pvi.source_url, i.hash, i.content_type, i.size
+		FROM product_versions pv
+		INNER JOIN product_version_images pvi
+			ON pvi.product_version_id = pv.id
+		INNER JOIN images i
+			ON i.hash = pvi.image_hash
+		WHERE pv.product_id = $1
+		ORDER BY pvi.source_url, pv.version DESC
+	`
+
+	rows, err := db.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	archived := make(map[string]Image)
+	for rows.Next() {
+		var (
+			sourceURL string
+			img       Image
+		)
+		if err := rows.Scan(&sourceURL, &img.Hash, &img.ContentType, &img.Size); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		archived[sourceURL] = img
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return archived, nil
+}
+
+// ListSnapshotImagesForUser returns the archived images of a snapshot in
+// their order in the ad. Snapshots of other users have no images.
+func ListSnapshotImagesForUser(
+	ctx context.Context,
+	db *sql.DB,
+	userID uuid.UUID,
+	productID uuid.UUID,
+	version int,
+) (_ []SnapshotImage, err error) {
+	defer observe("ListSnapshotImagesForUser", time.Now(), &err)
+
+	const query = `
+		SELECT pvi.position, pvi.source_url, i.hash, i.content_type, i.size
+		FROM products p
+		INNER JOIN product_versions pv
+			ON pv.product_id = p.id
+		INNER JOIN product_version_images pvi
+			ON pvi.product_version_id = pv.id
+		INNER JOIN images i
+			ON i.hash = pvi.image_hash
+		WHERE p.user_id = $1 AND p.id = $2 AND pv.version = $3
+		ORDER BY pvi.position
+	`
+
+	rows, err := db.QueryContext(ctx, query, userID, productID, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var images []SnapshotImage
+	for rows.Next() {
+		var img SnapshotImage
+		if err := rows.Scan(&img.Position, &img.SourceURL, &img.Hash, &img.ContentType, &img.Size); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		images = append(images, img)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return images, nil
+}
+
+// GetImageForUser returns an archived image if it belongs to a snapshot of
+// one of the products of the user, or ErrNotFound.
+func GetImageForUser(ctx context.Context, db *sql.DB, userID uuid.UUID, hash string) (_ Image, err error) {
+	defer observe("GetImageForUser", time.Now(), &err)
+
+	const query = `
+		SELECT i.hash, i.content_type, i.size
+		FROM images i
+		WHERE i.hash = $2 AND EXISTS (
+			SELECT 1
+			FROM product_version_images pvi
+			INNER JOIN product_versions pv
+				ON pv.id = pvi.product_version_id
+			INNER JOIN products p
+				ON p.id = pv.product_id
+			WHERE pvi.image_hash = i.hash AND p.user_id = $1
+		)
+	`
+
+	var img Image
+	err = db.QueryRowContext(ctx, query, userID, hash).Scan(&img.Hash, &img.ContentType, &img.Size)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Image{}, ErrNotFound
+		}
+		return Image{}, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return img, nil
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TrackRequest struct {
+	URL string
+	// TargetPriceSmallUnit is the price the user is waiting for, if any, in
+	// TargetPriceCurrency.
+	TargetPriceSmallUnit sql.NullInt64
+	TargetPriceCurrency  string
+	Notes                string
+}
+
+// TrackOutcome tells what happened to a single TrackRequest.
+type TrackOutcome string
+
+const (
+	TrackInserted TrackOutcome = "inserted"
+	// TrackAlreadyTracked means the user was already tracking the url.
+	TrackAlreadyTracked TrackOutcome = "already tracked"
+	// TrackTrackedByOther means the url is tracked by another user. Urls are
+	// unique across users, so it can't be tracked again.
+	TrackTrackedByOther TrackOutcome = "tracked by another user"
+)
+
+// TrackAddsForUser tracks all the given urls in a single transaction and
+// returns the outcome of every request. Unlike TrackAddForUser an existing
+// url doesn't abort the whole batch.
+func TrackAddsForUser(ctx context.Context, db *sql.DB, userID uuid.UUID, requests []TrackRequest) (_ []TrackOutcome, err error) {
+	defer observe("TrackAddsForUser", time.Now(), &err)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	const insertQuery = `
+		INSERT INTO products (id, user_id, url, target_price_small_unit, target_price_currency, notes)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))
+		ON CONFLICT (url) DO NOTHING
+	`
+	// the conflicting row is read in its own statement, so it's visible
+	// even when it was committed by a concurrent import after this
+	// transaction started
+	const ownerQuery = `
+		SELECT user_id FROM products WHERE url = $1
+	`
+
+	insertStmt, err := tx.PrepareContext(ctx, insertQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare query: %w", err)
+	}
+	defer insertStmt.Close()
+	ownerStmt, err := tx.PrepareContext(ctx, ownerQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare query: %w", err)
+	}
+	defer ownerStmt.Close()
+
+	outcomes := make([]TrackOutcome, len(requests))
+	for i, r := range requests {
+		var res sql.Result
+		res, err = insertStmt.ExecContext(ctx, uuid.New(), userID, r.URL, r.TargetPriceSmallUnit, r.TargetPriceCurrency, r.Notes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute query: %w", err)
+		}
+
+		var affected int64
+		affected, err = res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read affected rows: %w", err)
+		}
+		if affected == 1 {
+			outcomes[i] = TrackInserted
+			continue
+		}
+
+		var owner uuid.UUID
+		err = ownerStmt.QueryRowContext(ctx, r.URL).Scan(&owner)
+		if errors.Is(err, sql.ErrNoRows) {
+			// untracked between the two statements, rerunning the import
+			// tracks it
+			err = fmt.Errorf("url %s was untracked during the import", r.URL)
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute query: %w", err)
+		}
+		outcomes[i] = TrackAlreadyTracked
+		if owner != userID {
+			outcomes[i] = TrackTrackedByOther
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return outcomes, nil
+}
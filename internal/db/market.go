@@ -0,0 +1,401 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The kinds of market segments stats are materialized for.
+const (
+	MarketCategory = "category"
+	MarketKeyword  = "keyword"
+)
+
+// MarketStat are the fixed prices of the ads listed in a market segment on a
+// day: the ads in a category or the ads whose name matches a keyword.
+type MarketStat struct {
+	Kind     string
+	Key      string
+	Currency string
+	Day      time.Time
+	Listings int
+
+	MinSmallUnit    int64
+	P10SmallUnit    int64
+	P25SmallUnit    int64
+	MedianSmallUnit int64
+	P75SmallUnit    int64
+	P90SmallUnit    int64
+	MaxSmallUnit    int64
+
+	ComputedAt time.Time
+}
+
+// AddMarketKeyword starts materializing the stats of a normalized keyword,
+// see market.NormalizeKeyword. It returns ErrAlreadyExists if the keyword
+// was added before.
+func AddMarketKeyword(ctx context.Context, db *sql.DB, keyword string) (err error) {
+	defer observe("AddMarketKeyword", time.Now(), &err)
+
+	const query = `
+		INSERT INTO market_keywords (keyword)
+		VALUES ($1)
+		ON CONFLICT (keyword) DO NOTHING
+	`
+
+	res, err := db.ExecContext(ctx, query, keyword)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+// RemoveMarketKeyword stops materializing the stats of a keyword and drops
+// the ones computed so far.
+func RemoveMarketKeyword(ctx context.Context, db *sql.DB, keyword string) (err error) {
+	defer observe("RemoveMarketKeyword", time.Now(), &err)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM market_keywords WHERE keyword = $1`, keyword)
+	if err != nil {
+		return fmt.Errorf("failed to delete keyword: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM market_stats WHERE kind = $1 AND key = $2`, MarketKeyword, keyword)
+	if err != nil {
+		return fmt.Errorf("failed to delete stats: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ListMarketKeywords returns the keywords stats are materialized for, in
+// alphabetical order.
+func ListMarketKeywords(ctx context.Context, db *sql.DB) (_ []string, err error) {
+	defer observe("ListMarketKeywords", time.Now(), &err)
+
+	rows, err := db.QueryContext(ctx, `SELECT keyword FROM market_keywords ORDER BY keyword`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var keywords []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		keywords = append(keywords, k)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return keywords, nil
+}
+
+// RefreshMarketStats materializes the market stats from the snapshots of
+// all tracked ads. The last materialized day is computed again, as it was
+// likely still in progress, together with the days after it. The stats of
+// newly added keywords are computed for the whole history instead.
+//
+// An ad counts towards a day if it wasn't deactivated before that day and
+// the latest snapshot retrieved by the end of the day has a fixed price.
+func RefreshMarketStats(ctx context.Context, db *sql.DB) (err error) {
+	defer observe("RefreshMarketStats", time.Now(), &err)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// a concurrent refresh would compute the same days again
+	if _, err = tx.ExecContext(ctx, `LOCK TABLE market_stats IN EXCLUSIVE MODE`); err != nil {
+		return fmt.Errorf("failed to lock stats: %w", err)
+	}
+
+	const boundsQuery = `
+		SELECT
+			(SELECT MIN(retrieved_at)::date FROM product_versions),
+			(SELECT MAX(day) FROM market_stats)
+	`
+
+	var first, last sql.NullTime
+	if err = tx.QueryRowContext(ctx, boundsQuery).Scan(&first, &last); err != nil {
+		return fmt.Errorf("failed to find the days to refresh: %w", err)
+	}
+	if !first.Valid {
+		// nothing was ever fetched
+		return tx.Commit()
+	}
+
+	var backfill []string
+	rows, err := tx.QueryContext(ctx, `SELECT keyword FROM market_keywords WHERE NOT materialized`)
+	if err != nil {
+		return fmt.Errorf("failed to list new keywords: %w", err)
+	}
+	for rows.Next() {
+		var k string
+		if err = rows.Scan(&k); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		backfill = append(backfill, k)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	since := first.Time
+	if last.Valid {
+		since = last.Time
+	}
+	start := since
+	if len(backfill) > 0 {
+		start = first.Time
+	}
+
+	const deleteQuery = `
+		DELETE FROM market_stats
+		WHERE day >= $1
+			OR (kind = 'keyword' AND key = ANY($2))
+	`
+
+	if _, err = tx.ExecContext(ctx, deleteQuery, since, pq.Array(backfill)); err != nil {
+		return fmt.Errorf("failed to delete stale stats: %w", err)
+	}
+
+	// Names are matched against whole keyword words, after lowercasing them
+	// and dropping their accents, since keywords are normalized without
+	// them. Keywords only hold letters, digits and spaces, so they are safe
+	// to use in a pattern.
+	const insertQuery = `
+		WITH days AS (
+			SELECT day::date AS day
+			FROM generate_series($1::date, current_date, interval '1 day') AS day
+		),
+		listings AS (
+			SELECT
+				d.day,
+				v.currency,
+				v.price_small_unit,
+				v.raw_json->>'category' AS category,
+				unaccent(lower(v.name)) AS name
+			FROM days d
+			CROSS JOIN products p
+			INNER JOIN LATERAL (
+				SELECT name, price_small_unit, price_kind, currency, raw_json
+				FROM product_versions
+				WHERE product_id = p.id AND retrieved_at < d.day + 1
+				ORDER BY version DESC
+				LIMIT 1
+			) v ON true
+			WHERE (p.deactivated_at IS NULL OR p.deactivated_at >= d.day)
+				AND v.price_kind = 'fixed'
+		),
+		segments AS (
+			SELECT day, 'category' AS kind, category AS key, currency, price_small_unit
+			FROM listings
+			WHERE COALESCE(category, '') <> ''
+
+			UNION ALL
+
+			SELECT l.day, 'keyword', k.keyword, l.currency, l.price_small_unit
+			FROM listings l
+			INNER JOIN market_keywords k
+				ON NOT EXISTS (
+					SELECT 1
+					FROM unnest(string_to_array(k.keyword, ' ')) AS word
+					WHERE l.name !~ ('\m' || word || '\M')
+				)
+		)
+		INSERT INTO market_stats (
+			kind,
+			key,
+			currency,
+			day,
+			listings,
+			min_small_unit,
+			p10_small_unit,
+			p25_small_unit,
+			median_small_unit,
+			p75_small_unit,
+			p90_small_unit,
+			max_small_unit
+		)
+		SELECT
+			kind,
+			key,
+			currency,
+			day,
+			COUNT(*),
+			MIN(price_small_unit),
+			percentile_disc(0.1) WITHIN GROUP (ORDER BY price_small_unit),
+			percentile_disc(0.25) WITHIN GROUP (ORDER BY price_small_unit),
+			percentile_disc(0.5) WITHIN GROUP (ORDER BY price_small_unit),
+			percentile_disc(0.75) WITHIN GROUP (ORDER BY price_small_unit),
+			percentile_disc(0.9) WITHIN GROUP (ORDER BY price_small_unit),
+			MAX(price_small_unit)
+		FROM segments
+		WHERE day >= $2
+			OR (kind = 'keyword' AND key = ANY($3))
+		GROUP BY kind, key, currency, day
+	`
+
+	if _, err = tx.ExecContext(ctx, insertQuery, start, since, pq.Array(backfill)); err != nil {
+		return fmt.Errorf("failed to compute stats: %w", err)
+	}
+
+	if len(backfill) > 0 {
+		_, err = tx.ExecContext(ctx, `UPDATE market_keywords SET materialized = true WHERE keyword = ANY($1)`, pq.Array(backfill))
+		if err != nil {
+			return fmt.Errorf("failed to mark keywords as materialized: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListMarketStats returns the stats of a market segment in a currency from a
+// day on, the oldest first.
+func ListMarketStats(
+	ctx context.Context,
+	db *sql.DB,
+	kind string,
+	key string,
+	currency string,
+	since time.Time,
+) (_ []MarketStat, err error) {
+	defer observe("ListMarketStats", time.Now(), &err)
+
+	const query = `
+		SELECT
+			kind,
+			key,
+			currency,
+			day,
+			listings,
+			min_small_unit,
+			p10_small_unit,
+			p25_small_unit,
+			median_small_unit,
+			p75_small_unit,
+			p90_small_unit,
+			max_small_unit,
+			computed_at
+		FROM market_stats
+		WHERE kind = $1 AND key = $2 AND currency = $3 AND day >= $4::date
+		ORDER BY day
+	`
+
+	rows, err := db.QueryContext(ctx, query, kind, key, currency, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []MarketStat
+	for rows.Next() {
+		s, err := scanMarketStat(rows)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetLatestMarketStat returns the stats of the last day a market segment had
+// listings in a currency, or ErrNotFound if it never had any.
+func GetLatestMarketStat(ctx context.Context, db *sql.DB, kind, key, currency string) (_ MarketStat, err error) {
+	defer observe("GetLatestMarketStat", time.Now(), &err)
+
+	const query = `
+		SELECT
+			kind,
+			key,
+			currency,
+			day,
+			listings,
+			min_small_unit,
+			p10_small_unit,
+			p25_small_unit,
+			median_small_unit,
+			p75_small_unit,
+			p90_small_unit,
+			max_small_unit,
+			computed_at
+		FROM market_stats
+		WHERE kind = $1 AND key = $2 AND currency = $3
+		ORDER BY day DESC
+		LIMIT 1
+	`
+
+	s, err := scanMarketStat(db.QueryRowContext(ctx, query, kind, key, currency))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return MarketStat{}, ErrNotFound
+		}
+		return MarketStat{}, err
+	}
+	return s, nil
+}
+
+func scanMarketStat(row interface{ Scan(...any) error }) (MarketStat, error) {
+	var s MarketStat
+	err := row.Scan(
+		&s.Kind,
+		&s.Key,
+		&s.Currency,
+		&s.Day,
+		&s.Listings,
+		&s.MinSmallUnit,
+		&s.P10SmallUnit,
+		&s.P25SmallUnit,
+		&s.MedianSmallUnit,
+		&s.P75SmallUnit,
+		&s.P90SmallUnit,
+		&s.MaxSmallUnit,
+		&s.ComputedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return MarketStat{}, err
+		}
+		return MarketStat{}, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GetMigrationVersion returns the schema version recorded by golang-migrate
+// and whether the last migration failed halfway. ErrNotFound is returned if
+// no migration was ever applied.
+func GetMigrationVersion(ctx context.Context, db *sql.DB) (_ uint64, _ bool, err error) {
+	defer observe("GetMigrationVersion", time.Now(), &err)
+
+	const query = `
+		SELECT version, dirty
+		FROM schema_migrations
+		LIMIT 1
+	`
+
+	var (
+		version uint64
+		dirty   bool
+	)
+	err = db.QueryRowContext(ctx, query).Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, ErrNotFound
+		}
+		return 0, false, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return version, dirty, nil
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"errors"
+	"time"
+)
+
+// QueryObserver is told about every call of the query functions in this
+// package, so the caller can collect metrics without this package depending
+// on a metrics library. op is the name of the function. Expected outcomes
+// such as ErrNotFound and ErrAlreadyExists are reported with a nil error.
+type QueryObserver interface {
+	ObserveQuery(op string, duration time.Duration, err error)
+}
+
+type noopQueryObserver struct{}
+
+func (noopQueryObserver) ObserveQuery(string, time.Duration, error) {}
+
+var queryObserver QueryObserver = noopQueryObserver{}
+
+// SetQueryObserver installs o for all subsequent queries. It is meant to be
+// called once at startup, before the database is used.
+func SetQueryObserver(o QueryObserver) {
+	if o == nil {
+		o = noopQueryObserver{}
+	}
+	queryObserver = o
+}
+
+// observe is deferred at the start of every query function with a pointer
+// to its named error result.
+func observe(op string, start time.Time, err *error) {
+	reported := *err
+	if errors.Is(reported, ErrNotFound) || errors.Is(reported, ErrAlreadyExists) {
+		reported = nil
+	}
+	queryObserver.ObserveQuery(op, time.Since(start), reported)
+}
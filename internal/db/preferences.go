@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserPreferences are the stored preferences of a user, see
+// internal/preferences for what they mean. Empty values are the defaults.
+type UserPreferences struct {
+	Currency string
+	Timezone string
+	Locale   string
+	// PollInterval is zero to poll the ads of the user every poll cycle.
+	PollInterval time.Duration
+	// QuietStart and QuietEnd are minutes after midnight, both valid or
+	// neither.
+	QuietStart sql.NullInt16
+	QuietEnd   sql.NullInt16
+	// Email is where digests are sent, Digest how often: daily, weekly or
+	// empty for never.
+	Email  string
+	Digest string
+}
+
+// GetUserPreferences returns the preferences of a user, the defaults if they
+// never set any. It returns ErrNotFound if the user doesn't exist.
+func GetUserPreferences(ctx context.Context, db *sql.DB, userID uuid.UUID) (_ UserPreferences, err error) {
+	defer observe("GetUserPreferences", time.Now(), &err)
+
+	const query = `
+		SELECT
+			COALESCE(p.currency, ''),
+			COALESCE(p.timezone, ''),
+			COALESCE(p.locale, ''),
+			COALESCE(p.poll_interval_seconds, 0),
+			p.quiet_start_minute,
+			p.quiet_end_minute,
+			COALESCE(p.email, ''),
+			COALESCE(p.digest, '')
+		FROM users u
+		LEFT JOIN user_preferences p
+			ON p.user_id = u.id
+		WHERE u.id = $1
+	`
+
+	var p UserPreferences
+	var pollSeconds int64
+	err = db.QueryRowContext(ctx, query, userID).Scan(
+		&p.Currency,
+		&p.Timezone,
+		&p.Locale,
+		&pollSeconds,
+		&p.QuietStart,
+		&p.QuietEnd,
+		&p.Email,
+		&p.Digest,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UserPreferences{}, ErrNotFound
+		}
+		return UserPreferences{}, fmt.Errorf("failed to execute query: %w", err)
+	}
+	p.PollInterval = time.Duration(pollSeconds) * time.Second
+	return p, nil
+}
+
+// SetUserPreferences replaces the preferences of a user.
+func SetUserPreferences(ctx context.Context, db *sql.DB, userID uuid.UUID, p UserPreferences) (err error) {
+	defer observe("SetUserPreferences", time.Now(), &err)
+
+	const query = `
+		INSERT INTO user_preferences (
+			user_id,
+			currency,
+			timezone,
+			locale,
+			poll_interval_seconds,
+			quiet_start_minute,
+			quiet_end_minute,
+			email,
+			digest
+		)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6, $7, $8, $9)
+		ON CONFLICT (user_id) DO UPDATE
+		SET currency = EXCLUDED.currency,
+			timezone = EXCLUDED.timezone,
+			locale = EXCLUDED.locale,
+			poll_interval_seconds = EXCLUDED.poll_interval_seconds,
+			quiet_start_minute = EXCLUDED.quiet_start_minute,
+			quiet_end_minute = EXCLUDED.quiet_end_minute,
+			email = EXCLUDED.email,
+			digest = EXCLUDED.digest,
+			updated_at = now()
+	`
+
+	_, err = db.ExecContext(ctx, query,
+		userID,
+		p.Currency,
+		p.Timezone,
+		p.Locale,
+		int64(p.PollInterval/time.Second),
+		p.QuietStart,
+		p.QuietEnd,
+		p.Email,
+		p.Digest,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	return nil
+}
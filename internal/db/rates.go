@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ExchangeRate is the reference rate of a currency on a day, see
+// internal/exchange for how prices are converted with it.
+type ExchangeRate struct {
+	Currency string
+	Quote    string
+	Day      time.Time
+	// Rate is the price of one unit of Currency in Quote, as a decimal
+	// number, so it doesn't go through a float.
+	Rate string
+}
+
+// StoreExchangeRates stores the rates imported from a source, replacing the
+// rates already stored for the same currencies and days.
+func StoreExchangeRates(ctx context.Context, db *sql.DB, source string, rates []ExchangeRate) (err error) {
+	defer observe("StoreExchangeRates", time.Now(), &err)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	const query = `
+		INSERT INTO exchange_rates (currency, quote, day, rate, source)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (currency, quote, day) DO UPDATE
+		SET rate = EXCLUDED.rate,
+			source = EXCLUDED.source,
+			imported_at = now()
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to prepare query: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, r := range rates {
+		if _, err = stmt.ExecContext(ctx, r.Currency, r.Quote, r.Day, r.Rate, source); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ListExchangeRates returns every stored rate, ordered by currency, quote and
+// day.
+func ListExchangeRates(ctx context.Context, db *sql.DB) (_ []ExchangeRate, err error) {
+	defer observe("ListExchangeRates", time.Now(), &err)
+
+	const query = `
+		SELECT currency, quote, day, rate::text
+		FROM exchange_rates
+		ORDER BY currency, quote, day
+	`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var rates []ExchangeRate
+	for rows.Next() {
+		var r ExchangeRate
+		if err := rows.Scan(&r.Currency, &r.Quote, &r.Day, &r.Rate); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		rates = append(rates, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return rates, nil
+}
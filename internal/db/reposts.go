@@ -0,0 +1,216 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ProductFingerprint is the fingerprint of the latest snapshot of a product.
+// The hashes are unsigned 64 bit integers stored in signed columns.
+type ProductFingerprint struct {
+	ProductID   uuid.UUID
+	ImageHashes []int64
+	// ImageURLs are the urls of the hashed images, in the same order.
+	ImageURLs []string
+	Shingles  []int64
+	Seller    string
+	Location  string
+}
+
+// StoreFingerprint replaces the fingerprint of a product.
+func StoreFingerprint(ctx context.Context, db *sql.DB, fp ProductFingerprint) (err error) {
+	defer observe("StoreFingerprint", time.Now(), &err)
+
+	const query = `
+		INSERT INTO product_fingerprints (product_id, image_hashes, image_urls, shingles, seller, location)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (product_id) DO UPDATE SET
+			image_hashes = EXCLUDED.image_hashes,
+			image_urls = EXCLUDED.image_urls,
+			shingles = EXCLUDED.shingles,
+			seller = EXCLUDED.seller,
+			location = EXCLUDED.location,
+			updated_at = now()
+	`
+
+	_, err = db.ExecContext(ctx, query,
+		fp.ProductID,
+		pq.Array(nonNil(fp.ImageHashes)),
+		pq.Array(nonNil(fp.ImageURLs)),
+		pq.Array(nonNil(fp.Shingles)),
+		fp.Seller,
+		fp.Location,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	return nil
+}
+
+// nonNil keeps empty arrays from being stored as NULL.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+// GetFingerprint returns the stored fingerprint of a product, or ErrNotFound
+// if it wasn't fingerprinted yet.
+func GetFingerprint(ctx context.Context, db *sql.DB, productID uuid.UUID) (_ ProductFingerprint, err error) {
+	defer observe("GetFingerprint", time.Now(), &err)
+
+	const query = `
+		SELECT product_id, image_hashes, image_urls, shingles, seller, location
+		FROM product_fingerprints
+		WHERE product_id = $1
+	`
+
+	var fp ProductFingerprint
+	err = db.QueryRowContext(ctx, query, productID).Scan(
+		&fp.ProductID,
+		pq.Array(&fp.ImageHashes),
+		pq.Array(&fp.ImageURLs),
+		pq.Array(&fp.Shingles),
+		&fp.Seller,
+		&fp.Location,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ProductFingerprint{}, ErrNotFound
+	}
+	if err != nil {
+		return ProductFingerprint{}, fmt.Errorf("failed to execute query: %w", err)
+	}
+	return fp, nil
+}
+
+// ListRepostCandidates returns the fingerprints of the products a product
+// may be a repost of: the deactivated products of the same user that no
+// other product continues yet.
+func ListRepostCandidates(ctx context.Context, db *sql.DB, productID uuid.UUID) (_ []ProductFingerprint, err error) {
+	defer observe("ListRepostCandidates", time.Now(), &err)
+
+	const query = `
+		SELECT f.product_id, f.image_hashes, f.shingles, f.seller, f.location
+		FROM products p
+		INNER JOIN products old
+			ON old.user_id = p.user_id AND old.id <> p.id
+		INNER JOIN product_fingerprints f
+			ON f.product_id = old.id
+		WHERE p.id = $1
+			AND old.deactivated_at IS NOT NULL
+			AND NOT EXISTS (
+				SELECT 1
+				FROM products r
+				WHERE r.reposted_from = old.id
+			)
+		ORDER BY old.deactivated_at DESC
+	`
+
+	rows, err := db.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []ProductFingerprint
+	for rows.Next() {
+		var fp ProductFingerprint
+		if err := rows.Scan(
+			&fp.ProductID,
+			pq.Array(&fp.ImageHashes),
+			pq.Array(&fp.Shingles),
+			&fp.Seller,
+			&fp.Location,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		candidates = append(candidates, fp)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return candidates, nil
+}
+
+// LinkRepost records that a product is a repost of a deactivated one. It
+// returns ErrAlreadyExists if either side is already linked.
+func LinkRepost(ctx context.Context, db *sql.DB, productID, previousID uuid.UUID) (err error) {
+	defer observe("LinkRepost", time.Now(), &err)
+
+	const query = `
+		UPDATE products
+		SET reposted_from = $2
+		WHERE id = $1 AND reposted_from IS NULL
+	`
+
+	res, err := db.ExecContext(ctx, query, productID, previousID)
+	if err != nil {
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrAlreadyExists
+		}
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+// ListRepostChainForUser returns the products a product continues, following
+// reposts of reposts, the most recent first.
+func ListRepostChainForUser(ctx context.Context, db *sql.DB, userID, productID uuid.UUID) (_ []ProductWithUrl, err error) {
+	defer observe("ListRepostChainForUser", time.Now(), &err)
+
+	// the depth limit only guards against a cycle that can't be created
+	// through LinkRepost
+	const query = `
+		WITH RECURSIVE chain AS (
+			SELECT id, url, reposted_from, 0 AS depth
+			FROM products
+			WHERE user_id = $1 AND id = $2
+
+			UNION ALL
+
+			SELECT p.id, p.url, p.reposted_from, c.depth + 1
+			FROM products p
+			INNER JOIN chain c
+				ON p.id = c.reposted_from
+			WHERE c.depth < 100
+		)
+		SELECT id, url
+		FROM chain
+		WHERE depth > 0
+		ORDER BY depth
+	`
+
+	rows, err := db.QueryContext(ctx, query, userID, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var chain []ProductWithUrl
+	for rows.Next() {
+		var p ProductWithUrl
+		if err := rows.Scan(&p.ID, &p.URL); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		chain = append(chain, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return chain, nil
+}
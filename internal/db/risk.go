@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RiskReason is a heuristic that matched when assessing a snapshot, see
+// internal/risk.
+type RiskReason struct {
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+	Points int    `json:"points"`
+}
+
+// RiskReasons is stored as a JSON array.
+type RiskReasons []RiskReason
+
+func (r RiskReasons) Value() (driver.Value, error) {
+	if r == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(r)
+}
+
+func (r *RiskReasons) Scan(src any) error {
+	data, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into risk reasons", src)
+	}
+	return json.Unmarshal(data, r)
+}
+
+// SetSnapshotRisk stores the risk assessment of a snapshot.
+func SetSnapshotRisk(
+	ctx context.Context,
+	db *sql.DB,
+	productID uuid.UUID,
+	version int,
+	score int,
+	reasons RiskReasons,
+) (err error) {
+	defer observe("SetSnapshotRisk", time.Now(), &err)
+
+	const query = `
+		UPDATE product_versions
+		SET risk_score = $3, risk_reasons = $4
+		WHERE product_id = $1 AND version = $2
+	`
+
+	res, err := db.ExecContext(ctx, query, productID, version, score, reasons)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetCategoryPriceMedian returns the median fixed price of the latest
+// snapshots of the other tracked ads in a category and currency, and how
+// many ads it was computed from.
+func GetCategoryPriceMedian(
+	ctx context.Context,
+	db *sql.DB,
+	productID uuid.UUID,
+	category string,
+	currency string,
+) (_ int64, _ int, err error) {
+	defer observe("GetCategoryPriceMedian", time.Now(), &err)
+
+	const query = `
+		SELECT
+			COUNT(*),
+			COALESCE(percentile_disc(0.5) WITHIN GROUP (ORDER BY latest.price_small_unit), 0)
+		FROM products p
+		INNER JOIN LATERAL (
+			SELECT price_small_unit, price_kind, currency, raw_json
+			FROM product_versions
+			WHERE product_id = p.id
+			ORDER BY version DESC
+			LIMIT 1
+		) latest ON true
+		WHERE p.id <> $1
+			AND latest.raw_json->>'category' = $2
+			AND latest.currency = $3
+			AND latest.price_kind = 'fixed'
+	`
+
+	var (
+		ads    int
+		median int64
+	)
+	if err := db.QueryRowContext(ctx, query, productID, category, currency).Scan(&ads, &median); err != nil {
+		return 0, 0, fmt.Errorf("failed to execute query: %w", err)
+	}
+	return median, ads, nil
+}
+
+// CountImageReuse returns how many other ads share an image with the
+// fingerprint of a product, leaving out the ads of the same seller and the
+// ads it is a repost of or reposted as.
+func CountImageReuse(ctx context.Context, db *sql.DB, productID uuid.UUID) (_ int, err error) {
+	defer observe("CountImageReuse", time.Now(), &err)
+
+	const query = `
+		SELECT COUNT(DISTINCT other.product_id)
+		FROM product_fingerprints mine
+		INNER JOIN products p
+			ON p.id = mine.product_id
+		INNER JOIN product_fingerprints other
+			ON other.product_id <> mine.product_id
+			AND other.image_hashes && mine.image_hashes
+		INNER JOIN products o
+			ON o.id = other.product_id
+		WHERE mine.product_id = $1
+			AND (mine.seller = '' OR other.seller <> mine.seller)
+			AND o.id IS DISTINCT FROM p.reposted_from
+			AND o.reposted_from IS DISTINCT FROM p.id
+	`
+
+	var count int
+	if err := db.QueryRowContext(ctx, query, productID).Scan(&count); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to execute query: %w", err)
+	}
+	return count, nil
+}
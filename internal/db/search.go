@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The markers around the matched words in the highlights of search results.
+// They are private use characters, which ads don't contain, so callers can
+// escape the text before replacing them with markup of their own.
+const (
+	HighlightStart = "\ue000"
+	HighlightEnd   = "\ue001"
+)
+
+// SearchResult is a product whose name or description matched a search, at
+// the snapshot that matched best.
+type SearchResult struct {
+	ProductID   uuid.UUID
+	URL         string
+	Version     int
+	RetrievedAt time.Time
+	// MatchingVersions is how many snapshots of the product matched.
+	MatchingVersions int
+	Rank             float64
+
+	PriceSmallUnit     int64
+	HighPriceSmallUnit sql.NullInt64
+	// PriceKind is one of the product.PriceKind values.
+	PriceKind string
+	Currency  string
+
+	// NameHighlight is the whole name and DescriptionHighlight a few
+	// fragments of the description, with the matched words between
+	// HighlightStart and HighlightEnd.
+	NameHighlight        string
+	DescriptionHighlight string
+}
+
+// SearchProductsForUser searches the names and descriptions of every
+// snapshot of the user's products, so ads are also found by what they used
+// to say. The query is in the syntax of web search engines: quoted phrases,
+// "or" and a leading "-" to exclude a word. Products are ranked by their
+// best matching snapshot, newer snapshots first on ties.
+func SearchProductsForUser(ctx context.Context, db *sql.DB, userID uuid.UUID, query string, limit int) (_ []SearchResult, err error) {
+	defer observe("SearchProductsForUser", time.Now(), &err)
+
+	// Words are looked up both stemmed and as they are, see the
+	// migration of search_vector. Only the best snapshot of every product
+	// is highlighted, as ts_headline is expensive.
+	const searchQuery = `
+		WITH q AS (
+			SELECT websearch_to_tsquery('olx_romanian', $2) || websearch_to_tsquery('olx_simple', $2) AS query
+		),
+		matches AS (
+			SELECT
+				p.id AS product_id,
+				p.url,
+				pv.version,
+				pv.retrieved_at,
+				pv.name,
+				COALESCE(pv.description, '') AS description,
+				pv.price_small_unit,
+				pv.high_price_small_unit,
+				pv.price_kind,
+				pv.currency,
+				ts_rank_cd(pv.search_vector, q.query) AS rank,
+				COUNT(*) OVER (PARTITION BY p.id) AS matching_versions,
+				ROW_NUMBER() OVER (
+					PARTITION BY p.id
+					ORDER BY ts_rank_cd(pv.search_vector, q.query) DESC, pv.version DESC
+				) AS position
+			FROM products p
+			INNER JOIN product_versions pv
+				ON pv.product_id = p.id
+			CROSS JOIN q
+			WHERE p.user_id = $1 AND pv.search_vector @@ q.query
+		),
+		best AS (
+			SELECT *
+			FROM matches
+			WHERE position = 1
+			ORDER BY rank DESC, retrieved_at DESC
+			LIMIT $3
+		)
+		SELECT
+			best.product_id,
+			best.url,
+			best.version,
+			best.retrieved_at,
+			best.matching_versions,
+			best.rank,
+			best.price_small_unit,
+			best.high_price_small_unit,
+			best.price_kind,
+			best.currency,
+			ts_headline('olx_romanian', best.name, q.query, 'HighlightAll=true, ' || $4),
+			ts_headline('olx_romanian', best.description, q.query,
+				'MaxFragments=3, MinWords=5, MaxWords=20, FragmentDelimiter=" … ", ' || $4)
+		FROM best
+		CROSS JOIN q
+		ORDER BY best.rank DESC, best.retrieved_at DESC
+	`
+
+	selectors := fmt.Sprintf(`StartSel="%s", StopSel="%s"`, HighlightStart, HighlightEnd)
+
+	rows, err := db.QueryContext(ctx, searchQuery, userID, query, limit, selectors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		if err := rows.Scan(
+			&r.ProductID,
+			&r.URL,
+			&r.Version,
+			&r.RetrievedAt,
+			&r.MatchingVersions,
+			&r.Rank,
+			&r.PriceSmallUnit,
+			&r.HighPriceSmallUnit,
+			&r.PriceKind,
+			&r.Currency,
+			&r.NameHighlight,
+			&r.DescriptionHighlight,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		results = append(results, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AuthenticateUser checks the password against the stored bcrypt hash. Both
+// an unknown username and a wrong password return ErrNotFound, so callers
+// can't tell which one it was.
+func AuthenticateUser(ctx context.Context, db *sql.DB, username, password string) (_ uuid.UUID, err error) {
+	defer observe("AuthenticateUser", time.Now(), &err)
+
+	const query = `
+		SELECT id, password_hash
+		FROM users
+		WHERE username = $1
+	`
+
+	var (
+		userID       uuid.UUID
+		passwordHash string
+	)
+	err = db.QueryRowContext(ctx, query, username).Scan(&userID, &passwordHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, ErrNotFound
+		}
+		return uuid.Nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)); err != nil {
+		return uuid.Nil, ErrNotFound
+	}
+
+	return userID, nil
+}
+
+// CreateSession starts a new session for the user and returns the token that
+// should be handed to the client. Only a hash of the token is persisted.
+func CreateSession(ctx context.Context, db *sql.DB, userID uuid.UUID, ttl time.Duration) (_ string, err error) {
+	defer observe("CreateSession", time.Now(), &err)
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate session token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	const query = `
+		INSERT INTO sessions (token_hash, user_id, expires_at)
+		VALUES ($1, $2, $3)
+	`
+
+	_, err = db.ExecContext(ctx, query, hashSessionToken(token), userID, time.Now().Add(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetSessionUserID returns the user owning a non-expired session.
+func GetSessionUserID(ctx context.Context, db *sql.DB, token string) (_ uuid.UUID, err error) {
+	defer observe("GetSessionUserID", time.Now(), &err)
+
+	const query = `
+		SELECT user_id
+		FROM sessions
+		WHERE token_hash = $1 AND expires_at > now()
+	`
+
+	var userID uuid.UUID
+	err = db.QueryRowContext(ctx, query, hashSessionToken(token)).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, ErrNotFound
+		}
+		return uuid.Nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return userID, nil
+}
+
+func DeleteSession(ctx context.Context, db *sql.DB, token string) (err error) {
+	defer observe("DeleteSession", time.Now(), &err)
+
+	const query = `
+		DELETE FROM sessions
+		WHERE token_hash = $1
+	`
+
+	if _, err := db.ExecContext(ctx, query, hashSessionToken(token)); err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return nil
+}
+
+func hashSessionToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
@@ -0,0 +1,341 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProductSummary is a tracked product together with its first and latest
+// snapshot. Products that were never fetched successfully have Versions set
+// to 0 and the snapshot fields left empty.
+type ProductSummary struct {
+	ID            uuid.UUID
+	URL           string
+	CreatedAt     time.Time
+	LastCheckedAt time.Time
+
+	Versions             int
+	Name                 string
+	FirstPriceSmallUnit  int64
+	FirstPriceKind       string
+	FirstCurrency        string
+	LatestPriceSmallUnit int64
+	// LatestHighPriceSmallUnit is the upper end of a price range.
+	LatestHighPriceSmallUnit sql.NullInt64
+	LatestPriceKind          string
+	Currency                 string
+	Availability             string
+	LatestRetrievedAt        time.Time
+	LatestRawJSON            []byte
+}
+
+func ListProductSummariesForUser(ctx context.Context, db *sql.DB, userID uuid.UUID) (_ []ProductSummary, err error) {
+	defer observe("ListProductSummariesForUser", time.Now(), &err)
+
+	const query = `
+		SELECT
+			p.id,
+			p.url,
+			p.created_at,
+			p.last_checked_at,
+			COALESCE(latest.version, 0),
+			COALESCE(latest.name, ''),
+			COALESCE(first.price_small_unit, 0),
+			COALESCE(first.price_kind, ''),
+			COALESCE(first.currency, ''),
+			COALESCE(latest.price_small_unit, 0),
+			latest.high_price_small_unit,
+			COALESCE(latest.price_kind, ''),
+			COALESCE(latest.currency, ''),
+			COALESCE(latest.availability, ''),
+			latest.retrieved_at,
+			latest.raw_json
+		FROM products p
+		LEFT JOIN LATERAL (
+			SELECT version, name, price_small_unit, high_price_small_unit, price_kind, currency, availability, retrieved_at, raw_json
+			FROM product_versions
+			WHERE product_id = p.id
+			ORDER BY version DESC
+			LIMIT 1
+		) latest ON true
+		LEFT JOIN LATERAL (
+			SELECT price_small_unit, price_kind, currency
+			FROM product_versions
+			WHERE product_id = p.id
+			ORDER BY version ASC
+			LIMIT 1
+		) first ON true
+		WHERE p.user_id = $1
+		ORDER BY p.created_at DESC
+	`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var summaries []ProductSummary
+	for rows.Next() {
+		var (
+			s             ProductSummary
+			lastCheckedAt sql.NullTime
+			retrievedAt   sql.NullTime
+		)
+		if err := rows.Scan(
+			&s.ID,
+			&s.URL,
+			&s.CreatedAt,
+			&lastCheckedAt,
+			&s.Versions,
+			&s.Name,
+			&s.FirstPriceSmallUnit,
+			&s.FirstPriceKind,
+			&s.FirstCurrency,
+			&s.LatestPriceSmallUnit,
+			&s.LatestHighPriceSmallUnit,
+			&s.LatestPriceKind,
+			&s.Currency,
+			&s.Availability,
+			&retrievedAt,
+			&s.LatestRawJSON,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		s.LastCheckedAt = lastCheckedAt.Time
+		s.LatestRetrievedAt = retrievedAt.Time
+
+		summaries = append(summaries, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return summaries, nil
+}
+
+func GetTrackedProductForUser(ctx context.Context, db *sql.DB, userID, productID uuid.UUID) (_ ProductWithUrl, err error) {
+	defer observe("GetTrackedProductForUser", time.Now(), &err)
+
+	const query = `
+		SELECT id, url
+		FROM products
+		WHERE user_id = $1 AND id = $2
+	`
+
+	var p ProductWithUrl
+	err = db.QueryRowContext(ctx, query, userID, productID).Scan(&p.ID, &p.URL)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ProductWithUrl{}, ErrNotFound
+		}
+		return ProductWithUrl{}, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return p, nil
+}
+
+// ProductNotes is what the user noted about a product when importing it.
+type ProductNotes struct {
+	// TargetPriceSmallUnit is the price the user is waiting for, if any, in
+	// TargetPriceCurrency.
+	TargetPriceSmallUnit sql.NullInt64
+	TargetPriceCurrency  string
+	Notes                string
+}
+
+// GetProductNotesForUser returns the notes of a product of the user, or
+// ErrNotFound if the user doesn't track it.
+func GetProductNotesForUser(ctx context.Context, db *sql.DB, userID, productID uuid.UUID) (_ ProductNotes, err error) {
+	defer observe("GetProductNotesForUser", time.Now(), &err)
+
+	const query = `
+		SELECT
+			target_price_small_unit,
+			COALESCE(target_price_currency, ''),
+			COALESCE(notes, '')
+		FROM products
+		WHERE user_id = $1 AND id = $2
+	`
+
+	var n ProductNotes
+	err = db.QueryRowContext(ctx, query, userID, productID).Scan(
+		&n.TargetPriceSmallUnit,
+		&n.TargetPriceCurrency,
+		&n.Notes,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ProductNotes{}, ErrNotFound
+		}
+		return ProductNotes{}, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return n, nil
+}
+
+// ListAllTrackedProducts returns the tracked products of every user that
+// are still active, oldest first. It is meant for the poller, which doesn't
+// act on behalf of a user.
+func ListAllTrackedProducts(ctx context.Context, db *sql.DB) (_ []ProductWithUrl, err error) {
+	defer observe("ListAllTrackedProducts", time.Now(), &err)
+
+	const query = `
+		SELECT id, url
+		FROM products
+		WHERE deactivated_at IS NULL
+		ORDER BY created_at ASC
+	`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var tracked []ProductWithUrl
+	for rows.Next() {
+		var p ProductWithUrl
+		if err := rows.Scan(&p.ID, &p.URL); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		tracked = append(tracked, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return tracked, nil
+}
+
+// ListTrackedProductsDueForPoll returns the active products of every user
+// that are due for a poll, oldest first. Products are due every poll cycle,
+// unless their user set a longer poll interval that didn't pass yet since
+// the last successful poll. Products are due a minute early, so one whose
+// last poll drifted by a few seconds doesn't wait for another cycle.
+func ListTrackedProductsDueForPoll(ctx context.Context, db *sql.DB) (_ []ProductWithUrl, err error) {
+	defer observe("ListTrackedProductsDueForPoll", time.Now(), &err)
+
+	const query = `
+		SELECT p.id, p.url
+		FROM products p
+		LEFT JOIN user_preferences up
+			ON up.user_id = p.user_id
+		WHERE p.deactivated_at IS NULL
+			AND (
+				up.poll_interval_seconds IS NULL
+				OR p.last_checked_at IS NULL
+				OR p.last_checked_at <= now() - make_interval(secs => up.poll_interval_seconds - 60)
+			)
+		ORDER BY p.created_at ASC
+	`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var due []ProductWithUrl
+	for rows.Next() {
+		var p ProductWithUrl
+		if err := rows.Scan(&p.ID, &p.URL); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		due = append(due, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return due, nil
+}
+
+// MarkProductDeactivated records that OLX took the ad down, together with
+// the last_seen and deactivated lifecycle events. Only the first call has an
+// effect, so the original deactivation time is kept.
+func MarkProductDeactivated(ctx context.Context, db *sql.DB, productID uuid.UUID) (err error) {
+	defer observe("MarkProductDeactivated", time.Now(), &err)
+
+	// the ad was last seen online by the last successful fetch
+	const query = `
+		WITH deactivated AS (
+			UPDATE products
+			SET deactivated_at = now()
+			WHERE id = $1 AND deactivated_at IS NULL
+			RETURNING id, deactivated_at, last_checked_at
+		)
+		INSERT INTO product_events (product_id, kind, at, version, price_small_unit, high_price_small_unit, price_kind, currency, availability)
+		SELECT d.id, e.kind,
+			CASE e.kind
+				WHEN 'last_seen' THEN COALESCE(d.last_checked_at, latest.retrieved_at, d.deactivated_at)
+				ELSE d.deactivated_at
+			END,
+			latest.version, latest.price_small_unit, latest.high_price_small_unit, COALESCE(latest.price_kind, 'fixed'),
+			COALESCE(latest.currency, ''), COALESCE(latest.availability, '')
+		FROM deactivated d
+		LEFT JOIN LATERAL (
+			SELECT version, retrieved_at, price_small_unit, high_price_small_unit, price_kind, currency, availability
+			FROM product_versions
+			WHERE product_id = d.id
+			ORDER BY version DESC
+			LIMIT 1
+		) latest ON true
+		CROSS JOIN (VALUES ('last_seen'), ('deactivated')) AS e(kind)
+	`
+
+	if _, err := db.ExecContext(ctx, query, productID); err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return nil
+}
+
+// MarkProductChecked records that the product was fetched successfully, even
+// if nothing changed and no snapshot was stored.
+func MarkProductChecked(ctx context.Context, db *sql.DB, productID uuid.UUID) (err error) {
+	defer observe("MarkProductChecked", time.Now(), &err)
+
+	const query = `
+		UPDATE products
+		SET last_checked_at = now()
+		WHERE id = $1
+	`
+
+	if _, err := db.ExecContext(ctx, query, productID); err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return nil
+}
+
+// CountTrackedProductsByStatus counts the tracked products of all users,
+// keyed by "active" and "deactivated".
+func CountTrackedProductsByStatus(ctx context.Context, db *sql.DB) (_ map[string]int, err error) {
+	defer observe("CountTrackedProductsByStatus", time.Now(), &err)
+
+	const query = `
+		SELECT
+			COUNT(*) FILTER (WHERE deactivated_at IS NULL),
+			COUNT(*) FILTER (WHERE deactivated_at IS NOT NULL)
+		FROM products
+	`
+
+	var active, deactivated int
+	if err := db.QueryRowContext(ctx, query).Scan(&active, &deactivated); err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return map[string]int{
+		"active":      active,
+		"deactivated": deactivated,
+	}, nil
+}
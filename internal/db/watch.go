@@ -0,0 +1,278 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// WatchRule is a saved search of a user, see internal/watch for how it is
+// matched. Empty fields and null price bounds don't restrict the ads
+// that match.
+type WatchRule struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Name      string
+	Keywords  string
+	MinPrice  sql.NullInt64
+	MaxPrice  sql.NullInt64
+	Currency  string
+	Category  string
+	Location  string
+	Condition string
+	CreatedAt time.Time
+}
+
+// CreateWatchRule stores a new rule and returns its id. It returns
+// ErrAlreadyExists if the user has a rule with the same name.
+func CreateWatchRule(ctx context.Context, db *sql.DB, rule WatchRule) (_ uuid.UUID, err error) {
+	defer observe("CreateWatchRule", time.Now(), &err)
+
+	const query = `
+		INSERT INTO watch_rules (
+			id,
+			user_id,
+			name,
+			keywords,
+			min_price_small_unit,
+			max_price_small_unit,
+			currency,
+			category,
+			location,
+			item_condition
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	id := uuid.New()
+	_, err = db.ExecContext(ctx, query,
+		id,
+		rule.UserID,
+		rule.Name,
+		rule.Keywords,
+		rule.MinPrice,
+		rule.MaxPrice,
+		rule.Currency,
+		rule.Category,
+		rule.Location,
+		rule.Condition,
+	)
+	if err != nil {
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return uuid.Nil, ErrAlreadyExists
+		}
+		return uuid.Nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	return id, nil
+}
+
+// DeleteWatchRuleForUser deletes a rule of the user together with its
+// matches. It returns ErrNotFound if the user has no such rule.
+func DeleteWatchRuleForUser(ctx context.Context, db *sql.DB, userID, ruleID uuid.UUID) (err error) {
+	defer observe("DeleteWatchRuleForUser", time.Now(), &err)
+
+	const query = `
+		DELETE FROM watch_rules
+		WHERE user_id = $1 AND id = $2
+	`
+
+	res, err := db.ExecContext(ctx, query, userID, ruleID)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListWatchRulesForUser returns the rules of a user, oldest first.
+func ListWatchRulesForUser(ctx context.Context, db *sql.DB, userID uuid.UUID) (_ []WatchRule, err error) {
+	defer observe("ListWatchRulesForUser", time.Now(), &err)
+	return listWatchRules(ctx, db, uuid.NullUUID{UUID: userID, Valid: true})
+}
+
+// ListAllWatchRules returns the rules of every user, oldest first. It is
+// meant for the poller, which matches new snapshots against all of them.
+func ListAllWatchRules(ctx context.Context, db *sql.DB) (_ []WatchRule, err error) {
+	defer observe("ListAllWatchRules", time.Now(), &err)
+	return listWatchRules(ctx, db, uuid.NullUUID{})
+}
+
+func listWatchRules(ctx context.Context, db *sql.DB, userID uuid.NullUUID) ([]WatchRule, error) {
+	const query = `
+		SELECT
+			id,
+			user_id,
+			name,
+			keywords,
+			min_price_small_unit,
+			max_price_small_unit,
+			currency,
+			category,
+			location,
+			item_condition,
+			created_at
+		FROM watch_rules
+		WHERE $1::uuid IS NULL OR user_id = $1::uuid
+		ORDER BY created_at, id
+	`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []WatchRule
+	for rows.Next() {
+		var r WatchRule
+		if err := rows.Scan(
+			&r.ID,
+			&r.UserID,
+			&r.Name,
+			&r.Keywords,
+			&r.MinPrice,
+			&r.MaxPrice,
+			&r.Currency,
+			&r.Category,
+			&r.Location,
+			&r.Condition,
+			&r.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		rules = append(rules, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return rules, nil
+}
+
+// RecordWatchMatch records that a snapshot of a product matched a rule. It
+// returns false if the product already matched the rule before, in which
+// case the user was notified already, or if the product is tracked by the
+// owner of the rule, who knows about it already.
+func RecordWatchMatch(ctx context.Context, db *sql.DB, ruleID, productID uuid.UUID, version int) (_ bool, err error) {
+	defer observe("RecordWatchMatch", time.Now(), &err)
+
+	const query = `
+		INSERT INTO watch_matches (rule_id, product_id, version)
+		SELECT r.id, p.id, $3
+		FROM watch_rules r
+		INNER JOIN products p
+			ON p.id = $2
+		WHERE r.id = $1 AND p.user_id <> r.user_id
+		ON CONFLICT (rule_id, product_id) DO NOTHING
+	`
+
+	res, err := db.ExecContext(ctx, query, ruleID, productID, version)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute query: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to count inserted rows: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ListWatchMatchesForUser returns the most recent matches of the user's
+// rules as changes of kind ChangeWatchMatch, newest first, with the values
+// of the snapshot that matched. The matched ads may be tracked by any other
+// user.
+func ListWatchMatchesForUser(ctx context.Context, db *sql.DB, userID uuid.UUID, limit int) (_ []ProductChange, err error) {
+	defer observe("ListWatchMatchesForUser", time.Now(), &err)
+
+	return listWatchMatches(ctx, db, userID, sql.NullTime{}, sql.NullTime{}, sql.NullInt64{Int64: int64(limit), Valid: true})
+}
+
+// ListWatchMatchesForUserBetween returns all matches of the user's rules
+// from since until before until, newest first.
+func ListWatchMatchesForUserBetween(ctx context.Context, db *sql.DB, userID uuid.UUID, since, until time.Time) (_ []ProductChange, err error) {
+	defer observe("ListWatchMatchesForUserBetween", time.Now(), &err)
+
+	return listWatchMatches(ctx, db, userID,
+		sql.NullTime{Time: since, Valid: true},
+		sql.NullTime{Time: until, Valid: true},
+		sql.NullInt64{},
+	)
+}
+
+func listWatchMatches(ctx context.Context, db *sql.DB, userID uuid.UUID, since, until sql.NullTime, limit sql.NullInt64) ([]ProductChange, error) {
+	const query = `
+		SELECT
+			r.id,
+			r.name,
+			p.id,
+			p.url,
+			m.version,
+			m.matched_at,
+			pv.name,
+			pv.price_small_unit,
+			pv.high_price_small_unit,
+			pv.price_kind,
+			pv.currency,
+			COALESCE(pv.availability, ''),
+			COALESCE(pv.risk_score, 0),
+			pv.risk_reasons
+		FROM watch_rules r
+		INNER JOIN watch_matches m
+			ON m.rule_id = r.id
+		INNER JOIN products p
+			ON p.id = m.product_id
+		INNER JOIN product_versions pv
+			ON pv.product_id = m.product_id AND pv.version = m.version
+		WHERE r.user_id = $1
+			AND p.user_id <> r.user_id
+			AND ($3::timestamptz IS NULL OR m.matched_at >= $3::timestamptz)
+			AND ($4::timestamptz IS NULL OR m.matched_at < $4::timestamptz)
+		ORDER BY m.matched_at DESC, r.name
+		LIMIT $2
+	`
+
+	rows, err := db.QueryContext(ctx, query, userID, limit, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []ProductChange
+	for rows.Next() {
+		c := ProductChange{Kind: ChangeWatchMatch}
+		if err := rows.Scan(
+			&c.WatchRuleID,
+			&c.WatchRule,
+			&c.ProductID,
+			&c.URL,
+			&c.Version,
+			&c.At,
+			&c.Name,
+			&c.PriceSmallUnit,
+			&c.HighPriceSmallUnit,
+			&c.PriceKind,
+			&c.Currency,
+			&c.Availability,
+			&c.RiskScore,
+			&c.RiskReasons,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		matches = append(matches, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,162 @@
+// Package digest sums up the changes of the ads of a user since their last
+// digest and sends it by email, daily or weekly, for users who opted in.
+package digest
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/lifecycle"
+	"github.com/Ozoniuss/olx-tracker/internal/preferences"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+// biggestMovers is how many ads are highlighted as the biggest movers.
+const biggestMovers = 3
+
+// Period returns the last full period before now in loc: yesterday for daily
+// digests and last week, Monday to Monday, for weekly ones.
+func Period(frequency preferences.DigestFrequency, now time.Time, loc *time.Location) (start, end time.Time) {
+	if loc == nil {
+		loc = time.Local
+	}
+	now = now.In(loc)
+	y, m, d := now.Date()
+
+	if frequency == preferences.DigestWeekly {
+		// days since Monday
+		d -= (int(now.Weekday()) + 6) % 7
+		end = time.Date(y, m, d, 0, 0, 0, 0, loc)
+		return end.AddDate(0, 0, -7), end
+	}
+	end = time.Date(y, m, d, 0, 0, 0, 0, loc)
+	return end.AddDate(0, 0, -1), end
+}
+
+// Digest is what changed from Since until Until.
+type Digest struct {
+	Frequency preferences.DigestFrequency
+	Since     time.Time
+	Until     time.Time
+
+	// PriceDrops and PriceRises are the ads whose fixed price ended lower
+	// or higher than it started, largest change first.
+	PriceDrops []Move
+	PriceRises []Move
+	// BiggestMovers are the largest drops and rises together.
+	BiggestMovers []Move
+	// Unavailable are the ads that ended out of stock or were taken down,
+	// with the change that made them unavailable.
+	Unavailable []dbpkg.ProductChange
+	// WatchMatches are the new matches of the user's watch rules.
+	WatchMatches []dbpkg.ProductChange
+}
+
+// Move is how the price of an ad moved over the whole period, however many
+// times it changed.
+type Move struct {
+	ProductID uuid.UUID
+	Name      string
+	URL       string
+	// FromSmallUnit is the price before the first change of the period, and
+	// ToSmallUnit the price after the last one.
+	FromSmallUnit int64
+	ToSmallUnit   int64
+	Currency      string
+	Percent       float64
+}
+
+// Empty tells whether there is nothing worth sending.
+func (d Digest) Empty() bool {
+	return len(d.PriceDrops) == 0 && len(d.PriceRises) == 0 && len(d.Unavailable) == 0 && len(d.WatchMatches) == 0
+}
+
+// Build sums up the changes of the ads of a user and the matches of their
+// watch rules, both newest first as they are listed from the db.
+func Build(changes, matches []dbpkg.ProductChange) Digest {
+	var d Digest
+
+	moves := make(map[uuid.UUID]*Move)
+	// ads whose currency changed, or whose price wasn't fixed for a while,
+	// can't be compared across the period
+	mixed := make(map[uuid.UUID]bool)
+	availability := make(map[uuid.UUID]dbpkg.ProductChange)
+	// ads in the order they first changed, so the digest is stable
+	var order []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+
+	for _, c := range slices.Backward(changes) {
+		if !seen[c.ProductID] {
+			seen[c.ProductID] = true
+			order = append(order, c.ProductID)
+		}
+
+		switch c.Kind {
+		case dbpkg.ChangeDeactivated:
+			availability[c.ProductID] = c
+			continue
+		case dbpkg.ChangeTracked:
+			continue
+		}
+
+		if c.Availability != c.PreviousAvailability {
+			availability[c.ProductID] = c
+		}
+		if (c.Kind != dbpkg.ChangePrice && c.Kind != dbpkg.ChangePriceTerms) || mixed[c.ProductID] {
+			continue
+		}
+		if c.Currency != c.PreviousCurrency || !fixed(c.PriceKind) || !fixed(c.PreviousPriceKind) {
+			mixed[c.ProductID] = true
+			delete(moves, c.ProductID)
+			continue
+		}
+		move, ok := moves[c.ProductID]
+		if !ok {
+			move = &Move{
+				ProductID:     c.ProductID,
+				FromSmallUnit: c.PreviousPriceSmallUnit,
+				Currency:      c.Currency,
+			}
+			moves[c.ProductID] = move
+		}
+		move.Name, move.URL = c.Name, c.URL
+		move.ToSmallUnit = c.PriceSmallUnit
+	}
+
+	for _, productID := range order {
+		if move, ok := moves[productID]; ok && move.FromSmallUnit != move.ToSmallUnit {
+			if move.FromSmallUnit != 0 {
+				move.Percent = float64(move.ToSmallUnit-move.FromSmallUnit) * 100 / float64(move.FromSmallUnit)
+			}
+			if move.ToSmallUnit < move.FromSmallUnit {
+				d.PriceDrops = append(d.PriceDrops, *move)
+			} else {
+				d.PriceRises = append(d.PriceRises, *move)
+			}
+		}
+		if c, ok := availability[productID]; ok && (c.Kind == dbpkg.ChangeDeactivated || !lifecycle.InStock(c.Availability)) {
+			d.Unavailable = append(d.Unavailable, c)
+		}
+	}
+
+	byMagnitude := func(a, b Move) int {
+		return cmp.Compare(math.Abs(b.Percent), math.Abs(a.Percent))
+	}
+	slices.SortStableFunc(d.PriceDrops, byMagnitude)
+	slices.SortStableFunc(d.PriceRises, byMagnitude)
+	d.BiggestMovers = slices.Concat(d.PriceDrops, d.PriceRises)
+	slices.SortStableFunc(d.BiggestMovers, byMagnitude)
+	d.BiggestMovers = d.BiggestMovers[:min(len(d.BiggestMovers), biggestMovers)]
+
+	d.WatchMatches = matches
+	return d
+}
+
+func fixed(kind string) bool {
+	return productpkg.PriceKind(kind) == productpkg.PriceFixed
+}
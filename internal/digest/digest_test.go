@@ -0,0 +1,204 @@
+package digest
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/money"
+	"github.com/Ozoniuss/olx-tracker/internal/preferences"
+)
+
+func TestPeriod(t *testing.T) {
+	bucharest, err := time.LoadLocation("Europe/Bucharest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour int) time.Time {
+		return time.Date(2026, 10, day, hour, 0, 0, 0, bucharest)
+	}
+
+	tests := []struct {
+		name       string
+		frequency  preferences.DigestFrequency
+		now        time.Time
+		start, end time.Time
+	}{
+		{"daily", preferences.DigestDaily, at(18, 9), at(17, 0), at(18, 0)},
+		{"daily just after midnight", preferences.DigestDaily, at(18, 0), at(17, 0), at(18, 0)},
+		// the clocks go back on Oct 25, that day has 25 hours
+		{"daily over dst", preferences.DigestDaily, at(26, 9), at(25, 0), at(26, 0)},
+		// Oct 18, 2026 is a Sunday
+		{"weekly on sunday", preferences.DigestWeekly, at(18, 9), at(5, 0), at(12, 0)},
+		{"weekly on monday", preferences.DigestWeekly, at(19, 9), at(12, 0), at(19, 0)},
+	}
+	for _, tt := range tests {
+		start, end := Period(tt.frequency, tt.now, bucharest)
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("%s: got %s - %s, want %s - %s", tt.name, start, end, tt.start, tt.end)
+		}
+	}
+
+	// the day is the day of the user, not of the server
+	start, _ := Period(preferences.DigestDaily, time.Date(2026, 10, 17, 22, 30, 0, 0, time.UTC), bucharest)
+	if !start.Equal(at(17, 0)) {
+		t.Errorf("got %s, want the day before Oct 18 in Bucharest", start)
+	}
+}
+
+func testChanges() (changes, matches []dbpkg.ProductChange) {
+	at := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+	mouse := dbpkg.ProductChange{
+		ProductID:            uuid.MustParse("5b0b3a9e-8f0e-4a43-9d2e-7c1f4f1e2a10"),
+		URL:                  "https://www.olx.ro/d/oferta/mouse-IDkbEDA.html",
+		Name:                 "Mouse",
+		PriceKind:            "fixed",
+		PreviousPriceKind:    "fixed",
+		Currency:             "RON",
+		PreviousCurrency:     "RON",
+		Availability:         "https://schema.org/InStock",
+		PreviousAvailability: "https://schema.org/InStock",
+	}
+	firstCut := mouse
+	firstCut.Kind, firstCut.At = dbpkg.ChangePrice, at
+	firstCut.PreviousPriceSmallUnit, firstCut.PriceSmallUnit = 50000, 45000
+	secondCut := mouse
+	secondCut.Kind, secondCut.At = dbpkg.ChangePrice, at.Add(time.Hour)
+	secondCut.PreviousPriceSmallUnit, secondCut.PriceSmallUnit = 45000, 40000
+
+	laptop := dbpkg.ProductChange{
+		Kind:                   dbpkg.ChangePrice,
+		ProductID:              uuid.MustParse("0d7e6c61-3c8b-4a57-8f5d-2a4a0c9b1e22"),
+		At:                     at.Add(2 * time.Hour),
+		URL:                    "https://www.olx.ro/d/oferta/laptop-IDkbEDB.html",
+		Name:                   "Laptop",
+		PriceSmallUnit:         420000,
+		PreviousPriceSmallUnit: 400000,
+		PriceKind:              "fixed",
+		PreviousPriceKind:      "fixed",
+		Currency:               "RON",
+		PreviousCurrency:       "RON",
+	}
+	// gone out of stock and back in stock, so still available
+	chair := dbpkg.ProductChange{
+		Kind:                 dbpkg.ChangeAvailability,
+		ProductID:            uuid.MustParse("3f1c2b7a-9d4e-4c8a-b6e2-1a2b3c4d5e6f"),
+		At:                   at,
+		URL:                  "https://www.olx.ro/d/oferta/chair-IDkbEDC.html",
+		Name:                 "Chair",
+		PriceSmallUnit:       10000,
+		Currency:             "RON",
+		Availability:         "https://schema.org/OutOfStock",
+		PreviousAvailability: "https://schema.org/InStock",
+	}
+	chairBack := chair
+	chairBack.At = at.Add(3 * time.Hour)
+	chairBack.Availability, chairBack.PreviousAvailability = chair.PreviousAvailability, chair.Availability
+	removed := secondCut
+	removed.Kind, removed.At = dbpkg.ChangeDeactivated, at.Add(4*time.Hour)
+
+	match := dbpkg.ProductChange{
+		Kind:           dbpkg.ChangeWatchMatch,
+		ProductID:      uuid.New(),
+		At:             at,
+		URL:            "https://www.olx.ro/d/oferta/keyboard-IDkbEDD.html",
+		Name:           "Keyboard",
+		PriceSmallUnit: 123456,
+		Currency:       "RON",
+		WatchRule:      "keyboards",
+	}
+
+	// newest first, like the db lists them
+	return []dbpkg.ProductChange{removed, chairBack, laptop, secondCut, firstCut, chair}, []dbpkg.ProductChange{match}
+}
+
+func TestBuild(t *testing.T) {
+	if d := Build(nil, nil); !d.Empty() {
+		t.Errorf("expected an empty digest without changes: %+v", d)
+	}
+
+	d := Build(testChanges())
+	if len(d.PriceDrops) != 1 || d.PriceDrops[0].FromSmallUnit != 50000 || d.PriceDrops[0].ToSmallUnit != 40000 || d.PriceDrops[0].Percent != -20 {
+		t.Errorf("expected both cuts of the mouse as one drop: %+v", d.PriceDrops)
+	}
+	if len(d.PriceRises) != 1 || d.PriceRises[0].Name != "Laptop" || d.PriceRises[0].Percent != 5 {
+		t.Errorf("expected the laptop to rise: %+v", d.PriceRises)
+	}
+	if len(d.BiggestMovers) != 2 || d.BiggestMovers[0].Name != "Mouse" {
+		t.Errorf("expected the mouse to be the biggest mover: %+v", d.BiggestMovers)
+	}
+	if len(d.Unavailable) != 1 || d.Unavailable[0].Kind != dbpkg.ChangeDeactivated {
+		t.Errorf("expected only the removed mouse to be unavailable: %+v", d.Unavailable)
+	}
+	if len(d.WatchMatches) != 1 {
+		t.Errorf("expected the watch match: %+v", d.WatchMatches)
+	}
+
+	// a price that wasn't fixed for a while can't be compared, even if it
+	// was fixed at both ends of the period
+	changes, matches := testChanges()
+	secondCut := changes[3]
+	toRange := secondCut
+	toRange.Kind, toRange.PriceKind = dbpkg.ChangePriceTerms, "range"
+	toRange.PreviousPriceSmallUnit, toRange.PriceSmallUnit = 40000, 39000
+	toRange.HighPriceSmallUnit = sql.NullInt64{Int64: 42000, Valid: true}
+	toFixed := secondCut
+	toFixed.Kind, toFixed.PreviousPriceKind = dbpkg.ChangePriceTerms, "range"
+	toFixed.PreviousPriceSmallUnit, toFixed.PriceSmallUnit = 39000, 38000
+	toFixed.PreviousHighPriceSmallUnit = toRange.HighPriceSmallUnit
+	changes = slices.Insert(changes, 3, toFixed, toRange)
+	d = Build(changes, matches)
+	if len(d.PriceDrops) != 0 {
+		t.Errorf("expected no drop of the mouse after its price was a range: %+v", d.PriceDrops)
+	}
+}
+
+func TestRender(t *testing.T) {
+	bucharest, err := time.LoadLocation("Europe/Bucharest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefs := preferences.Default()
+	prefs.Locale, prefs.Location = money.LocaleRO, bucharest
+
+	d := Build(testChanges())
+	d.Frequency = preferences.DigestDaily
+	d.Since, d.Until = Period(preferences.DigestDaily, time.Date(2026, 10, 18, 9, 0, 0, 0, bucharest), bucharest)
+
+	m, err := Render(d, prefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Your daily OLX Tracker digest: 1 price drop, 1 price rise, 1 ad unavailable, 1 new match"; m.Subject != want {
+		t.Errorf("subject = %q, want %q", m.Subject, want)
+	}
+
+	for _, want := range []string{
+		"Your daily OLX Tracker digest, 2026-10-17 00:00 to 2026-10-18 00:00.",
+		"Biggest movers\n- Mouse: 500,00 lei → 400,00 lei (-20.0%)\n  https://www.olx.ro/d/oferta/mouse-IDkbEDA.html\n- Laptop:",
+		"Price rises\n- Laptop: 4.000,00 lei → 4.200,00 lei (+5.0%)",
+		"No longer available\n- Mouse: taken down, last at 400,00 lei",
+		"New matches for your watch rules\n- Keyboard at 1.234,56 lei, matches \"keyboards\"",
+	} {
+		if !strings.Contains(m.Text, want) {
+			t.Errorf("text digest doesn't contain %q:\n%s", want, m.Text)
+		}
+	}
+	if strings.Contains(m.Text, "Chair") {
+		t.Errorf("the chair is back in stock and shouldn't be in the digest:\n%s", m.Text)
+	}
+
+	for _, want := range []string{
+		`<a href="https://www.olx.ro/d/oferta/mouse-IDkbEDA.html">Mouse</a>: 500,00 lei → <strong>400,00 lei</strong> (-20.0%)`,
+		"matches “keyboards”",
+	} {
+		if !strings.Contains(m.HTML, want) {
+			t.Errorf("html digest doesn't contain %q:\n%s", want, m.HTML)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/preferences"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// Message is a rendered digest, both as plain text and as HTML.
+type Message struct {
+	// ID is the same for every attempt to send the digest of a period, so
+	// mail clients can tell duplicates apart.
+	ID      string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Render renders a digest with the locale and time zone of the user. The
+// recipient and id of the message are left to the caller.
+func Render(d Digest, prefs preferences.Preferences) (Message, error) {
+	funcs := map[string]any{
+		"price":       prefs.FormatPrice,
+		"time":        prefs.FormatTime,
+		"percent":     func(p float64) string { return fmt.Sprintf("%+.1f%%", p) },
+		"unavailable": unavailable,
+	}
+
+	textTemplate, err := texttemplate.New("digest.txt").Funcs(funcs).ParseFS(templates, "templates/digest.txt")
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to parse text template: %w", err)
+	}
+	htmlTemplate, err := htmltemplate.New("digest.html").Funcs(funcs).ParseFS(templates, "templates/digest.html")
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to parse html template: %w", err)
+	}
+
+	var text, html bytes.Buffer
+	if err := textTemplate.Execute(&text, d); err != nil {
+		return Message{}, fmt.Errorf("failed to render text digest: %w", err)
+	}
+	if err := htmlTemplate.Execute(&html, d); err != nil {
+		return Message{}, fmt.Errorf("failed to render html digest: %w", err)
+	}
+
+	return Message{
+		Subject: subject(d),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// subject counts what the digest is about, e.g. "Your daily OLX Tracker
+// digest: 2 price drops, 1 new match".
+func subject(d Digest) string {
+	var parts []string
+	count := func(n int, one, many string) {
+		switch {
+		case n == 1:
+			parts = append(parts, "1 "+one)
+		case n > 1:
+			parts = append(parts, fmt.Sprintf("%d %s", n, many))
+		}
+	}
+	count(len(d.PriceDrops), "price drop", "price drops")
+	count(len(d.PriceRises), "price rise", "price rises")
+	count(len(d.Unavailable), "ad unavailable", "ads unavailable")
+	count(len(d.WatchMatches), "new match", "new matches")
+
+	return fmt.Sprintf("Your %s OLX Tracker digest: %s", d.Frequency, strings.Join(parts, ", "))
+}
+
+// unavailable tells why an ad is no longer available, e.g. "now OutOfStock".
+func unavailable(c dbpkg.ProductChange) string {
+	if c.Kind == dbpkg.ChangeDeactivated {
+		return "taken down"
+	}
+	availability := c.Availability
+	if i := strings.LastIndex(availability, "/"); i >= 0 {
+		availability = availability[i+1:]
+	}
+	if availability == "" {
+		return "availability unknown"
+	}
+	return "now " + availability
+}
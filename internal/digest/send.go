@@ -0,0 +1,127 @@
+package digest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/preferences"
+)
+
+// SendDue sends the digests of the last full period to the users who opted
+// in and didn't get theirs yet. Each period is claimed in the db before its
+// digest is sent, so a digest is sent at most once: one whose sending was
+// interrupted by a restart is never sent again, one that failed is tried
+// again on the next call. A failure for one user doesn't stop the others.
+func SendDue(ctx context.Context, db *sql.DB, mailer Mailer, now time.Time) error {
+	users, err := dbpkg.ListDigestSubscribers(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to list digest subscribers: %w", err)
+	}
+
+	for _, userID := range users {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := sendForUser(ctx, db, mailer, userID, now); err != nil {
+			slog.ErrorContext(ctx, "failed to send digest", "user_id", userID, "error", err)
+		}
+	}
+	return nil
+}
+
+func sendForUser(ctx context.Context, db *sql.DB, mailer Mailer, userID uuid.UUID, now time.Time) error {
+	prefs, err := preferences.Load(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+	// the user opted out since they were listed
+	if prefs.Digest == preferences.DigestNone {
+		return nil
+	}
+	// sent once the quiet hours end, like every other notification
+	if _, _, quiet := prefs.Quiet(now); quiet {
+		return nil
+	}
+
+	start, end := Period(prefs.Digest, now, prefs.Location)
+	// the digest covers everything since the last one, which is the start
+	// of the period unless digests were missed or the frequency changed
+	since := start
+	last, err := dbpkg.GetLastDigestEnd(ctx, db, userID)
+	switch {
+	case err == nil:
+		since = last
+	case !errors.Is(err, dbpkg.ErrNotFound):
+		return err
+	}
+
+	period := dbpkg.DigestPeriod{
+		UserID:    userID,
+		Frequency: string(prefs.Digest),
+		Start:     start,
+		End:       end,
+	}
+	claimed, err := dbpkg.ClaimDigest(ctx, db, period)
+	if err != nil || !claimed {
+		return err
+	}
+
+	status, err := send(ctx, db, mailer, prefs, period, since)
+	failure := ""
+	if err != nil {
+		failure = err.Error()
+	}
+	if finishErr := dbpkg.FinishDigest(ctx, db, period, status, failure); finishErr != nil {
+		return errors.Join(err, finishErr)
+	}
+	return err
+}
+
+// send builds and sends a claimed digest and returns how it went.
+func send(
+	ctx context.Context,
+	db *sql.DB,
+	mailer Mailer,
+	prefs preferences.Preferences,
+	period dbpkg.DigestPeriod,
+	since time.Time,
+) (dbpkg.DigestStatus, error) {
+	var changes, matches []dbpkg.ProductChange
+	if since.Before(period.End) {
+		var err error
+		changes, err = dbpkg.ListProductChangesForUserBetween(ctx, db, period.UserID, since, period.End)
+		if err != nil {
+			return dbpkg.DigestFailed, err
+		}
+		matches, err = dbpkg.ListWatchMatchesForUserBetween(ctx, db, period.UserID, since, period.End)
+		if err != nil {
+			return dbpkg.DigestFailed, err
+		}
+	}
+
+	d := Build(changes, matches)
+	if d.Empty() {
+		return dbpkg.DigestSkipped, nil
+	}
+	d.Frequency, d.Since, d.Until = prefs.Digest, since, period.End
+
+	m, err := Render(d, prefs)
+	if err != nil {
+		return dbpkg.DigestFailed, err
+	}
+	m.To = prefs.Email
+	m.ID = fmt.Sprintf("digest.%s.%s.%d@olx-tracker", period.UserID, period.Frequency, period.Start.Unix())
+
+	if err := mailer.Send(ctx, m); err != nil {
+		return dbpkg.DigestFailed, err
+	}
+	slog.InfoContext(ctx, "digest sent", "user_id", period.UserID, "frequency", period.Frequency, "since", since)
+	return dbpkg.DigestSent, nil
+}
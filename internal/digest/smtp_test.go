@@ -0,0 +1,129 @@
+package digest
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP accepts a single message without TLS or authentication and
+// returns it with its envelope.
+func fakeSMTP(t *testing.T) (addr string, received <-chan []string) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	ch := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		c := textproto.NewConn(conn)
+
+		var got []string
+		c.PrintfLine("220 localhost ready")
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				return
+			}
+			switch verb, _, _ := strings.Cut(line, " "); strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				c.PrintfLine("250 localhost")
+			case "MAIL", "RCPT":
+				got = append(got, line)
+				c.PrintfLine("250 ok")
+			case "DATA":
+				c.PrintfLine("354 go ahead")
+				data, err := io.ReadAll(c.DotReader())
+				if err != nil {
+					return
+				}
+				got = append(got, string(data))
+				c.PrintfLine("250 queued")
+			case "QUIT":
+				c.PrintfLine("221 bye")
+				ch <- got
+				return
+			default:
+				c.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+
+	return l.Addr().String(), ch
+}
+
+func TestSMTPSend(t *testing.T) {
+	addr, received := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := SMTP{Host: host, Port: portNumber, From: "tracker@example.com"}
+
+	m := Message{
+		ID:      "digest.1@olx-tracker",
+		To:      "ana@example.com",
+		Subject: "Your daily OLX Tracker digest: 1 price drop",
+		Text:    "Mouse: 500,00 lei → 400,00 lei\n",
+		HTML:    "<p>Mouse: 500,00 lei → <strong>400,00 lei</strong></p>\n",
+	}
+	if err := s.Send(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-received
+	if len(got) != 3 || got[0] != "MAIL FROM:<tracker@example.com>" || got[1] != "RCPT TO:<ana@example.com>" {
+		t.Fatalf("unexpected envelope: %q", got)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(got[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != m.Subject {
+		t.Errorf("subject = %q, %v", subject, err)
+	}
+	if msg.Header.Get("Message-ID") != "<digest.1@olx-tracker>" || msg.Header.Get("To") != m.To {
+		t.Errorf("unexpected headers: %v", msg.Header)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type = %q, %v", mediaType, err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for _, want := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		// the reader decodes quoted-printable parts
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part.Header.Get("Content-Type") != want.contentType || string(body) != want.body {
+			t.Errorf("got part %q %q, want %q %q", part.Header.Get("Content-Type"), body, want.contentType, want.body)
+		}
+	}
+}
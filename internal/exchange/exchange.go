@@ -0,0 +1,144 @@
+// Package exchange converts prices between currencies at the reference
+// rates central banks publish every working day, so ads in RON, EUR and
+// other currencies can be compared. A price is converted at the rate of the
+// day it was seen at. Like package money, it never goes through a float.
+package exchange
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"time"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+)
+
+// ErrNoRate is returned when there is no rate to convert between two
+// currencies on a day, e.g. before the first imported rate.
+var ErrNoRate = errors.New("no exchange rate")
+
+type pair struct {
+	currency, quote string
+}
+
+type dayRate struct {
+	day  time.Time
+	rate *big.Rat
+}
+
+// Rates converts between currencies. A nil *Rates only "converts" prices to
+// their own currency.
+type Rates struct {
+	// pairs are oldest first
+	pairs map[pair][]dayRate
+	// currencies are all currencies with a rate, sorted, through which
+	// prices are converted when there is no rate between two currencies
+	currencies []string
+}
+
+// New indexes rates, e.g. the ones returned by db.ListExchangeRates.
+func New(rates []dbpkg.ExchangeRate) (*Rates, error) {
+	r := &Rates{pairs: make(map[pair][]dayRate)}
+	for _, rate := range rates {
+		value, ok := new(big.Rat).SetString(rate.Rate)
+		if !ok || value.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid rate %q of %s in %s", rate.Rate, rate.Currency, rate.Quote)
+		}
+		p := pair{rate.Currency, rate.Quote}
+		r.pairs[p] = append(r.pairs[p], dayRate{day: day(rate.Day), rate: value})
+		r.currencies = append(r.currencies, rate.Currency, rate.Quote)
+	}
+	for _, days := range r.pairs {
+		slices.SortFunc(days, func(a, b dayRate) int { return a.day.Compare(b.day) })
+	}
+	slices.Sort(r.currencies)
+	r.currencies = slices.Compact(r.currencies)
+	return r, nil
+}
+
+// Load loads every stored rate.
+func Load(ctx context.Context, db *sql.DB) (*Rates, error) {
+	rates, err := dbpkg.ListExchangeRates(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return New(rates)
+}
+
+// Convert converts a price in small units from one currency to another, at
+// the latest rates published on or before the day of at. Prices are
+// converted through a third currency if there is no rate between the two,
+// e.g. from USD to RON through EUR with the ECB rates. The result is rounded
+// to the nearest small unit.
+func (r *Rates) Convert(smallUnit int64, from, to string, at time.Time) (int64, error) {
+	if from == to {
+		return smallUnit, nil
+	}
+	if r == nil {
+		return 0, fmt.Errorf("%w from %s to %s", ErrNoRate, from, to)
+	}
+
+	d := day(at)
+	for _, via := range append([]string{to, from}, r.currencies...) {
+		fromPrice, ok := r.price(from, via, d)
+		if !ok {
+			continue
+		}
+		toPrice, ok := r.price(to, via, d)
+		if !ok {
+			continue
+		}
+		amount := new(big.Rat).SetInt64(smallUnit)
+		amount.Mul(amount, fromPrice)
+		amount.Quo(amount, toPrice)
+		return round(amount), nil
+	}
+	return 0, fmt.Errorf("%w from %s to %s on %s", ErrNoRate, from, to, d.Format(time.DateOnly))
+}
+
+// price returns the price of one unit of currency in quote on a day.
+func (r *Rates) price(currency, quote string, d time.Time) (*big.Rat, bool) {
+	if currency == quote {
+		return big.NewRat(1, 1), true
+	}
+	if rate, ok := r.lookup(pair{currency, quote}, d); ok {
+		return rate, true
+	}
+	if rate, ok := r.lookup(pair{quote, currency}, d); ok {
+		return new(big.Rat).Inv(rate), true
+	}
+	return nil, false
+}
+
+// lookup returns the latest rate of a pair on or before a day.
+func (r *Rates) lookup(p pair, d time.Time) (*big.Rat, bool) {
+	days := r.pairs[p]
+	i := sort.Search(len(days), func(i int) bool { return days[i].day.After(d) })
+	if i == 0 {
+		return nil, false
+	}
+	return days[i-1].rate, true
+}
+
+// day truncates t to its day in UTC, which is how rates are dated.
+func day(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// round rounds half away from zero.
+func round(x *big.Rat) int64 {
+	num := new(big.Int).Abs(x.Num())
+	q, rem := new(big.Int).QuoRem(num, x.Denom(), new(big.Int))
+	if rem.Lsh(rem, 1).Cmp(x.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if x.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
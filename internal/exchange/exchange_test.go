@@ -0,0 +1,129 @@
+package exchange
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+)
+
+func parseFile(t *testing.T, name string) (string, []dbpkg.ExchangeRate) {
+	t.Helper()
+
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	source, rates, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source, rates
+}
+
+func TestParse(t *testing.T) {
+	day := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+
+	source, rates := parseFile(t, "ecb.xml")
+	if source != SourceECB || len(rates) != 6 {
+		t.Fatalf("got %d %s rates", len(rates), source)
+	}
+	want := dbpkg.ExchangeRate{Currency: "EUR", Quote: "USD", Day: day, Rate: "1.1650"}
+	if rates[0] != want {
+		t.Errorf("got %+v, want %+v", rates[0], want)
+	}
+
+	source, rates = parseFile(t, "bnr.xml")
+	if source != SourceBNR || len(rates) != 3 {
+		t.Fatalf("got %d %s rates", len(rates), source)
+	}
+	want = dbpkg.ExchangeRate{Currency: "HUF", Quote: "RON", Day: day, Rate: "0.013036"}
+	if rates[1] != want {
+		t.Errorf("the multiplier should be applied, got %+v", rates[1])
+	}
+
+	for _, doc := range []string{
+		`<html><body>Not found</body></html>`,
+		`not xml`,
+		`<DataSet><Body><OrigCurrency>RON</OrigCurrency><Cube date="2026-10-16"><Rate currency="EUR">-5</Rate></Cube></Body></DataSet>`,
+		`<DataSet><Body><OrigCurrency>RON</OrigCurrency></Body></DataSet>`,
+	} {
+		if _, _, err := Parse(strings.NewReader(doc)); err == nil {
+			t.Errorf("expected %q to be rejected", doc)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	_, ecb := parseFile(t, "ecb.xml")
+	rates, err := New(ecb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	friday := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		smallUnit int64
+		from, to  string
+		at        time.Time
+		want      int64
+	}{
+		{"same currency", 44950, "RON", "RON", friday, 44950},
+		{"from the base", 10000, "EUR", "RON", friday, 50850},
+		{"to the base", 50850, "RON", "EUR", friday, 10000},
+		{"through the base", 100000, "RON", "USD", friday, 22911},
+		{"older rate", 10000, "EUR", "RON", friday.AddDate(0, 0, -1), 50800},
+		// rates aren't published on weekends
+		{"latest rate before the day", 10000, "EUR", "RON", friday.AddDate(0, 0, 2), 50850},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rates.Convert(tt.smallUnit, tt.from, tt.to, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := rates.Convert(100, "EUR", "RON", friday.AddDate(0, 0, -2)); !errors.Is(err, ErrNoRate) {
+		t.Errorf("converting before the first rate should fail, got %v", err)
+	}
+	if _, err := rates.Convert(100, "EUR", "GBP", friday); !errors.Is(err, ErrNoRate) {
+		t.Errorf("converting to an unknown currency should fail, got %v", err)
+	}
+
+	var none *Rates
+	if got, err := none.Convert(100, "RON", "RON", friday); err != nil || got != 100 {
+		t.Errorf("nil rates should convert to the same currency, got %d, %v", got, err)
+	}
+	if _, err := none.Convert(100, "RON", "EUR", friday); !errors.Is(err, ErrNoRate) {
+		t.Errorf("nil rates shouldn't convert, got %v", err)
+	}
+}
+
+func TestConvertBetweenSources(t *testing.T) {
+	_, ecb := parseFile(t, "ecb.xml")
+	_, bnr := parseFile(t, "bnr.xml")
+	rates, err := New(append(ecb, bnr...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the direct BNR rate wins over going through EUR
+	got, err := rates.Convert(10000, "USD", "RON", time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 43650 {
+		t.Errorf("got %d, want 43650", got)
+	}
+}
@@ -0,0 +1,235 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+)
+
+// The formats of the reference rates Parse understands.
+const (
+	// SourceECB rates are in EUR, e.g.
+	// https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml or the
+	// whole history in eurofxref-hist.xml.
+	SourceECB = "ecb"
+	// SourceBNR rates are in RON, e.g. https://www.bnr.ro/nbrfxrates.xml or
+	// the rates of a year in https://www.bnr.ro/files/xml/years/nbrfxrates2026.xml.
+	SourceBNR = "bnr"
+)
+
+// DefaultURL is where rates are fetched from when no other url is
+// configured.
+const DefaultURL = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+
+// maxDocumentSize fits the whole history of the ECB rates.
+const maxDocumentSize = 32 << 20
+
+// rateDecimals is how many decimals rates are stored with when they have
+// to be divided, e.g. by the multiplier of the BNR rates.
+const rateDecimals = 12
+
+var ErrUnknownFormat = errors.New("not an ECB or BNR reference rates document")
+
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+type bnrDataSet struct {
+	OrigCurrency string `xml:"Body>OrigCurrency"`
+	Days         []struct {
+		Date  string `xml:"date,attr"`
+		Rates []struct {
+			Currency   string `xml:"currency,attr"`
+			Multiplier string `xml:"multiplier,attr"`
+			Value      string `xml:",chardata"`
+		} `xml:"Rate"`
+	} `xml:"Body>Cube"`
+}
+
+// Parse parses a document of ECB or BNR reference rates and returns which
+// of them it is, see SourceECB and SourceBNR.
+func Parse(r io.Reader) (source string, _ []dbpkg.ExchangeRate, err error) {
+	doc, err := io.ReadAll(io.LimitReader(r, maxDocumentSize+1))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read rates: %w", err)
+	}
+	if len(doc) > maxDocumentSize {
+		return "", nil, fmt.Errorf("rates document is larger than %d bytes", maxDocumentSize)
+	}
+
+	root, err := rootElement(doc)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var rates []dbpkg.ExchangeRate
+	switch root {
+	case "Envelope":
+		source = SourceECB
+		rates, err = parseECB(doc)
+	case "DataSet":
+		source = SourceBNR
+		rates, err = parseBNR(doc)
+	default:
+		return "", nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid %s rates: %w", source, err)
+	}
+	if len(rates) == 0 {
+		return "", nil, fmt.Errorf("no %s rates in the document", source)
+	}
+	return source, rates, nil
+}
+
+func rootElement(doc []byte) (string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", ErrUnknownFormat
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+func parseECB(doc []byte) ([]dbpkg.ExchangeRate, error) {
+	var envelope ecbEnvelope
+	if err := xml.Unmarshal(doc, &envelope); err != nil {
+		return nil, err
+	}
+
+	var rates []dbpkg.ExchangeRate
+	for _, d := range envelope.Days {
+		day, err := time.Parse(time.DateOnly, d.Time)
+		if err != nil {
+			return nil, fmt.Errorf("invalid day %q", d.Time)
+		}
+		for _, r := range d.Rates {
+			rate, err := parseRate(r.Rate, "")
+			if err != nil {
+				return nil, fmt.Errorf("%s on %s: %w", r.Currency, d.Time, err)
+			}
+			if !ValidCurrency(r.Currency) {
+				return nil, fmt.Errorf("invalid currency %q", r.Currency)
+			}
+			// one euro costs rate units of the currency
+			rates = append(rates, dbpkg.ExchangeRate{Currency: "EUR", Quote: r.Currency, Day: day, Rate: rate})
+		}
+	}
+	return rates, nil
+}
+
+func parseBNR(doc []byte) ([]dbpkg.ExchangeRate, error) {
+	var dataSet bnrDataSet
+	if err := xml.Unmarshal(doc, &dataSet); err != nil {
+		return nil, err
+	}
+	quote := strings.TrimSpace(dataSet.OrigCurrency)
+	if !ValidCurrency(quote) {
+		return nil, fmt.Errorf("invalid currency %q", quote)
+	}
+
+	var rates []dbpkg.ExchangeRate
+	for _, d := range dataSet.Days {
+		day, err := time.Parse(time.DateOnly, d.Date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid day %q", d.Date)
+		}
+		for _, r := range d.Rates {
+			rate, err := parseRate(r.Value, r.Multiplier)
+			if err != nil {
+				return nil, fmt.Errorf("%s on %s: %w", r.Currency, d.Date, err)
+			}
+			if !ValidCurrency(r.Currency) {
+				return nil, fmt.Errorf("invalid currency %q", r.Currency)
+			}
+			// multiplier units of the currency cost value lei
+			rates = append(rates, dbpkg.ExchangeRate{Currency: r.Currency, Quote: quote, Day: day, Rate: rate})
+		}
+	}
+	return rates, nil
+}
+
+// parseRate checks that a rate is a positive decimal number and divides it
+// by the multiplier, if any.
+func parseRate(value, multiplier string) (string, error) {
+	value = strings.TrimSpace(value)
+	whole, frac, hasFrac := strings.Cut(value, ".")
+	if whole == "" || !digits(whole) || (hasFrac && (frac == "" || !digits(frac))) {
+		return "", fmt.Errorf("invalid rate %q", value)
+	}
+	rate, _ := new(big.Rat).SetString(value)
+	if rate.Sign() <= 0 {
+		return "", fmt.Errorf("invalid rate %q", value)
+	}
+	if multiplier == "" {
+		return value, nil
+	}
+
+	m, err := strconv.ParseInt(multiplier, 10, 64)
+	if err != nil || m <= 0 {
+		return "", fmt.Errorf("invalid multiplier %q", multiplier)
+	}
+	rate.Quo(rate, big.NewRat(m, 1))
+	return strings.TrimRight(strings.TrimRight(rate.FloatString(rateDecimals), "0"), "."), nil
+}
+
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidCurrency tells whether currency is an ISO 4217 code, e.g. "RON".
+func ValidCurrency(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+	for _, c := range currency {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Fetch downloads and parses a document of reference rates, see Parse.
+func Fetch(ctx context.Context, client *http.Client, url string) (string, []dbpkg.ExchangeRate, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("rates request responded with status %d", resp.StatusCode)
+	}
+	return Parse(resp.Body)
+}
@@ -0,0 +1,296 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/exchange"
+	"github.com/Ozoniuss/olx-tracker/internal/money"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatJSON   Format = "json"
+	FormatNDJSON Format = "ndjson"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatCSV, FormatJSON, FormatNDJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported export format %q", s)
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/json"
+	}
+}
+
+// Options tune what is exported.
+type Options struct {
+	// IncludeRawJSON adds the raw JSON-LD of every snapshot.
+	IncludeRawJSON bool
+	// Currency, if set, adds the price of every snapshot converted to it with
+	// Rates, at the rate of the day the snapshot was retrieved. Snapshots
+	// without a rate for that day are exported without a converted price.
+	Currency string
+	Rates    *exchange.Rates
+	// Location is the time zone times are written in, UTC if nil. Prices are
+	// always written as plain decimals whatever the locale of the user, so
+	// exports stay easy to parse.
+	Location *time.Location
+}
+
+// Encoder writes export rows one at a time. Close must be called after the
+// last row to terminate the document.
+type Encoder interface {
+	Encode(dbpkg.ExportRow) error
+	Close() error
+}
+
+func NewEncoder(w io.Writer, format Format, opts Options) Encoder {
+	switch format {
+	case FormatCSV:
+		return &csvEncoder{w: csv.NewWriter(w), opts: opts}
+	case FormatNDJSON:
+		return &ndjsonEncoder{enc: json.NewEncoder(w), opts: opts}
+	default:
+		return &jsonEncoder{w: w, opts: opts}
+	}
+}
+
+// WriteForUser streams the whole tracking history of a user to w. The stored
+// exchange rates are loaded if a currency is set without rates.
+func WriteForUser(
+	ctx context.Context,
+	db *sql.DB,
+	w io.Writer,
+	userID uuid.UUID,
+	format Format,
+	opts Options,
+) error {
+	if opts.Currency != "" && opts.Rates == nil {
+		rates, err := exchange.Load(ctx, db)
+		if err != nil {
+			return err
+		}
+		opts.Rates = rates
+	}
+
+	enc := NewEncoder(w, format, opts)
+	if err := dbpkg.StreamExportRowsForUser(ctx, db, userID, opts.IncludeRawJSON, enc.Encode); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// record is the exported shape of a row. Prices are in major units and kept
+// as decimal strings, so they don't go through a float. PriceKind tells how
+// to read them: a range goes from Price to HighPrice, a price on request has
+// no price at all.
+type record struct {
+	ProductID    string      `json:"product_id"`
+	URL          string      `json:"url"`
+	TrackedAt    time.Time   `json:"tracked_at"`
+	Version      int         `json:"version,omitempty"`
+	RetrievedAt  *time.Time  `json:"retrieved_at,omitempty"`
+	Name         string      `json:"name,omitempty"`
+	Price        json.Number `json:"price,omitempty"`
+	HighPrice    json.Number `json:"high_price,omitempty"`
+	PriceKind    string      `json:"price_kind,omitempty"`
+	Currency     string      `json:"currency,omitempty"`
+	Availability string      `json:"availability,omitempty"`
+	// ConvertedPrice is the price in ConvertedCurrency, see Options.Currency.
+	ConvertedPrice    json.Number     `json:"converted_price,omitempty"`
+	ConvertedCurrency string          `json:"converted_currency,omitempty"`
+	RawJSON           json.RawMessage `json:"raw_json,omitempty"`
+}
+
+func newRecord(row dbpkg.ExportRow, opts Options) record {
+	loc := opts.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	r := record{
+		ProductID: row.ProductID.String(),
+		URL:       row.URL,
+		TrackedAt: row.TrackedAt.In(loc),
+	}
+	if row.Version == 0 {
+		return r
+	}
+
+	retrievedAt := row.RetrievedAt.In(loc)
+	r.Version = row.Version
+	r.RetrievedAt = &retrievedAt
+	r.Name = row.Name
+	r.PriceKind = row.PriceKind
+	if productpkg.PriceKind(row.PriceKind) != productpkg.PriceOnRequest {
+		r.Price = json.Number(money.MajorUnits(row.PriceSmallUnit))
+	}
+	if row.HighPriceSmallUnit.Valid {
+		r.HighPrice = json.Number(money.MajorUnits(row.HighPriceSmallUnit.Int64))
+	}
+	r.Currency = row.Currency
+	r.Availability = row.Availability
+	// only a single price converts to a single price
+	if opts.Currency != "" && productpkg.PriceKind(row.PriceKind) == productpkg.PriceFixed {
+		if converted, err := opts.Rates.Convert(row.PriceSmallUnit, row.Currency, opts.Currency, row.RetrievedAt); err == nil {
+			r.ConvertedPrice = json.Number(money.MajorUnits(converted))
+			r.ConvertedCurrency = opts.Currency
+		}
+	}
+	if opts.IncludeRawJSON && len(row.RawJSON) > 0 {
+		r.RawJSON = row.RawJSON
+	}
+	return r
+}
+
+var csvHeader = []string{
+	"product_id",
+	"url",
+	"tracked_at",
+	"version",
+	"retrieved_at",
+	"name",
+	"price",
+	"currency",
+	"availability",
+	"price_kind",
+	"high_price",
+}
+
+type csvEncoder struct {
+	w           *csv.Writer
+	opts        Options
+	wroteHeader bool
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if e.wroteHeader {
+		return nil
+	}
+	e.wroteHeader = true
+
+	header := slices.Clip(csvHeader)
+	if e.opts.Currency != "" {
+		header = append(header, "converted_price", "converted_currency")
+	}
+	if e.opts.IncludeRawJSON {
+		header = append(header, "raw_json")
+	}
+	return e.w.Write(header)
+}
+
+func (e *csvEncoder) Encode(row dbpkg.ExportRow) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	r := newRecord(row, e.opts)
+	fields := []string{
+		r.ProductID,
+		r.URL,
+		r.TrackedAt.Format(time.RFC3339),
+		"",
+		"",
+		r.Name,
+		string(r.Price),
+		r.Currency,
+		r.Availability,
+		r.PriceKind,
+		string(r.HighPrice),
+	}
+	if r.Version != 0 {
+		fields[3] = strconv.Itoa(r.Version)
+		fields[4] = r.RetrievedAt.Format(time.RFC3339)
+	}
+	if e.opts.Currency != "" {
+		fields = append(fields, string(r.ConvertedPrice), r.ConvertedCurrency)
+	}
+	if e.opts.IncludeRawJSON {
+		fields = append(fields, string(r.RawJSON))
+	}
+
+	return e.w.Write(fields)
+}
+
+func (e *csvEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonEncoder struct {
+	enc  *json.Encoder
+	opts Options
+}
+
+func (e *ndjsonEncoder) Encode(row dbpkg.ExportRow) error {
+	return e.enc.Encode(newRecord(row, e.opts))
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
+
+// jsonEncoder writes a pretty printed array, element by element, so the
+// whole export never has to be held in memory.
+type jsonEncoder struct {
+	w     io.Writer
+	opts  Options
+	count int
+}
+
+func (e *jsonEncoder) Encode(row dbpkg.ExportRow) error {
+	sep := ",\n  "
+	if e.count == 0 {
+		sep = "[\n  "
+	}
+
+	b, err := json.MarshalIndent(newRecord(row, e.opts), "  ", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(e.w, sep); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(b); err != nil {
+		return err
+	}
+
+	e.count++
+	return nil
+}
+
+func (e *jsonEncoder) Close() error {
+	closing := "\n]\n"
+	if e.count == 0 {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(e.w, closing)
+	return err
+}
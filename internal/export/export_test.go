@@ -0,0 +1,191 @@
+package export
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/exchange"
+)
+
+func testRows() []dbpkg.ExportRow {
+	productID := uuid.MustParse("5b0b3a9e-8f0e-4a43-9d2e-7c1f4f1e2a10")
+	trackedAt := time.Date(2026, 1, 31, 16, 0, 0, 0, time.UTC)
+
+	return []dbpkg.ExportRow{
+		{
+			ProductID:      productID,
+			URL:            "https://www.olx.ro/d/oferta/mouse-IDkbEDA.html",
+			TrackedAt:      trackedAt,
+			Version:        1,
+			RetrievedAt:    trackedAt.Add(time.Minute),
+			Name:           "Mouse, gaming",
+			PriceSmallUnit: 44950,
+			PriceKind:      "fixed",
+			Currency:       "RON",
+			Availability:   "https://schema.org/InStock",
+			RawJSON:        []byte(`{"price":449.5}`),
+		},
+		{
+			ProductID: uuid.MustParse("0d7e6c61-3c8b-4a57-8f5d-2a4a0c9b1e22"),
+			URL:       "https://www.olx.ro/d/oferta/never-fetched.html",
+			TrackedAt: trackedAt,
+		},
+	}
+}
+
+func encodeAll(t *testing.T, format Format, opts Options, rows []dbpkg.ExportRow) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, format, opts)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestCSV(t *testing.T) {
+	got := encodeAll(t, FormatCSV, Options{}, testRows())
+	want := `product_id,url,tracked_at,version,retrieved_at,name,price,currency,availability,price_kind,high_price
+5b0b3a9e-8f0e-4a43-9d2e-7c1f4f1e2a10,https://www.olx.ro/d/oferta/mouse-IDkbEDA.html,2026-01-31T16:00:00Z,1,2026-01-31T16:01:00Z,"Mouse, gaming",449.50,RON,https://schema.org/InStock,fixed,
+0d7e6c61-3c8b-4a57-8f5d-2a4a0c9b1e22,https://www.olx.ro/d/oferta/never-fetched.html,2026-01-31T16:00:00Z,,,,,,,,
+`
+	if got != want {
+		t.Errorf("unexpected csv:\n%s\nwant:\n%s", got, want)
+	}
+
+	withRaw := encodeAll(t, FormatCSV, Options{IncludeRawJSON: true}, testRows())
+	if !strings.HasSuffix(strings.SplitN(withRaw, "\n", 2)[0], ",raw_json") {
+		t.Errorf("expected raw_json column in header: %s", withRaw)
+	}
+
+	if empty := encodeAll(t, FormatCSV, Options{}, nil); !strings.HasPrefix(empty, "product_id,") {
+		t.Errorf("expected header even without rows, got %q", empty)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	got := encodeAll(t, FormatNDJSON, Options{IncludeRawJSON: true}, testRows())
+	lines := strings.Split(strings.TrimSpace(got), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per row, got %d:\n%s", len(lines), got)
+	}
+
+	var first map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if first["price"] != 449.5 || first["currency"] != "RON" || first["version"] != 1.0 {
+		t.Errorf("unexpected first record: %v", first)
+	}
+	if raw, ok := first["raw_json"].(map[string]any); !ok || raw["price"] != 449.5 {
+		t.Errorf("expected raw_json to be embedded as an object: %v", first["raw_json"])
+	}
+
+	var second map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := second["price"]; ok {
+		t.Errorf("product without snapshot should have no price: %v", second)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	got := encodeAll(t, FormatJSON, Options{}, testRows())
+
+	var records []map[string]any
+	if err := json.Unmarshal([]byte(got), &records); err != nil {
+		t.Fatalf("invalid json array: %v\n%s", err, got)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if _, ok := records[0]["raw_json"]; ok {
+		t.Errorf("raw_json should be omitted unless requested")
+	}
+
+	if empty := encodeAll(t, FormatJSON, Options{}, nil); empty != "[]\n" {
+		t.Errorf("expected empty array, got %q", empty)
+	}
+}
+
+func TestConvertedPrices(t *testing.T) {
+	rates, err := exchange.New([]dbpkg.ExchangeRate{
+		{Currency: "EUR", Quote: "RON", Day: time.Date(2026, 1, 30, 0, 0, 0, 0, time.UTC), Rate: "5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := testRows()
+	noRate := rows[0]
+	noRate.Currency = "USD"
+
+	got := encodeAll(t, FormatCSV, Options{Currency: "EUR", Rates: rates}, []dbpkg.ExportRow{rows[0], noRate, rows[1]})
+	lines := strings.Split(strings.TrimSpace(got), "\n")
+	if !strings.HasSuffix(lines[0], ",high_price,converted_price,converted_currency") {
+		t.Errorf("expected converted columns in header: %s", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], ",449.50,RON,https://schema.org/InStock,fixed,,89.90,EUR") {
+		t.Errorf("expected the price converted at the rate of the day before: %s", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], ",USD,https://schema.org/InStock,fixed,,,") {
+		t.Errorf("expected no converted price without a rate: %s", lines[2])
+	}
+
+	got = encodeAll(t, FormatNDJSON, Options{Currency: "EUR", Rates: rates}, rows[:1])
+	var record map[string]any
+	if err := json.Unmarshal([]byte(got), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["converted_price"] != 89.9 || record["converted_currency"] != "EUR" {
+		t.Errorf("unexpected record: %v", record)
+	}
+}
+
+func TestPriceKinds(t *testing.T) {
+	rates, err := exchange.New([]dbpkg.ExchangeRate{
+		{Currency: "EUR", Quote: "RON", Day: time.Date(2026, 1, 30, 0, 0, 0, 0, time.UTC), Rate: "5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	onRequest := testRows()[0]
+	onRequest.PriceKind, onRequest.PriceSmallUnit = "on_request", 0
+	priceRange := testRows()[0]
+	priceRange.PriceKind, priceRange.HighPriceSmallUnit = "range", sql.NullInt64{Int64: 52000, Valid: true}
+
+	got := encodeAll(t, FormatCSV, Options{Currency: "EUR", Rates: rates}, []dbpkg.ExportRow{onRequest, priceRange})
+	lines := strings.Split(strings.TrimSpace(got), "\n")
+	if !strings.HasSuffix(lines[1], `"Mouse, gaming",,RON,https://schema.org/InStock,on_request,,,`) {
+		t.Errorf("expected no price on request: %s", lines[1])
+	}
+	// a range isn't converted, its low end alone would be misleading
+	if !strings.HasSuffix(lines[2], `"Mouse, gaming",449.50,RON,https://schema.org/InStock,range,520.00,,`) {
+		t.Errorf("expected both ends of the range: %s", lines[2])
+	}
+}
+
+func TestLocation(t *testing.T) {
+	bucharest, err := time.LoadLocation("Europe/Bucharest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := encodeAll(t, FormatCSV, Options{Location: bucharest}, testRows()[:1])
+	if !strings.Contains(got, ",2026-01-31T18:00:00+02:00,1,2026-01-31T18:01:00+02:00,") {
+		t.Errorf("expected times in the given time zone: %s", got)
+	}
+}
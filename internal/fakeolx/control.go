@@ -0,0 +1,112 @@
+package fakeolx
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// The control API:
+//
+//	GET    /_control/ads       list all ads
+//	GET    /_control/ads/{id}  get an ad, with the number of hits of its page
+//	PUT    /_control/ads/{id}  add or replace an ad
+//	PATCH  /_control/ads/{id}  change only the fields present in the body
+//	DELETE /_control/ads/{id}  remove an ad, its page becomes a soft 404
+
+func (s *Server) handleListAds(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.List())
+}
+
+func (s *Server) handleGetAd(w http.ResponseWriter, r *http.Request) {
+	ad, ok := s.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "ad not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, ad)
+}
+
+func (s *Server) handlePutAd(w http.ResponseWriter, r *http.Request) {
+	var ad Ad
+	if err := json.NewDecoder(r.Body).Decode(&ad); err != nil {
+		http.Error(w, "invalid ad: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ad.ID = r.PathValue("id")
+	ad.Hits = 0
+	if !validStatus(ad.Status) {
+		http.Error(w, errInvalidStatus.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.Put(ad)
+	stored, _ := s.Get(ad.ID)
+	writeJSON(w, http.StatusOK, stored)
+}
+
+// adPatch holds the fields of an ad present in a PATCH body. The id and the
+// hits can't be changed.
+type adPatch struct {
+	Name         *string   `json:"name"`
+	Description  *string   `json:"description"`
+	Category     *string   `json:"category"`
+	Images       *[]string `json:"images"`
+	Price        *float64  `json:"price"`
+	Currency     *string   `json:"currency"`
+	Availability *string   `json:"availability"`
+	Status       *Status   `json:"status"`
+	Delay        *Duration `json:"delay"`
+}
+
+func (p adPatch) apply(ad *Ad) {
+	set(&ad.Name, p.Name)
+	set(&ad.Description, p.Description)
+	set(&ad.Category, p.Category)
+	set(&ad.Images, p.Images)
+	set(&ad.Price, p.Price)
+	set(&ad.Currency, p.Currency)
+	set(&ad.Availability, p.Availability)
+	set(&ad.Status, p.Status)
+	set(&ad.Delay, p.Delay)
+}
+
+func set[T any](field *T, value *T) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+func (s *Server) handlePatchAd(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	// the body is read before taking the lock, so a slow client doesn't
+	// hold up the ad pages
+	var patch adPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "invalid ad: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if patch.Status != nil && !validStatus(*patch.Status) {
+		http.Error(w, errInvalidStatus.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !s.Update(id, patch.apply) {
+		http.Error(w, "ad not found", http.StatusNotFound)
+		return
+	}
+
+	ad, _ := s.Get(id)
+	writeJSON(w, http.StatusOK, ad)
+}
+
+func (s *Server) handleDeleteAd(w http.ResponseWriter, r *http.Request) {
+	s.Delete(r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,290 @@
+// Package fakeolx is a local stand-in for OLX ad pages, for testing the
+// tracker without the network. Ads are programmed through the Go API or the
+// HTTP control API under /_control/, and their price, availability and the
+// way their page responds can be changed at any time.
+package fakeolx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status decides how the page of an ad responds.
+type Status string
+
+const (
+	// StatusActive serves the ad page with its product JSON-LD.
+	StatusActive Status = "active"
+	// StatusGone responds with 410, like OLX does for deactivated ads.
+	StatusGone Status = "gone"
+	// StatusSoft404 responds with 200 and a page that redirects to the 404
+	// page with javascript, without any product JSON-LD.
+	StatusSoft404 Status = "soft-404"
+	// StatusThrottled responds with 429 and a Retry-After header.
+	StatusThrottled Status = "throttled"
+)
+
+var errInvalidStatus = errors.New("status must be one of active, gone, soft-404 or throttled")
+
+func validStatus(s Status) bool {
+	switch s {
+	case "", StatusActive, StatusGone, StatusSoft404, StatusThrottled:
+		return true
+	}
+	return false
+}
+
+// Ad is a programmable ad. Its page is served at AdPath(ID).
+type Ad struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Category    string   `json:"category"`
+	Images      []string `json:"images"`
+	// Price is in major units, as in the JSON-LD of OLX.
+	Price        float64 `json:"price"`
+	Currency     string  `json:"currency"`
+	Availability string  `json:"availability"`
+	Status       Status  `json:"status"`
+	// Delay is waited before responding, to simulate a slow page.
+	Delay Duration `json:"delay"`
+	// Hits counts the requests for the page of the ad.
+	Hits int `json:"hits"`
+}
+
+// Duration is a time.Duration written as a string like "1.5s" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// AdPath returns the path of the page of an ad.
+func AdPath(id string) string {
+	return "/d/oferta/" + id + ".html"
+}
+
+// Server serves the ad pages and the control API.
+type Server struct {
+	mu  sync.Mutex
+	ads map[string]*Ad
+	mux *http.ServeMux
+}
+
+func New() *Server {
+	s := &Server{
+		ads: map[string]*Ad{},
+		mux: http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("GET /d/oferta/{page}", s.handlePage)
+
+	s.mux.HandleFunc("GET /_control/ads", s.handleListAds)
+	s.mux.HandleFunc("GET /_control/ads/{id}", s.handleGetAd)
+	s.mux.HandleFunc("PUT /_control/ads/{id}", s.handlePutAd)
+	s.mux.HandleFunc("PATCH /_control/ads/{id}", s.handlePatchAd)
+	s.mux.HandleFunc("DELETE /_control/ads/{id}", s.handleDeleteAd)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Put adds or replaces an ad. Missing fields get the defaults of an active
+// ad priced in RON.
+func (s *Server) Put(ad Ad) {
+	if ad.Status == "" {
+		ad.Status = StatusActive
+	}
+	if ad.Currency == "" {
+		ad.Currency = "RON"
+	}
+	if ad.Availability == "" {
+		ad.Availability = "InStock"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ads[ad.ID] = &ad
+}
+
+// Update changes an ad in place. It reports false if there is no such ad.
+func (s *Server) Update(id string, fn func(*Ad)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ad, ok := s.ads[id]
+	if ok {
+		fn(ad)
+	}
+	return ok
+}
+
+// Get returns a copy of an ad.
+func (s *Server) Get(id string) (Ad, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ad, ok := s.ads[id]
+	if !ok {
+		return Ad{}, false
+	}
+	return *ad, true
+}
+
+func (s *Server) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ads, id)
+}
+
+// List returns copies of all ads, ordered by id.
+func (s *Server) List() []Ad {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ads := make([]Ad, 0, len(s.ads))
+	for _, ad := range s.ads {
+		ads = append(ads, *ad)
+	}
+	sort.Slice(ads, func(i, j int) bool { return ads[i].ID < ads[j].ID })
+	return ads
+}
+
+func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutSuffix(r.PathValue("page"), ".html")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	stored, found := s.ads[id]
+	var ad Ad
+	if found {
+		stored.Hits++
+		ad = *stored
+	}
+	s.mu.Unlock()
+
+	if !found {
+		// unknown ads behave like the ones that never existed on OLX
+		ad.Status = StatusSoft404
+	}
+
+	if ad.Delay > 0 {
+		select {
+		case <-time.After(time.Duration(ad.Delay)):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	switch ad.Status {
+	case StatusGone:
+		w.WriteHeader(http.StatusGone)
+		goneTemplate.Execute(w, nil)
+	case StatusThrottled:
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	case StatusSoft404:
+		soft404Template.Execute(w, nil)
+	default:
+		// the url in the JSON-LD is the one that was requested, so the
+		// tracker finds the ad it asked for
+		url := fmt.Sprintf("http://%s%s", r.Host, r.URL.Path)
+		jsonLD, err := productJSONLD(ad, url)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		adTemplate.Execute(w, adPage{Ad: ad, JSONLD: template.JS(jsonLD)})
+	}
+}
+
+func productJSONLD(ad Ad, url string) ([]byte, error) {
+	images := ad.Images
+	if images == nil {
+		images = []string{}
+	}
+	return json.Marshal(map[string]any{
+		"@context":    "https://schema.org",
+		"@type":       "Product",
+		"name":        ad.Name,
+		"image":       images,
+		"url":         url,
+		"description": ad.Description,
+		"category":    ad.Category,
+		"sku":         ad.ID,
+		"offers": map[string]any{
+			"@type":         "Offer",
+			"availability":  "https://schema.org/" + ad.Availability,
+			"areaServed":    map[string]any{"@type": "AdministrativeArea", "name": "Sectorul 4"},
+			"priceCurrency": ad.Currency,
+			"price":         ad.Price,
+			"shippingDetails": map[string]any{
+				"@type":               "OfferShippingDetails",
+				"shippingRate":        map[string]any{"@type": "MonetaryAmount", "currency": ad.Currency},
+				"shippingDestination": map[string]any{"@type": "DefinedRegion", "addressCountry": "RO"},
+			},
+			"itemCondition": "https://schema.org/UsedCondition",
+		},
+	})
+}
+
+type adPage struct {
+	Ad     Ad
+	JSONLD template.JS
+}
+
+var (
+	adTemplate = template.Must(template.New("ad").Parse(`<!DOCTYPE html>
+<html lang="ro">
+<head>
+<meta charset="utf-8">
+<title>{{ .Ad.Name }} • OLX.ro</title>
+<script data-rh="true" type="application/ld+json">{{ .JSONLD }}</script>
+</head>
+<body>
+<div id="root"><h1>{{ .Ad.Name }}</h1><h3>{{ .Ad.Price }} {{ .Ad.Currency }}</h3></div>
+</body>
+</html>
+`))
+
+	goneTemplate = template.Must(template.New("gone").Parse(`<!DOCTYPE html>
+<html lang="ro">
+<head><meta charset="utf-8"><title>Anunțul nu mai este disponibil • OLX.ro</title></head>
+<body><h1>Anunțul nu mai este disponibil</h1></body>
+</html>
+`))
+
+	soft404Template = template.Must(template.New("soft-404").Parse(`<!DOCTYPE html>
+<html lang="ro">
+<head>
+<meta charset="utf-8">
+<title>OLX.ro</title>
+<script type="text/javascript">window.location.replace("/404/");</script>
+</head>
+<body><div id="root"></div></body>
+</html>
+`))
+)
@@ -0,0 +1,117 @@
+package fakeolx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+func TestPages(t *testing.T) {
+	fake := New()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	fake.Put(Ad{ID: "mouse", Name: "Mouse", Price: 449.5, Images: []string{"https://example.com/1.jpg"}})
+	url := server.URL + AdPath("mouse")
+	ctx := context.Background()
+
+	p, err := productpkg.FetchProduct(ctx, server.Client(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Mouse" || p.URL != url || p.Offers.PriceSmallUnit != 44950 || p.Offers.PriceCurrency != "RON" {
+		t.Errorf("unexpected product %+v", p)
+	}
+	if p.Offers.Availability != "https://schema.org/InStock" {
+		t.Errorf("got availability %q", p.Offers.Availability)
+	}
+
+	tests := []struct {
+		status Status
+		check  func(error) bool
+	}{
+		{StatusGone, func(err error) bool { return errors.Is(err, productpkg.ErrAdDeactivated) }},
+		{StatusSoft404, func(err error) bool { return errors.Is(err, productpkg.ErrJSONLDNotFound) }},
+		{StatusThrottled, func(err error) bool {
+			var statusErr *productpkg.StatusError
+			return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests
+		}},
+	}
+	for _, tt := range tests {
+		fake.Update("mouse", func(ad *Ad) { ad.Status = tt.status })
+		if _, err := productpkg.FetchProduct(ctx, server.Client(), url); !tt.check(err) {
+			t.Errorf("status %s: unexpected error %v", tt.status, err)
+		}
+	}
+
+	if _, err := productpkg.FetchProduct(ctx, server.Client(), server.URL+AdPath("missing")); !errors.Is(err, productpkg.ErrJSONLDNotFound) {
+		t.Errorf("unknown ad: unexpected error %v", err)
+	}
+
+	if ad, _ := fake.Get("mouse"); ad.Hits != 4 {
+		t.Errorf("got %d hits, want 4", ad.Hits)
+	}
+}
+
+func TestSlowPage(t *testing.T) {
+	fake := New()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	fake.Put(Ad{ID: "slow", Name: "Slow", Delay: Duration(time.Second)})
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+
+	if _, err := productpkg.FetchProduct(context.Background(), client, server.URL+AdPath("slow")); err == nil {
+		t.Error("expected the client to time out")
+	}
+}
+
+func TestControlAPI(t *testing.T) {
+	server := httptest.NewServer(New())
+	defer server.Close()
+
+	do := func(method, path, body string) (*http.Response, Ad) {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var ad Ad
+		json.NewDecoder(resp.Body).Decode(&ad)
+		return resp, ad
+	}
+
+	resp, ad := do(http.MethodPut, "/_control/ads/desk", `{"name":"Desk","price":1199.99}`)
+	if resp.StatusCode != http.StatusOK || ad.ID != "desk" || ad.Status != StatusActive {
+		t.Fatalf("put: %d %+v", resp.StatusCode, ad)
+	}
+
+	resp, ad = do(http.MethodPatch, "/_control/ads/desk", `{"price":999,"availability":"OutOfStock","delay":"2s"}`)
+	if resp.StatusCode != http.StatusOK || ad.Name != "Desk" || ad.Price != 999 || ad.Availability != "OutOfStock" || ad.Delay != Duration(2*time.Second) {
+		t.Errorf("patch: %d %+v", resp.StatusCode, ad)
+	}
+
+	if resp, _ := do(http.MethodPatch, "/_control/ads/desk", `{"status":"exploded"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid status: got %d, want 400", resp.StatusCode)
+	}
+	if resp, _ := do(http.MethodPatch, "/_control/ads/chair", `{"price":1}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown ad: got %d, want 404", resp.StatusCode)
+	}
+
+	do(http.MethodDelete, "/_control/ads/desk", "")
+	if resp, _ := do(http.MethodGet, "/_control/ads/desk", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleted ad: got %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,204 @@
+// Package feed renders the changes of tracked products as Atom feeds, so
+// they can be followed from any feed reader.
+package feed
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/money"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+	"github.com/Ozoniuss/olx-tracker/internal/risk"
+)
+
+// Signer hands out and checks the tokens embedded in feed urls. Feed
+// readers can't log in, so the token is what authenticates the request. It
+// is an HMAC over the user and product, so no state has to be stored.
+type Signer struct {
+	secret []byte
+}
+
+func NewSigner(secret string) Signer {
+	return Signer{secret: []byte(secret)}
+}
+
+// Token signs the feed of a user, or of a single product of the user when
+// productID is valid.
+func (s Signer) Token(userID uuid.UUID, productID uuid.NullUUID) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("feed:" + userID.String()))
+	if productID.Valid {
+		mac.Write([]byte(":" + productID.UUID.String()))
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s Signer) Valid(userID uuid.UUID, productID uuid.NullUUID, token string) bool {
+	return hmac.Equal([]byte(s.Token(userID, productID)), []byte(token))
+}
+
+const atomNS = "http://www.w3.org/2005/Atom"
+
+type Feed struct {
+	XMLName xml.Name `xml:"feed"`
+	NS      string   `xml:"xmlns,attr"`
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Author  Author   `xml:"author"`
+	Links   []Link   `xml:"link"`
+	Entries []Entry  `xml:"entry"`
+}
+
+type Author struct {
+	Name string `xml:"name"`
+}
+
+type Link struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type Entry struct {
+	ID      string `xml:"id"`
+	Title   string `xml:"title"`
+	Updated string `xml:"updated"`
+	Link    Link   `xml:"link"`
+	Content Text   `xml:"content"`
+}
+
+type Text struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// New builds a feed out of changes, which are expected newest first. Prices
+// are written in the locale of the user.
+func New(id, title, selfURL string, changes []dbpkg.ProductChange, locale money.Locale) *Feed {
+	updated := time.Now()
+	if len(changes) > 0 {
+		updated = changes[0].At
+	}
+
+	f := &Feed{
+		NS:      atomNS,
+		ID:      id,
+		Title:   title,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Author:  Author{Name: "OLX Tracker"},
+		Links:   []Link{{Rel: "self", Href: selfURL}},
+	}
+	for _, c := range changes {
+		f.Entries = append(f.Entries, newEntry(c, locale))
+	}
+	return f
+}
+
+// Marshal returns the feed as an XML document.
+func (f *Feed) Marshal() ([]byte, error) {
+	b, err := xml.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func newEntry(c dbpkg.ProductChange, locale money.Locale) Entry {
+	id := fmt.Sprintf("tag:olx-tracker,2026:product/%s/version/%d", c.ProductID, c.Version)
+	switch c.Kind {
+	case dbpkg.ChangeDeactivated:
+		id = fmt.Sprintf("tag:olx-tracker,2026:product/%s/deactivated", c.ProductID)
+	case dbpkg.ChangeWatchMatch:
+		id = fmt.Sprintf("tag:olx-tracker,2026:watch/%s/product/%s", c.WatchRuleID, c.ProductID)
+	}
+
+	price := productpkg.FormatPrice(locale, productpkg.PriceKind(c.PriceKind), c.PriceSmallUnit, c.HighPriceSmallUnit, c.Currency)
+	previousPrice := productpkg.FormatPrice(locale, productpkg.PriceKind(c.PreviousPriceKind), c.PreviousPriceSmallUnit, c.PreviousHighPriceSmallUnit, c.PreviousCurrency)
+
+	var title string
+	lines := []string{c.Name}
+	switch c.Kind {
+	case dbpkg.ChangeTracked:
+		title = fmt.Sprintf("Now tracking: %s %s", c.Name, atPrice(c.PriceKind, price))
+		lines = append(lines, "Price: "+price)
+	case dbpkg.ChangePrice:
+		title = fmt.Sprintf("%s: %s, %s → %s", priceDirection(c), c.Name, previousPrice, price)
+		lines = append(lines, "Old price: "+previousPrice, "New price: "+price)
+	case dbpkg.ChangePriceTerms:
+		title = fmt.Sprintf("Price changed: %s, %s → %s", c.Name, previousPrice, price)
+		lines = append(lines, "Old price: "+previousPrice, "New price: "+price)
+	case dbpkg.ChangeAvailability:
+		title = fmt.Sprintf("%s is now %s", c.Name, availabilityName(c.Availability))
+		lines = append(lines, "Price: "+price)
+	case dbpkg.ChangeDeactivated:
+		title = fmt.Sprintf("Ad removed: %s", c.Name)
+		lines = append(lines, "Last price: "+price)
+	case dbpkg.ChangeWatchMatch:
+		title = fmt.Sprintf("New match for %q: %s %s", c.WatchRule, c.Name, atPrice(c.PriceKind, price))
+		lines = append(lines, "Price: "+price, "Watch rule: "+c.WatchRule)
+	}
+	if c.Kind != dbpkg.ChangeTracked && c.Kind != dbpkg.ChangeWatchMatch && c.Availability != c.PreviousAvailability {
+		lines = append(lines, fmt.Sprintf("Availability: %s → %s",
+			availabilityName(c.PreviousAvailability), availabilityName(c.Availability)))
+	}
+	if c.Kind != dbpkg.ChangeDeactivated && c.RiskScore >= risk.WarnScore {
+		title = "Possible scam! " + title
+		lines = append(lines, fmt.Sprintf("Risk score: %d/100", c.RiskScore))
+		for _, r := range c.RiskReasons {
+			lines = append(lines, "- "+r.Detail)
+		}
+	}
+	lines = append(lines, c.URL)
+
+	return Entry{
+		ID:      id,
+		Title:   title,
+		Updated: c.At.UTC().Format(time.RFC3339),
+		Link:    Link{Rel: "alternate", Href: c.URL},
+		Content: Text{Type: "text", Body: strings.Join(lines, "\n")},
+	}
+}
+
+// atPrice reads after the name of an ad, e.g. "at 449.00 RON" or "with the
+// price on request".
+func atPrice(kind, price string) string {
+	switch productpkg.PriceKind(kind) {
+	case productpkg.PriceOnRequest:
+		return "with the price on request"
+	case productpkg.PriceFree:
+		return "for free"
+	default:
+		return "at " + price
+	}
+}
+
+func priceDirection(c dbpkg.ProductChange) string {
+	switch {
+	case c.Currency != c.PreviousCurrency:
+		return "Price changed"
+	case c.PriceSmallUnit < c.PreviousPriceSmallUnit:
+		return "Price drop"
+	default:
+		return "Price increase"
+	}
+}
+
+// availabilityName strips the schema.org prefix OLX uses, e.g.
+// "https://schema.org/InStock" becomes "InStock".
+func availabilityName(availability string) string {
+	if availability == "" {
+		return "unknown"
+	}
+	if i := strings.LastIndex(availability, "/"); i >= 0 {
+		return availability[i+1:]
+	}
+	return availability
+}
@@ -0,0 +1,228 @@
+package feed
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/money"
+)
+
+func TestSigner(t *testing.T) {
+	userID := uuid.New()
+	productID := uuid.NullUUID{UUID: uuid.New(), Valid: true}
+
+	signer := NewSigner("secret")
+	userToken := signer.Token(userID, uuid.NullUUID{})
+	productToken := signer.Token(userID, productID)
+
+	if !signer.Valid(userID, uuid.NullUUID{}, userToken) {
+		t.Error("user token should be valid for the user feed")
+	}
+	if !signer.Valid(userID, productID, productToken) {
+		t.Error("product token should be valid for the product feed")
+	}
+	if signer.Valid(userID, productID, userToken) {
+		t.Error("user token must not unlock a product feed")
+	}
+	if signer.Valid(uuid.New(), uuid.NullUUID{}, userToken) {
+		t.Error("token must not be valid for another user")
+	}
+	if NewSigner("other").Valid(userID, uuid.NullUUID{}, userToken) {
+		t.Error("token must not be valid with another secret")
+	}
+}
+
+func TestNewWarnsAboutRiskyAds(t *testing.T) {
+	change := dbpkg.ProductChange{
+		Kind:           dbpkg.ChangeTracked,
+		URL:            "https://www.olx.ro/d/oferta/iphone-IDkbEDB.html",
+		Name:           "iPhone",
+		Currency:       "RON",
+		PriceSmallUnit: 100000,
+		RiskScore:      55,
+		RiskReasons: dbpkg.RiskReasons{
+			{Code: "courier_only", Detail: "only ships by courier", Points: 20},
+			{Code: "payment_link", Detail: "mentions a payment link", Points: 35},
+		},
+	}
+	safe := change
+	safe.RiskScore, safe.RiskReasons = 10, nil
+
+	f := New("tag:test", "Test feed", "http://localhost/feeds/x", []dbpkg.ProductChange{change, safe}, money.LocaleDefault)
+	if got := f.Entries[0].Title; got != "Possible scam! Now tracking: iPhone at 1000.00 RON" {
+		t.Errorf("got title %q", got)
+	}
+	if body := f.Entries[0].Content.Body; !strings.Contains(body, "Risk score: 55/100\n- only ships by courier\n- mentions a payment link") {
+		t.Errorf("risky ad should list the reasons: %q", body)
+	}
+	if body := f.Entries[1].Content.Body; strings.Contains(body, "Risk score") {
+		t.Errorf("safe ad shouldn't mention the risk: %q", body)
+	}
+}
+
+func TestNew(t *testing.T) {
+	productID := uuid.MustParse("5b0b3a9e-8f0e-4a43-9d2e-7c1f4f1e2a10")
+	at := time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC)
+	base := dbpkg.ProductChange{
+		ProductID:              productID,
+		URL:                    "https://www.olx.ro/d/oferta/mouse-IDkbEDA.html",
+		Name:                   "Mouse",
+		Currency:               "RON",
+		PreviousCurrency:       "RON",
+		Availability:           "https://schema.org/InStock",
+		PreviousAvailability:   "https://schema.org/InStock",
+		PriceSmallUnit:         44900,
+		PreviousPriceSmallUnit: 50000,
+	}
+
+	deactivated := base
+	deactivated.Kind = dbpkg.ChangeDeactivated
+	deactivated.Version = 3
+	deactivated.At = at.Add(2 * time.Hour)
+	deactivated.PreviousPriceSmallUnit = 44900
+
+	drop := base
+	drop.Kind = dbpkg.ChangePrice
+	drop.Version = 3
+	drop.At = at.Add(time.Hour)
+
+	outOfStock := base
+	outOfStock.Kind = dbpkg.ChangeAvailability
+	outOfStock.Version = 2
+	outOfStock.At = at
+	outOfStock.PreviousPriceSmallUnit = 44900
+	outOfStock.Availability = "https://schema.org/OutOfStock"
+
+	f := New("tag:test", "Test feed", "http://localhost/feeds/x", []dbpkg.ProductChange{deactivated, drop, outOfStock}, money.LocaleDefault)
+	if f.Updated != "2026-02-01T12:00:00Z" {
+		t.Errorf("feed should be updated at its newest entry, got %s", f.Updated)
+	}
+
+	titles := []string{
+		"Ad removed: Mouse",
+		"Price drop: Mouse, 500.00 RON → 449.00 RON",
+		"Mouse is now OutOfStock",
+	}
+	for i, want := range titles {
+		if got := f.Entries[i].Title; got != want {
+			t.Errorf("entry %d title = %q, want %q", i, got, want)
+		}
+		if f.Entries[i].Link.Href != base.URL {
+			t.Errorf("entry %d should link to the ad", i)
+		}
+	}
+	if !strings.Contains(f.Entries[1].Content.Body, "Old price: 500.00 RON\nNew price: 449.00 RON") {
+		t.Errorf("price change should show old and new price: %q", f.Entries[1].Content.Body)
+	}
+	if !strings.Contains(f.Entries[2].Content.Body, "Availability: InStock → OutOfStock") {
+		t.Errorf("availability change should show both states: %q", f.Entries[2].Content.Body)
+	}
+	if f.Entries[0].ID == f.Entries[1].ID {
+		t.Error("deactivation and the last version need distinct ids")
+	}
+
+	body, err := f.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		XMLName xml.Name
+		Entries []struct {
+			Title string `xml:"title"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(body, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.XMLName.Space != atomNS || parsed.XMLName.Local != "feed" || len(parsed.Entries) != 3 {
+		t.Errorf("unexpected document: %s", body)
+	}
+}
+
+func TestNewWatchMatch(t *testing.T) {
+	change := dbpkg.ProductChange{
+		Kind:           dbpkg.ChangeWatchMatch,
+		ProductID:      uuid.MustParse("5b0b3a9e-8f0e-4a43-9d2e-7c1f4f1e2a10"),
+		Version:        2,
+		URL:            "https://www.olx.ro/d/oferta/mouse-IDkbEDA.html",
+		Name:           "Mouse",
+		Currency:       "RON",
+		PriceSmallUnit: 44900,
+		Availability:   "https://schema.org/InStock",
+		WatchRuleID:    uuid.MustParse("0f6c8a52-3d7b-4c1e-9a55-1b2c3d4e5f60"),
+		WatchRule:      "cheap mice",
+	}
+	other := change
+	other.WatchRuleID = uuid.MustParse("a1b2c3d4-0000-4000-8000-000000000000")
+
+	f := New("tag:test", "Test feed", "http://localhost/feeds/x", []dbpkg.ProductChange{change, other}, money.LocaleDefault)
+	if got := f.Entries[0].Title; got != `New match for "cheap mice": Mouse at 449.00 RON` {
+		t.Errorf("got title %q", got)
+	}
+	if body := f.Entries[0].Content.Body; !strings.Contains(body, "Watch rule: cheap mice") || strings.Contains(body, "Availability") {
+		t.Errorf("unexpected body %q", body)
+	}
+	if f.Entries[0].ID != "tag:olx-tracker,2026:watch/0f6c8a52-3d7b-4c1e-9a55-1b2c3d4e5f60/product/5b0b3a9e-8f0e-4a43-9d2e-7c1f4f1e2a10" {
+		t.Errorf("got id %q", f.Entries[0].ID)
+	}
+	if f.Entries[0].ID == f.Entries[1].ID {
+		t.Error("matches of different rules need distinct ids")
+	}
+}
+
+func TestNewLocale(t *testing.T) {
+	change := dbpkg.ProductChange{
+		Kind:                   dbpkg.ChangePrice,
+		ProductID:              uuid.New(),
+		Version:                2,
+		At:                     time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC),
+		URL:                    "https://www.olx.ro/d/oferta/laptop-IDkbEDA.html",
+		Name:                   "Laptop",
+		Currency:               "RON",
+		PreviousCurrency:       "RON",
+		PriceSmallUnit:         380000,
+		PreviousPriceSmallUnit: 420050,
+	}
+
+	f := New("tag:test", "Test feed", "http://localhost/feeds/x", []dbpkg.ProductChange{change}, money.LocaleRO)
+	if got, want := f.Entries[0].Title, "Price drop: Laptop, 4.200,50 lei → 3.800,00 lei"; got != want {
+		t.Errorf("title = %q, want %q", got, want)
+	}
+}
+
+func TestNewPriceKinds(t *testing.T) {
+	base := dbpkg.ProductChange{
+		ProductID:        uuid.New(),
+		Version:          2,
+		At:               time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC),
+		URL:              "https://www.olx.ro/d/oferta/desk-IDkbEDA.html",
+		Name:             "Desk",
+		Currency:         "RON",
+		PreviousCurrency: "RON",
+	}
+
+	tracked := base
+	tracked.Kind, tracked.PriceKind = dbpkg.ChangeTracked, "on_request"
+	toRange := base
+	toRange.Kind = dbpkg.ChangePriceTerms
+	toRange.PreviousPriceKind, toRange.PreviousPriceSmallUnit = "fixed", 50000
+	toRange.PriceKind, toRange.PriceSmallUnit = "range", 40000
+	toRange.HighPriceSmallUnit = sql.NullInt64{Int64: 60000, Valid: true}
+
+	f := New("tag:test", "Test feed", "http://localhost/feeds/x", []dbpkg.ProductChange{tracked, toRange}, money.LocaleDefault)
+	if got, want := f.Entries[0].Title, "Now tracking: Desk with the price on request"; got != want {
+		t.Errorf("title = %q, want %q", got, want)
+	}
+	if body := f.Entries[0].Content.Body; !strings.Contains(body, "Price: on request") {
+		t.Errorf("expected the price on request: %q", body)
+	}
+	if got, want := f.Entries[1].Title, "Price changed: Desk, 500.00 RON → 400.00 - 600.00 RON"; got != want {
+		t.Errorf("title = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,153 @@
+// Package health serves the liveness, readiness and build info endpoints
+// probed by orchestrators.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+)
+
+// Poller is implemented by tracker.Tracker.
+type Poller interface {
+	LastPollCycle() time.Time
+}
+
+// Checker decides whether the application is ready to serve.
+type Checker struct {
+	db                *sql.DB
+	expectedMigration uint64
+	poller            Poller
+	maxPollAge        time.Duration
+}
+
+// NewChecker creates a checker that reports the application as not ready
+// when the database can't be reached, isn't migrated to expectedMigration,
+// or no poll cycle completed within maxPollAge.
+func NewChecker(db *sql.DB, expectedMigration uint64, poller Poller, maxPollAge time.Duration) *Checker {
+	return &Checker{
+		db:                db,
+		expectedMigration: expectedMigration,
+		poller:            poller,
+		maxPollAge:        maxPollAge,
+	}
+}
+
+// Check runs all readiness checks and returns the failure of every check,
+// or nil for the ones that passed.
+func (c *Checker) Check(ctx context.Context) map[string]error {
+	return map[string]error{
+		"database":   c.db.PingContext(ctx),
+		"migrations": c.checkMigrations(ctx),
+		"poller":     c.checkPoller(),
+	}
+}
+
+func (c *Checker) checkMigrations(ctx context.Context) error {
+	version, dirty, err := dbpkg.GetMigrationVersion(ctx, c.db)
+	if err != nil {
+		if errors.Is(err, dbpkg.ErrNotFound) {
+			return fmt.Errorf("no migrations applied, expected version %d", c.expectedMigration)
+		}
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %d failed and left the schema dirty", version)
+	}
+	if version != c.expectedMigration {
+		return fmt.Errorf("schema is at version %d, expected %d", version, c.expectedMigration)
+	}
+	return nil
+}
+
+func (c *Checker) checkPoller() error {
+	since := time.Since(c.poller.LastPollCycle())
+	if since > c.maxPollAge {
+		return fmt.Errorf("no poll cycle completed in %s", since.Truncate(time.Second))
+	}
+	return nil
+}
+
+// Healthz reports that the process is alive and able to serve requests.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+type readyResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Readyz runs the readiness checks and responds with 503 if any of them
+// failed.
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp := readyResponse{Status: "ok", Checks: map[string]string{}}
+	status := http.StatusOK
+	for name, err := range c.Check(ctx) {
+		if err != nil {
+			resp.Checks[name] = err.Error()
+			resp.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		resp.Checks[name] = "ok"
+	}
+
+	writeJSON(w, status, resp)
+}
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// ReadBuildInfo returns the module version and the VCS information the Go
+// toolchain stamped into the binary.
+func ReadBuildInfo() BuildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return BuildInfo{Version: "unknown"}
+	}
+
+	bi := BuildInfo{
+		Version:   info.Main.Version,
+		GoVersion: info.GoVersion,
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			bi.Revision = s.Value
+		case "vcs.time":
+			bi.Time = s.Value
+		case "vcs.modified":
+			bi.Modified = s.Value == "true"
+		}
+	}
+	return bi
+}
+
+// Version responds with the build info of the binary.
+func Version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, ReadBuildInfo())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
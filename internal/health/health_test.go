@@ -0,0 +1,74 @@
+package health
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+type fakePoller time.Time
+
+func (p fakePoller) LastPollCycle() time.Time { return time.Time(p) }
+
+func TestHealthz(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d, want 200", rec.Code)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Version(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	var bi BuildInfo
+	if err := json.NewDecoder(rec.Body).Decode(&bi); err != nil {
+		t.Fatal(err)
+	}
+	if bi.Version == "" || bi.GoVersion == "" {
+		t.Errorf("incomplete build info %+v", bi)
+	}
+}
+
+func TestReadyzUnavailable(t *testing.T) {
+	// nothing listens on port 1, so the database checks fail right away
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	c := NewChecker(db, 1, fakePoller(time.Now()), time.Hour)
+	rec := httptest.NewRecorder()
+	c.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want 503", rec.Code)
+	}
+	var resp readyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Checks["poller"] != "ok" || resp.Checks["database"] == "ok" || resp.Checks["migrations"] == "ok" {
+		t.Errorf("unexpected checks %v", resp.Checks)
+	}
+}
+
+func TestCheckPoller(t *testing.T) {
+	c := NewChecker(nil, 1, fakePoller(time.Now().Add(-3*time.Hour)), 2*time.Hour)
+	if err := c.checkPoller(); err == nil {
+		t.Error("expected a stalled poller to fail the check")
+	}
+
+	c.poller = fakePoller(time.Now().Add(-time.Hour))
+	if err := c.checkPoller(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
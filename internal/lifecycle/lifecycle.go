@@ -0,0 +1,96 @@
+// Package lifecycle summarizes the lifecycle events of an ad: how long it
+// was on the market, how often its price was cut and the price it was last
+// asked for. An ad deactivated while it was in stock is taken to be sold.
+package lifecycle
+
+import (
+	"strings"
+	"time"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+// Summary is the lifecycle of an ad so far.
+type Summary struct {
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	// LastSeenAt is zero while the ad is active.
+	LastSeenAt    time.Time `json:"last_seen_at,omitzero"`
+	DeactivatedAt time.Time `json:"deactivated_at,omitzero"`
+	Sold          bool      `json:"sold"`
+
+	// TimeOnMarket goes from the first snapshot to the deactivation, or to
+	// now for an active ad.
+	TimeOnMarket time.Duration `json:"-"`
+	DaysOnMarket float64       `json:"days_on_market"`
+	PriceCuts    int           `json:"price_cuts"`
+
+	FirstPriceSmallUnit int64 `json:"first_price_small_unit"`
+	FinalPriceSmallUnit int64 `json:"final_price_small_unit"`
+	// FinalHighPriceSmallUnit is only set when the final price is a range.
+	FinalHighPriceSmallUnit *int64 `json:"final_high_price_small_unit,omitempty"`
+	FinalPriceKind          string `json:"final_price_kind"`
+	Currency                string `json:"currency"`
+}
+
+// Summarize summarizes the events of an ad, oldest first. It returns false
+// if the ad was never seen.
+func Summarize(events []dbpkg.ProductEvent, now time.Time) (Summary, bool) {
+	var (
+		s    Summary
+		seen bool
+	)
+	for _, e := range events {
+		switch e.Kind {
+		case dbpkg.EventFirstSeen:
+			seen = true
+			s.FirstSeenAt = e.At
+			s.FirstPriceSmallUnit = e.PriceSmallUnit
+			s.setFinalPrice(e)
+		case dbpkg.EventPriceChange:
+			// a change of currency or from or to a price that isn't fixed
+			// isn't a cut
+			if e.Currency == s.Currency && fixed(e.PriceKind) && fixed(e.PreviousPriceKind.String) &&
+				e.PreviousPriceSmallUnit.Valid && e.PriceSmallUnit < e.PreviousPriceSmallUnit.Int64 {
+				s.PriceCuts++
+			}
+			s.setFinalPrice(e)
+		case dbpkg.EventLastSeen:
+			s.LastSeenAt = e.At
+		case dbpkg.EventDeactivated:
+			s.DeactivatedAt = e.At
+			s.Sold = InStock(e.Availability)
+		}
+	}
+	if !seen {
+		return Summary{}, false
+	}
+
+	end := now
+	if !s.DeactivatedAt.IsZero() {
+		end = s.DeactivatedAt
+	}
+	s.TimeOnMarket = end.Sub(s.FirstSeenAt)
+	s.DaysOnMarket = s.TimeOnMarket.Hours() / 24
+	return s, true
+}
+
+func (s *Summary) setFinalPrice(e dbpkg.ProductEvent) {
+	s.FinalPriceSmallUnit = e.PriceSmallUnit
+	s.FinalHighPriceSmallUnit = nil
+	if e.HighPriceSmallUnit.Valid {
+		s.FinalHighPriceSmallUnit = &e.HighPriceSmallUnit.Int64
+	}
+	s.FinalPriceKind = e.PriceKind
+	s.Currency = e.Currency
+}
+
+func fixed(kind string) bool {
+	return productpkg.PriceKind(kind) == productpkg.PriceFixed
+}
+
+// InStock tells whether a schema.org availability, e.g.
+// "https://schema.org/InStock", means the item can be bought.
+func InStock(availability string) bool {
+	return strings.HasSuffix(availability, "InStock")
+}
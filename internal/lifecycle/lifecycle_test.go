@@ -0,0 +1,87 @@
+package lifecycle
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+)
+
+func TestSummarize(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	priceChange := func(at time.Duration, kind string, price int64, previousKind string, previousPrice int64) dbpkg.ProductEvent {
+		return dbpkg.ProductEvent{
+			Kind:                   dbpkg.EventPriceChange,
+			At:                     start.Add(at),
+			PriceSmallUnit:         price,
+			PriceKind:              kind,
+			PreviousPriceSmallUnit: sql.NullInt64{Int64: previousPrice, Valid: true},
+			PreviousPriceKind:      sql.NullString{String: previousKind, Valid: true},
+			Currency:               "RON",
+		}
+	}
+	events := []dbpkg.ProductEvent{
+		{Kind: dbpkg.EventFirstSeen, At: start, PriceSmallUnit: 1000_00, PriceKind: "fixed", Currency: "RON"},
+		priceChange(2*day, "fixed", 900_00, "fixed", 1000_00),
+		priceChange(3*day, "fixed", 950_00, "fixed", 900_00),
+		// a range starting lower than the fixed price isn't a cut
+		priceChange(4*day, "range", 700_00, "fixed", 950_00),
+		priceChange(5*day, "fixed", 950_00, "range", 700_00),
+		priceChange(6*day, "fixed", 800_00, "fixed", 950_00),
+	}
+	sold := append(events[:len(events):len(events)],
+		dbpkg.ProductEvent{Kind: dbpkg.EventLastSeen, At: start.Add(9 * day), PriceSmallUnit: 800_00, Currency: "RON", Availability: "https://schema.org/InStock"},
+		dbpkg.ProductEvent{Kind: dbpkg.EventDeactivated, At: start.Add(10 * day), PriceSmallUnit: 800_00, Currency: "RON", Availability: "https://schema.org/InStock"},
+	)
+	withdrawn := append(events[:len(events):len(events)],
+		dbpkg.ProductEvent{Kind: dbpkg.EventDeactivated, At: start.Add(10 * day), Availability: "https://schema.org/OutOfStock"},
+	)
+
+	tests := []struct {
+		name   string
+		events []dbpkg.ProductEvent
+		sold   bool
+		days   float64
+	}{
+		{"active", events, false, 20},
+		{"sold", sold, true, 10},
+		{"withdrawn", withdrawn, false, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ok := Summarize(tt.events, start.Add(20*day))
+			if !ok {
+				t.Fatal("got no summary")
+			}
+			if s.Sold != tt.sold {
+				t.Errorf("got sold %v, want %v", s.Sold, tt.sold)
+			}
+			if s.DaysOnMarket != tt.days {
+				t.Errorf("got %v days on market, want %v", s.DaysOnMarket, tt.days)
+			}
+			if s.PriceCuts != 2 {
+				t.Errorf("got %d price cuts, want 2", s.PriceCuts)
+			}
+			if s.FirstPriceSmallUnit != 1000_00 || s.FinalPriceSmallUnit != 800_00 {
+				t.Errorf("got prices %d -> %d, want 100000 -> 80000", s.FirstPriceSmallUnit, s.FinalPriceSmallUnit)
+			}
+			if s.FinalPriceKind != "fixed" || s.FinalHighPriceSmallUnit != nil {
+				t.Errorf("got final price kind %q with high %v, want a fixed price", s.FinalPriceKind, s.FinalHighPriceSmallUnit)
+			}
+		})
+	}
+
+	onRequest := append(events[:len(events):len(events)], priceChange(7*day, "on_request", 0, "fixed", 800_00))
+	s, _ := Summarize(onRequest, start.Add(20*day))
+	if s.FinalPriceKind != "on_request" {
+		t.Errorf("got final price kind %q, want on_request", s.FinalPriceKind)
+	}
+
+	if _, ok := Summarize(nil, start); ok {
+		t.Error("got a summary of an ad that was never seen")
+	}
+}
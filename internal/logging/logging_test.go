@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var records []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var record map[string]any
+		if err := dec.Decode(&record); err != nil {
+			t.Fatalf("invalid log record: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestContextAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := With(context.Background(), slog.String("cycle_id", "c1"))
+	ctx = With(ctx, slog.String("job_id", "j1"))
+	logger.DebugContext(ctx, "not logged")
+	logger.InfoContext(ctx, "polled", "version", 3)
+
+	records := decodeRecords(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	r := records[0]
+	if r["msg"] != "polled" || r["cycle_id"] != "c1" || r["job_id"] != "j1" || r["version"] != float64(3) {
+		t.Errorf("unexpected record %v", r)
+	}
+}
+
+func TestTraceIDs(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{2},
+	})
+	logger.InfoContext(trace.ContextWithSpanContext(context.Background(), sc), "traced")
+
+	r := decodeRecords(t, &buf)[0]
+	if r["trace_id"] != sc.TraceID().String() || r["span_id"] != sc.SpanID().String() {
+		t.Errorf("record %v is missing the span ids", r)
+	}
+}
+
+func TestInvalidLevel(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logger)
+
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "handling")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	t.Run("generates an id", func(t *testing.T) {
+		buf.Reset()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products", nil))
+
+		id := rec.Header().Get(requestIDHeader)
+		if id == "" {
+			t.Fatal("missing request id header")
+		}
+		records := decodeRecords(t, &buf)
+		if len(records) != 2 {
+			t.Fatalf("got %d records, want 2", len(records))
+		}
+		for _, r := range records {
+			if r["request_id"] != id || r["path"] != "/products" {
+				t.Errorf("record %v is missing request attrs", r)
+			}
+		}
+		if records[1]["status"] != float64(http.StatusTeapot) {
+			t.Errorf("got status %v, want %d", records[1]["status"], http.StatusTeapot)
+		}
+	})
+
+	t.Run("reuses incoming id", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(requestIDHeader, "from-proxy")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get(requestIDHeader); got != "from-proxy" {
+			t.Errorf("got request id %q, want from-proxy", got)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+// Package market answers whether the price of an ad is a good one, by
+// comparing it to the materialized prices of the other ads in its category
+// or matching a keyword, see db.RefreshMarketStats.
+package market
+
+import (
+	"fmt"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/repost"
+)
+
+// MinListings is how many listings stats need to rate a price.
+const MinListings = 5
+
+// NormalizeKeyword turns a keyword query into the form stats are stored
+// under: lowercase words without diacritics or punctuation, so "iPhone-13"
+// and "iphone 13" are the same keyword.
+func NormalizeKeyword(keyword string) string {
+	return repost.Normalize(keyword)
+}
+
+// Verdict says how a price compares to the market.
+type Verdict string
+
+const (
+	// VerdictGood is a price in the cheapest quarter of the listings.
+	VerdictGood Verdict = "good"
+	// VerdictFair is a price in the middle half of the listings.
+	VerdictFair Verdict = "fair"
+	// VerdictHigh is a price in the most expensive quarter of the listings.
+	VerdictHigh Verdict = "high"
+	// VerdictUnknown is given when there are too few listings to tell.
+	VerdictUnknown Verdict = "unknown"
+)
+
+// Rating is how a price compares to the stats of a day.
+type Rating struct {
+	Verdict Verdict `json:"verdict"`
+	// Percentile is the share of listings estimated to be cheaper, from 0
+	// to 100, interpolated between the materialized percentiles.
+	Percentile int `json:"percentile"`
+	// VsMedianPercent is how much the price is above the median, negative
+	// when below.
+	VsMedianPercent float64 `json:"vs_median_percent"`
+}
+
+// Rate compares a price to the stats of its market segment. The currency of
+// the price is expected to match the one of the stats.
+func Rate(priceSmallUnit int64, s dbpkg.MarketStat) Rating {
+	if s.Listings < MinListings || s.MedianSmallUnit <= 0 {
+		return Rating{Verdict: VerdictUnknown}
+	}
+
+	r := Rating{
+		Percentile:      percentile(priceSmallUnit, s),
+		VsMedianPercent: float64(priceSmallUnit-s.MedianSmallUnit) * 100 / float64(s.MedianSmallUnit),
+	}
+	switch {
+	case priceSmallUnit <= s.P25SmallUnit:
+		r.Verdict = VerdictGood
+	case priceSmallUnit < s.P75SmallUnit:
+		r.Verdict = VerdictFair
+	default:
+		r.Verdict = VerdictHigh
+	}
+	return r
+}
+
+func percentile(price int64, s dbpkg.MarketStat) int {
+	points := []struct {
+		price      int64
+		percentile float64
+	}{
+		{s.MinSmallUnit, 0},
+		{s.P10SmallUnit, 10},
+		{s.P25SmallUnit, 25},
+		{s.MedianSmallUnit, 50},
+		{s.P75SmallUnit, 75},
+		{s.P90SmallUnit, 90},
+		{s.MaxSmallUnit, 100},
+	}
+
+	if price <= points[0].price {
+		return 0
+	}
+	for i := 1; i < len(points); i++ {
+		lo, hi := points[i-1], points[i]
+		if price > hi.price {
+			continue
+		}
+		if hi.price == lo.price {
+			return int(hi.percentile)
+		}
+		frac := float64(price-lo.price) / float64(hi.price-lo.price)
+		return int(lo.percentile + frac*(hi.percentile-lo.percentile))
+	}
+	return 100
+}
+
+// Trend is the relative change of the median price between the first and
+// the last of a series of daily stats, the oldest first, e.g. -5.2 for a
+// market that got 5.2% cheaper. It is zero for fewer than two days.
+func Trend(stats []dbpkg.MarketStat) float64 {
+	if len(stats) < 2 {
+		return 0
+	}
+	first, last := stats[0].MedianSmallUnit, stats[len(stats)-1].MedianSmallUnit
+	if first <= 0 {
+		return 0
+	}
+	return float64(last-first) * 100 / float64(first)
+}
+
+// Describe summarizes a rating for people, e.g. "good price, 12% below the
+// median of 31 ads".
+func Describe(r Rating, s dbpkg.MarketStat) string {
+	if r.Verdict == VerdictUnknown {
+		return "too few similar ads to compare"
+	}
+
+	position := "at"
+	switch {
+	case r.VsMedianPercent >= 0.5:
+		position = fmt.Sprintf("%.0f%% above", r.VsMedianPercent)
+	case r.VsMedianPercent <= -0.5:
+		position = fmt.Sprintf("%.0f%% below", -r.VsMedianPercent)
+	}
+	return fmt.Sprintf("%s price, %s the median of %d ads", r.Verdict, position, s.Listings)
+}
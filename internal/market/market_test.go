@@ -0,0 +1,72 @@
+package market
+
+import (
+	"testing"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+)
+
+var stat = dbpkg.MarketStat{
+	Listings:        20,
+	MinSmallUnit:    100_00,
+	P10SmallUnit:    200_00,
+	P25SmallUnit:    300_00,
+	MedianSmallUnit: 400_00,
+	P75SmallUnit:    500_00,
+	P90SmallUnit:    600_00,
+	MaxSmallUnit:    1000_00,
+}
+
+func TestRate(t *testing.T) {
+	tests := []struct {
+		name       string
+		price      int64
+		stat       dbpkg.MarketStat
+		verdict    Verdict
+		percentile int
+		describe   string
+	}{
+		{"cheapest", 50_00, stat, VerdictGood, 0, "good price, 88% below the median of 20 ads"},
+		{"first quarter", 250_00, stat, VerdictGood, 17, "good price, 38% below the median of 20 ads"},
+		{"median", 400_00, stat, VerdictFair, 50, "fair price, at the median of 20 ads"},
+		{"third quarter", 500_00, stat, VerdictHigh, 75, "high price, 25% above the median of 20 ads"},
+		{"top", 800_00, stat, VerdictHigh, 95, "high price, 100% above the median of 20 ads"},
+		{"above max", 2000_00, stat, VerdictHigh, 100, "high price, 400% above the median of 20 ads"},
+		{"too few listings", 250_00, dbpkg.MarketStat{Listings: 3, MedianSmallUnit: 400_00}, VerdictUnknown, 0, "too few similar ads to compare"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Rate(tt.price, tt.stat)
+			if r.Verdict != tt.verdict {
+				t.Errorf("got verdict %s, want %s", r.Verdict, tt.verdict)
+			}
+			if r.Percentile != tt.percentile {
+				t.Errorf("got percentile %d, want %d", r.Percentile, tt.percentile)
+			}
+			if got := Describe(r, tt.stat); got != tt.describe {
+				t.Errorf("got description %q, want %q", got, tt.describe)
+			}
+		})
+	}
+}
+
+func TestTrend(t *testing.T) {
+	days := []dbpkg.MarketStat{
+		{MedianSmallUnit: 400_00},
+		{MedianSmallUnit: 420_00},
+		{MedianSmallUnit: 380_00},
+	}
+	if got := Trend(days); got != -5 {
+		t.Errorf("got trend %v, want -5", got)
+	}
+	if got := Trend(days[:1]); got != 0 {
+		t.Errorf("got trend %v for a single day, want 0", got)
+	}
+}
+
+func TestNormalizeKeyword(t *testing.T) {
+	if got := NormalizeKeyword("  iPhone-13 Pro, ȘTIRBEI "); got != "iphone 13 pro stirbei" {
+		t.Errorf("got %q", got)
+	}
+}
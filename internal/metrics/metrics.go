@@ -0,0 +1,170 @@
+// Package metrics exposes the operational metrics of the tracker in the
+// Prometheus format. It implements the observer interfaces of the product,
+// db and tracker packages, which don't know about Prometheus themselves.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+const namespace = "olxtracker"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	fetches           *prometheus.CounterVec
+	fetchDuration     *prometheus.HistogramVec
+	snapshots         *prometheus.CounterVec
+	pollCycleDuration prometheus.Histogram
+	queryDuration     *prometheus.HistogramVec
+	queryErrors       *prometheus.CounterVec
+	pollLag           prometheus.GaugeFunc
+}
+
+// Poller reports when the last poll cycle completed. It is implemented by
+// the tracker, which is the only one keeping track of it.
+type Poller interface {
+	LastPollCycle() time.Time
+}
+
+// New registers all metrics. The database is queried on every scrape to
+// count the tracked products.
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		fetches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fetches_total",
+			Help:      "OLX ad page fetches by result and HTTP status code.",
+		}, []string{"result", "status"}),
+		fetchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "fetch_duration_seconds",
+			Help:      "Duration of OLX ad page fetches, including parsing.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10},
+		}, []string{"result"}),
+		snapshots: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "snapshots_total",
+			Help:      "Successful fetches by whether a new snapshot was stored or skipped because nothing changed.",
+		}, []string{"outcome"}),
+		pollCycleDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "poll_cycle_duration_seconds",
+			Help:      "Duration of a poll cycle over all tracked products.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Duration of database operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"op"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_query_errors_total",
+			Help:      "Database operations that failed unexpectedly.",
+		}, []string{"op"}),
+	}
+	m.registry.MustRegister(
+		m.fetches,
+		m.fetchDuration,
+		m.snapshots,
+		m.pollCycleDuration,
+		m.queryDuration,
+		m.queryErrors,
+		&trackedProductsCollector{db: db},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// WatchPoller exposes the seconds since the poller last completed a poll
+// cycle. It must be called at most once.
+func (m *Metrics) WatchPoller(p Poller) {
+	m.pollLag = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "poll_lag_seconds",
+		Help:      "Seconds since the last poll cycle completed.",
+	}, func() float64 {
+		return time.Since(p.LastPollCycle()).Seconds()
+	})
+	m.registry.MustRegister(m.pollLag)
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) ObserveFetch(result productpkg.FetchResult, statusCode int, duration time.Duration) {
+	status := ""
+	if statusCode != 0 {
+		status = strconv.Itoa(statusCode)
+	}
+	m.fetches.WithLabelValues(string(result), status).Inc()
+	m.fetchDuration.WithLabelValues(string(result)).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ObserveQuery(op string, duration time.Duration, err error) {
+	m.queryDuration.WithLabelValues(op).Observe(duration.Seconds())
+	if err != nil {
+		m.queryErrors.WithLabelValues(op).Inc()
+	}
+}
+
+func (m *Metrics) ObserveSnapshot(stored bool) {
+	outcome := "skipped"
+	if stored {
+		outcome = "stored"
+	}
+	m.snapshots.WithLabelValues(outcome).Inc()
+}
+
+func (m *Metrics) ObservePollCycle(duration time.Duration) {
+	m.pollCycleDuration.Observe(duration.Seconds())
+}
+
+var trackedProductsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "tracked_products"),
+	"Number of tracked products by status.",
+	[]string{"status"},
+	nil,
+)
+
+// trackedProductsCollector counts the tracked products at scrape time, so
+// the number is right even when products are added by another process.
+type trackedProductsCollector struct {
+	db *sql.DB
+}
+
+func (c *trackedProductsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- trackedProductsDesc
+}
+
+func (c *trackedProductsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	counts, err := dbpkg.CountTrackedProductsByStatus(ctx, c.db)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to count tracked products", "error", err)
+		return
+	}
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(trackedProductsDesc, prometheus.GaugeValue, float64(count), status)
+	}
+}
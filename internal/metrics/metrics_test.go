@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+func TestObservers(t *testing.T) {
+	m := New(nil)
+
+	m.ObserveFetch(productpkg.FetchOK, 200, time.Second)
+	m.ObserveFetch(productpkg.FetchOK, 200, time.Second)
+	m.ObserveFetch(productpkg.FetchHTTPStatus, 429, time.Second)
+	m.ObserveFetch(productpkg.FetchRequestError, 0, time.Second)
+
+	if got := testutil.ToFloat64(m.fetches.WithLabelValues("ok", "200")); got != 2 {
+		t.Errorf("expected 2 ok fetches, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.fetches.WithLabelValues("http_status", "429")); got != 1 {
+		t.Errorf("expected 1 throttled fetch, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.fetches.WithLabelValues("request_error", "")); got != 1 {
+		t.Errorf("expected 1 failed request, got %v", got)
+	}
+
+	m.ObserveSnapshot(true)
+	m.ObserveSnapshot(false)
+	m.ObserveSnapshot(false)
+	if got := testutil.ToFloat64(m.snapshots.WithLabelValues("skipped")); got != 2 {
+		t.Errorf("expected 2 skipped snapshots, got %v", got)
+	}
+
+	m.ObserveQuery("GetUserID", time.Millisecond, nil)
+	m.ObserveQuery("GetUserID", time.Millisecond, errors.New("connection reset"))
+	if got := testutil.ToFloat64(m.queryErrors.WithLabelValues("GetUserID")); got != 1 {
+		t.Errorf("expected 1 query error, got %v", got)
+	}
+
+	m.ObservePollCycle(30 * time.Second)
+	m.WatchPoller(fakePoller(time.Now().Add(-time.Minute)))
+	lag := testutil.ToFloat64(m.pollLag)
+	if lag < 60 || lag > 120 {
+		t.Errorf("unexpected poll lag %v", lag)
+	}
+}
+
+type fakePoller time.Time
+
+func (p fakePoller) LastPollCycle() time.Time { return time.Time(p) }
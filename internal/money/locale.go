@@ -0,0 +1,78 @@
+package money
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Locale is how prices are written for a user.
+type Locale string
+
+const (
+	// LocaleDefault writes prices like Format, e.g. "1234.56 RON".
+	LocaleDefault Locale = ""
+	// LocaleEN groups thousands with commas, e.g. "1,234.56 RON".
+	LocaleEN Locale = "en"
+	// LocaleRO groups thousands with dots, uses a decimal comma and the
+	// Romanian names of the common currencies, e.g. "1.234,56 lei".
+	LocaleRO Locale = "ro"
+)
+
+// Locales are the locales besides the default one.
+var Locales = []Locale{LocaleEN, LocaleRO}
+
+// romanianCurrencies are the currencies written by name or symbol in
+// Romanian, the others are written by their code.
+var romanianCurrencies = map[string]string{
+	"RON": "lei",
+	"EUR": "€",
+}
+
+func ParseLocale(s string) (Locale, error) {
+	switch l := Locale(s); l {
+	case LocaleDefault, LocaleEN, LocaleRO:
+		return l, nil
+	default:
+		return "", fmt.Errorf("unsupported locale %q", s)
+	}
+}
+
+// MajorUnits formats a price in small units as a decimal number of major
+// units, e.g. 123456 becomes "1.234,56" in LocaleRO.
+func (l Locale) MajorUnits(smallUnit int64) string {
+	var thousands, decimal string
+	switch l {
+	case LocaleEN:
+		thousands, decimal = ",", "."
+	case LocaleRO:
+		thousands, decimal = ".", ","
+	default:
+		return MajorUnits(smallUnit)
+	}
+
+	sign := ""
+	if smallUnit < 0 {
+		sign = "-"
+		smallUnit = -smallUnit
+	}
+	units := fmt.Sprint(smallUnit / 100)
+	var b strings.Builder
+	for i, digit := range units {
+		if i > 0 && (len(units)-i)%3 == 0 {
+			b.WriteString(thousands)
+		}
+		b.WriteRune(digit)
+	}
+	return fmt.Sprintf("%s%s%s%02d", sign, b.String(), decimal, smallUnit%100)
+}
+
+// Format formats a price together with its currency, e.g. "1.234,56 lei" in
+// LocaleRO.
+func (l Locale) Format(smallUnit int64, currency string) string {
+	if l == LocaleRO {
+		if name, ok := romanianCurrencies[currency]; ok {
+			currency = name
+		}
+	}
+	return l.MajorUnits(smallUnit) + " " + currency
+}
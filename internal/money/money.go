@@ -0,0 +1,54 @@
+// Package money converts prices between small units (bani, cents), which is
+// how they are stored, and decimal major units, which is how they are shown.
+// Conversions never go through a float.
+package money
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MajorUnits formats a price in small units as a decimal number of major
+// units, e.g. 44950 becomes "449.50".
+func MajorUnits(smallUnit int64) string {
+	sign := ""
+	if smallUnit < 0 {
+		sign = "-"
+		smallUnit = -smallUnit
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, smallUnit/100, smallUnit%100)
+}
+
+// Format formats a price together with its currency, e.g. "449.50 RON".
+func Format(smallUnit int64, currency string) string {
+	return MajorUnits(smallUnit) + " " + currency
+}
+
+// ParseMajorUnits parses a non-negative price such as "449", "449.5" or
+// "449,50" into small units.
+func ParseMajorUnits(s string) (int64, error) {
+	s = strings.ReplaceAll(s, ",", ".")
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" || (hasFrac && (frac == "" || len(frac) > 2)) {
+		return 0, fmt.Errorf("invalid price %q", s)
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units < 0 {
+		return 0, fmt.Errorf("invalid price %q", s)
+	}
+
+	var cents int64
+	if hasFrac {
+		if len(frac) == 1 {
+			frac += "0"
+		}
+		cents, err = strconv.ParseInt(frac, 10, 64)
+		if err != nil || cents < 0 {
+			return 0, fmt.Errorf("invalid price %q", s)
+		}
+	}
+
+	return units*100 + cents, nil
+}
@@ -0,0 +1,82 @@
+package money
+
+import "testing"
+
+func TestMajorUnits(t *testing.T) {
+	for smallUnit, want := range map[int64]string{
+		44900: "449.00",
+		44950: "449.50",
+		7:     "0.07",
+		-150:  "-1.50",
+	} {
+		if got := MajorUnits(smallUnit); got != want {
+			t.Errorf("MajorUnits(%d) = %q, want %q", smallUnit, got, want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		smallUnit int64
+		want      string
+	}{
+		{44900, "449.00 RON"},
+		{5, "0.05 RON"},
+		{-4905, "-49.05 RON"},
+	}
+
+	for _, tt := range tests {
+		if got := Format(tt.smallUnit, "RON"); got != tt.want {
+			t.Errorf("Format(%d) = %q, want %q", tt.smallUnit, got, tt.want)
+		}
+	}
+}
+
+func TestParseMajorUnits(t *testing.T) {
+	valid := map[string]int64{
+		"449":    44900,
+		"449.5":  44950,
+		"449,50": 44950,
+		"0.07":   7,
+	}
+	for in, want := range valid {
+		got, err := ParseMajorUnits(in)
+		if err != nil || got != want {
+			t.Errorf("ParseMajorUnits(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "abc", "1.234", "-5", "5.", ".5"} {
+		if _, err := ParseMajorUnits(in); err == nil {
+			t.Errorf("ParseMajorUnits(%q) should fail", in)
+		}
+	}
+}
+
+func TestLocaleFormat(t *testing.T) {
+	tests := []struct {
+		locale    Locale
+		smallUnit int64
+		currency  string
+		want      string
+	}{
+		{LocaleDefault, 123456, "RON", "1234.56 RON"},
+		{LocaleEN, 123456, "RON", "1,234.56 RON"},
+		{LocaleEN, 99, "EUR", "0.99 EUR"},
+		{LocaleEN, 100000000, "EUR", "1,000,000.00 EUR"},
+		{LocaleRO, 123456, "RON", "1.234,56 lei"},
+		{LocaleRO, 123456, "EUR", "1.234,56 €"},
+		{LocaleRO, 123456, "USD", "1.234,56 USD"},
+		{LocaleRO, -4990000, "RON", "-49.900,00 lei"},
+		{LocaleRO, 50000, "RON", "500,00 lei"},
+	}
+	for _, tt := range tests {
+		if got := tt.locale.Format(tt.smallUnit, tt.currency); got != tt.want {
+			t.Errorf("%q.Format(%d, %s) = %q, want %q", tt.locale, tt.smallUnit, tt.currency, got, tt.want)
+		}
+	}
+
+	if _, err := ParseLocale("fr"); err == nil {
+		t.Error("expected an unsupported locale to be rejected")
+	}
+}
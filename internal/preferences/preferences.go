@@ -0,0 +1,176 @@
+// Package preferences holds how a user wants to see prices and times and
+// when they want to be notified. They are applied everywhere prices and
+// times are shown to the user: the dashboard, the CLI, exports and feeds.
+package preferences
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/exchange"
+	"github.com/Ozoniuss/olx-tracker/internal/money"
+)
+
+const (
+	MinPollInterval = time.Minute
+	MaxPollInterval = 7 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidCurrency     = errors.New("the currency must be a currency code such as EUR")
+	ErrInvalidPollInterval = fmt.Errorf("the poll interval must be between %s and %s", MinPollInterval, MaxPollInterval)
+	ErrInvalidQuietHours   = errors.New("quiet hours must start and end at different times of the day")
+	ErrInvalidEmail        = errors.New("the email must be a plain address such as name@example.com")
+	ErrInvalidDigest       = errors.New("the digest must be daily, weekly or empty for none")
+	ErrDigestWithoutEmail  = errors.New("an email is required for digests")
+)
+
+// DigestFrequency is how often a user gets a digest of the changes of their
+// ads by email.
+type DigestFrequency string
+
+const (
+	DigestNone   DigestFrequency = ""
+	DigestDaily  DigestFrequency = "daily"
+	DigestWeekly DigestFrequency = "weekly"
+)
+
+type Preferences struct {
+	// Currency is what prices are also shown in, converted at the rate of
+	// the day they were seen. Empty to show prices only as listed.
+	Currency string
+	// Timezone is the IANA name of the time zone times are shown in, empty
+	// for the time zone of the server. Location is the loaded zone.
+	Timezone string
+	Location *time.Location
+	Locale   money.Locale
+	// PollInterval is how often the ads of the user are polled, zero for
+	// every poll cycle. Intervals shorter than the poll cycle have no
+	// effect.
+	PollInterval time.Duration
+	QuietHours   QuietHours
+	// Email is where digests are sent, if Digest opted in to them.
+	Email  string
+	Digest DigestFrequency
+}
+
+// Default returns the preferences of users who never set any.
+func Default() Preferences {
+	return Preferences{Location: time.Local}
+}
+
+// FromDB validates stored preferences.
+func FromDB(stored dbpkg.UserPreferences) (Preferences, error) {
+	p := Default()
+	p.Currency = stored.Currency
+	if p.Currency != "" && !exchange.ValidCurrency(p.Currency) {
+		return Preferences{}, ErrInvalidCurrency
+	}
+
+	if stored.Timezone != "" {
+		loc, err := time.LoadLocation(stored.Timezone)
+		if err != nil {
+			return Preferences{}, fmt.Errorf("unknown time zone %q", stored.Timezone)
+		}
+		p.Timezone, p.Location = stored.Timezone, loc
+	}
+
+	locale, err := money.ParseLocale(stored.Locale)
+	if err != nil {
+		return Preferences{}, err
+	}
+	p.Locale = locale
+
+	p.PollInterval = stored.PollInterval
+	if p.PollInterval != 0 && (p.PollInterval < MinPollInterval || p.PollInterval > MaxPollInterval) {
+		return Preferences{}, ErrInvalidPollInterval
+	}
+
+	if stored.QuietStart.Valid != stored.QuietEnd.Valid {
+		return Preferences{}, ErrInvalidQuietHours
+	}
+	if stored.QuietStart.Valid {
+		p.QuietHours = QuietHours{Start: int(stored.QuietStart.Int16), End: int(stored.QuietEnd.Int16)}
+		if !p.QuietHours.Enabled() || !validMinute(p.QuietHours.Start) || !validMinute(p.QuietHours.End) {
+			return Preferences{}, ErrInvalidQuietHours
+		}
+	}
+
+	p.Email = stored.Email
+	if p.Email != "" {
+		if addr, err := mail.ParseAddress(p.Email); err != nil || addr.Address != p.Email {
+			return Preferences{}, ErrInvalidEmail
+		}
+	}
+	p.Digest = DigestFrequency(stored.Digest)
+	switch p.Digest {
+	case DigestNone, DigestDaily, DigestWeekly:
+	default:
+		return Preferences{}, ErrInvalidDigest
+	}
+	if p.Digest != DigestNone && p.Email == "" {
+		return Preferences{}, ErrDigestWithoutEmail
+	}
+	return p, nil
+}
+
+// ToDB returns the preferences as they are stored.
+func (p Preferences) ToDB() dbpkg.UserPreferences {
+	stored := dbpkg.UserPreferences{
+		Currency:     p.Currency,
+		Timezone:     p.Timezone,
+		Locale:       string(p.Locale),
+		PollInterval: p.PollInterval.Truncate(time.Second),
+		Email:        p.Email,
+		Digest:       string(p.Digest),
+	}
+	if p.QuietHours.Enabled() {
+		stored.QuietStart = sql.NullInt16{Int16: int16(p.QuietHours.Start), Valid: true}
+		stored.QuietEnd = sql.NullInt16{Int16: int16(p.QuietHours.End), Valid: true}
+	}
+	return stored
+}
+
+// Load returns the preferences of a user.
+func Load(ctx context.Context, db *sql.DB, userID uuid.UUID) (Preferences, error) {
+	stored, err := dbpkg.GetUserPreferences(ctx, db, userID)
+	if err != nil {
+		return Preferences{}, err
+	}
+	p, err := FromDB(stored)
+	if err != nil {
+		return Preferences{}, fmt.Errorf("invalid stored preferences: %w", err)
+	}
+	return p, nil
+}
+
+// FormatPrice formats a price in the locale of the user.
+func (p Preferences) FormatPrice(smallUnit int64, currency string) string {
+	return p.Locale.Format(smallUnit, currency)
+}
+
+// FormatTime formats a time in the time zone of the user, to the minute.
+func (p Preferences) FormatTime(t time.Time) string {
+	loc := p.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	return t.In(loc).Format("2006-01-02 15:04")
+}
+
+// Quiet tells whether t falls in the quiet hours of the user, and if so when
+// they started and when they end.
+func (p Preferences) Quiet(t time.Time) (start, end time.Time, ok bool) {
+	loc := p.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	return p.QuietHours.Period(t.In(loc))
+}
@@ -0,0 +1,106 @@
+package preferences
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/money"
+)
+
+func minute(m int16) sql.NullInt16 {
+	return sql.NullInt16{Int16: m, Valid: true}
+}
+
+func TestFromDB(t *testing.T) {
+	stored := dbpkg.UserPreferences{
+		Currency:     "EUR",
+		Timezone:     "Europe/Bucharest",
+		Locale:       "ro",
+		PollInterval: 6 * time.Hour,
+		QuietStart:   minute(22 * 60),
+		QuietEnd:     minute(7 * 60),
+		Email:        "ana@example.com",
+		Digest:       "daily",
+	}
+	p, err := FromDB(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Location.String() != "Europe/Bucharest" || p.Locale != money.LocaleRO || p.QuietHours != (QuietHours{Start: 1320, End: 420}) {
+		t.Errorf("unexpected preferences %+v", p)
+	}
+	if p.ToDB() != stored {
+		t.Errorf("preferences should be stored as they were loaded, got %+v", p.ToDB())
+	}
+
+	if p, err := FromDB(dbpkg.UserPreferences{}); err != nil || p.Location != time.Local || p.QuietHours.Enabled() {
+		t.Errorf("empty preferences should be the defaults, got %+v, %v", p, err)
+	}
+
+	invalid := []struct {
+		name   string
+		stored dbpkg.UserPreferences
+		want   error
+	}{
+		{"currency", dbpkg.UserPreferences{Currency: "lei"}, ErrInvalidCurrency},
+		{"short poll interval", dbpkg.UserPreferences{PollInterval: time.Second}, ErrInvalidPollInterval},
+		{"empty quiet hours", dbpkg.UserPreferences{QuietStart: minute(60), QuietEnd: minute(60)}, ErrInvalidQuietHours},
+		{"quiet hours without end", dbpkg.UserPreferences{QuietStart: minute(60)}, ErrInvalidQuietHours},
+		{"time zone", dbpkg.UserPreferences{Timezone: "Mars/Olympus"}, nil},
+		{"locale", dbpkg.UserPreferences{Locale: "fr"}, nil},
+		{"email with name", dbpkg.UserPreferences{Email: "Ana <ana@example.com>"}, ErrInvalidEmail},
+		{"digest", dbpkg.UserPreferences{Email: "ana@example.com", Digest: "hourly"}, ErrInvalidDigest},
+		{"digest without email", dbpkg.UserPreferences{Digest: "weekly"}, ErrDigestWithoutEmail},
+	}
+	for _, tt := range invalid {
+		_, err := FromDB(tt.stored)
+		if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestQuietHoursPeriod(t *testing.T) {
+	bucharest, err := time.LoadLocation("Europe/Bucharest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, bucharest)
+	}
+
+	night := QuietHours{Start: 22 * 60, End: 7 * 60}
+	lunch := QuietHours{Start: 12 * 60, End: 13 * 60}
+	tests := []struct {
+		name       string
+		quiet      QuietHours
+		t          time.Time
+		start, end time.Time
+		ok         bool
+	}{
+		{"before midnight", night, at(16, 23, 0), at(16, 22, 0), at(17, 7, 0), true},
+		{"after midnight", night, at(17, 6, 59), at(16, 22, 0), at(17, 7, 0), true},
+		{"at the start", night, at(16, 22, 0), at(16, 22, 0), at(17, 7, 0), true},
+		{"at the end", night, at(17, 7, 0), time.Time{}, time.Time{}, false},
+		{"during the day", night, at(17, 12, 0), time.Time{}, time.Time{}, false},
+		{"same day", lunch, at(17, 12, 30), at(17, 12, 0), at(17, 13, 0), true},
+		{"after the same day", lunch, at(17, 13, 30), time.Time{}, time.Time{}, false},
+		{"disabled", QuietHours{}, at(17, 0, 0), time.Time{}, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		start, end, ok := tt.quiet.Period(tt.t)
+		if ok != tt.ok || !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("%s: got %v, %v, %v", tt.name, start, end, ok)
+		}
+	}
+
+	// the clocks go back at 04:00 on October 25th, so that night is an hour
+	// longer
+	start, end, _ := night.Period(at(25, 2, 0))
+	if got := end.Sub(start); got != 10*time.Hour {
+		t.Errorf("expected a night of 10 hours, got %s", got)
+	}
+}
@@ -0,0 +1,63 @@
+package preferences
+
+import (
+	"fmt"
+	"time"
+)
+
+// QuietHours is the time of the day during which notifications are held
+// back and sent together once it ends, e.g. from 22:00 to 07:00.
+type QuietHours struct {
+	// Start and End are minutes after midnight. Quiet hours end on the next
+	// day if End is before Start. They are disabled if both are equal, as in
+	// the zero value.
+	Start, End int
+}
+
+func (q QuietHours) Enabled() bool {
+	return q.Start != q.End
+}
+
+// Period returns the quiet period t falls in, in the location of t.
+func (q QuietHours) Period(t time.Time) (start, end time.Time, ok bool) {
+	if !q.Enabled() {
+		return time.Time{}, time.Time{}, false
+	}
+
+	y, m, d := t.Date()
+	at := func(dayOffset, minute int) time.Time {
+		return time.Date(y, m, d+dayOffset, 0, minute, 0, 0, t.Location())
+	}
+
+	if q.Start < q.End {
+		start, end = at(0, q.Start), at(0, q.End)
+	} else if minute := t.Hour()*60 + t.Minute(); minute >= q.Start {
+		start, end = at(0, q.Start), at(1, q.End)
+	} else {
+		start, end = at(-1, q.Start), at(0, q.End)
+	}
+
+	if t.Before(start) || !t.Before(end) {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, end, true
+}
+
+// ParseClock parses a time of the day such as "22:00" into minutes after
+// midnight.
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of the day %q, expected e.g. 22:00", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// FormatClock formats minutes after midnight, e.g. "07:30".
+func FormatClock(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
+
+func validMinute(minute int) bool {
+	return minute >= 0 && minute < 24*60
+}
@@ -0,0 +1,115 @@
+package product
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current parser output")
+
+// fixture is an ad page captured in testdata. Fixtures with a url can be
+// refreshed from the live page with cmd/refresh-fixtures, the others are
+// written by hand.
+type fixture struct {
+	Name   string `json:"name"`
+	URL    string `json:"url,omitempty"`
+	Status int    `json:"status"`
+}
+
+// goldenResult is what FetchProduct returned for a fixture.
+type goldenResult struct {
+	Product *Product `json:"product,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+func loadFixtures(t *testing.T) []fixture {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "fixtures.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixtures []fixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+	return fixtures
+}
+
+// fixtureServer serves testdata/<name>.html at /<name> with the status code
+// recorded for the fixture.
+func fixtureServer(t *testing.T, fixtures []fixture) *httptest.Server {
+	t.Helper()
+
+	statuses := map[string]int{}
+	for _, f := range fixtures {
+		statuses[f.Name] = f.Status
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		status, ok := statuses[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		page, err := os.ReadFile(filepath.Join("testdata", name+".html"))
+		if err != nil {
+			t.Errorf("failed to read fixture: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write(page)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestGoldenPages(t *testing.T) {
+	fixtures := loadFixtures(t)
+	server := fixtureServer(t, fixtures)
+
+	for _, f := range fixtures {
+		t.Run(f.Name, func(t *testing.T) {
+			var got goldenResult
+			product, err := FetchProduct(context.Background(), server.Client(), server.URL+"/"+f.Name)
+			got.Product = product
+			if err != nil {
+				got.Error = err.Error()
+			}
+
+			out, err := json.MarshalIndent(got, "", "    ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, '\n')
+
+			golden := filepath.Join("testdata", f.Name+".golden.json")
+			if *update {
+				if err := os.WriteFile(golden, out, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v, run the tests with -update to create it", err)
+			}
+			if !bytes.Equal(out, want) {
+				t.Errorf("output differs from %s, run the tests with -update and review the diff\ngot:\n%s", golden, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package product
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"slices"
+	"sort"
+)
+
+// jsonLDNode is a JSON-LD node with its properties left undecoded.
+type jsonLDNode map[string]json.RawMessage
+
+// jsonLDNodes flattens a JSON-LD document into its nodes. A document is a
+// single node, an array of documents, or a node listing more nodes in @graph.
+func jsonLDNodes(data []byte) ([]jsonLDNode, error) {
+	data = bytes.TrimSpace(data)
+
+	if bytes.HasPrefix(data, []byte("[")) {
+		var docs []json.RawMessage
+		if err := json.Unmarshal(data, &docs); err != nil {
+			return nil, err
+		}
+		var nodes []jsonLDNode
+		for _, doc := range docs {
+			docNodes, err := jsonLDNodes(doc)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, docNodes...)
+		}
+		return nodes, nil
+	}
+
+	var node jsonLDNode
+	if err := json.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+
+	graph, ok := node["@graph"]
+	if !ok {
+		return []jsonLDNode{node}, nil
+	}
+	nodes, err := jsonLDNodes(graph)
+	if err != nil {
+		return nil, err
+	}
+	// the nodes of the graph share the @context of the document
+	if jsonLDContext, ok := node["@context"]; ok {
+		for _, n := range nodes {
+			if _, ok := n["@context"]; !ok {
+				n["@context"] = jsonLDContext
+			}
+		}
+	}
+	if _, typed := node["@type"]; typed {
+		nodes = append([]jsonLDNode{node}, nodes...)
+	}
+	return nodes, nil
+}
+
+// hasType reports whether @type, a string or an array of strings, contains
+// typ.
+func (n jsonLDNode) hasType(typ string) bool {
+	raw, ok := n["@type"]
+	if !ok {
+		return false
+	}
+
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == typ
+	}
+	var multiple []string
+	if err := json.Unmarshal(raw, &multiple); err == nil {
+		return slices.Contains(multiple, typ)
+	}
+	return false
+}
+
+func (n jsonLDNode) decodeProduct() (*Product, error) {
+	// @type may be an array, like ["Product", "Vehicle"], but once picked
+	// the node is stored as a plain Product
+	n["@type"] = json.RawMessage(`"Product"`)
+	data, err := json.Marshal(n)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Product
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// decodeBreadcrumbs returns the items of a BreadcrumbList ordered by their
+// position. An item is either the url of the page or a node naming it.
+func (n jsonLDNode) decodeBreadcrumbs() ([]Breadcrumb, error) {
+	var items []struct {
+		Position int             `json:"position"`
+		Name     string          `json:"name"`
+		Item     json.RawMessage `json:"item"`
+	}
+	if err := json.Unmarshal(n["itemListElement"], &items); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Position < items[j].Position })
+
+	crumbs := make([]Breadcrumb, 0, len(items))
+	for _, item := range items {
+		crumb := Breadcrumb{Name: item.Name}
+		if len(item.Item) == 0 {
+			crumbs = append(crumbs, crumb)
+			continue
+		}
+		if err := json.Unmarshal(item.Item, &crumb.URL); err != nil {
+			var node struct {
+				ID   string `json:"@id"`
+				URL  string `json:"url"`
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(item.Item, &node); err != nil {
+				return nil, err
+			}
+			crumb.URL = cmp.Or(node.ID, node.URL)
+			crumb.Name = cmp.Or(crumb.Name, node.Name)
+		}
+		crumbs = append(crumbs, crumb)
+	}
+	return crumbs, nil
+}
@@ -0,0 +1,56 @@
+package product
+
+import (
+	"errors"
+	"time"
+)
+
+// FetchResult classifies the outcome of a FetchProduct call.
+type FetchResult string
+
+const (
+	FetchOK           FetchResult = "ok"
+	FetchDeactivated  FetchResult = "deactivated"
+	FetchParseError   FetchResult = "parse_error"
+	FetchHTTPStatus   FetchResult = "http_status"
+	FetchRequestError FetchResult = "request_error"
+)
+
+// ResultOf classifies an error returned by FetchProduct.
+func ResultOf(err error) FetchResult {
+	var statusErr *StatusError
+	switch {
+	case err == nil:
+		return FetchOK
+	case errors.Is(err, ErrAdDeactivated):
+		return FetchDeactivated
+	case errors.Is(err, ErrJSONLDNotFound), errors.Is(err, ErrInvalidJSONLD):
+		return FetchParseError
+	case errors.As(err, &statusErr):
+		return FetchHTTPStatus
+	default:
+		return FetchRequestError
+	}
+}
+
+// FetchObserver is told about every FetchProduct call. It lets the caller
+// collect metrics without this package depending on a metrics library.
+// statusCode is 0 if no response was received.
+type FetchObserver interface {
+	ObserveFetch(result FetchResult, statusCode int, duration time.Duration)
+}
+
+type noopFetchObserver struct{}
+
+func (noopFetchObserver) ObserveFetch(FetchResult, int, time.Duration) {}
+
+var fetchObserver FetchObserver = noopFetchObserver{}
+
+// SetFetchObserver installs o for all subsequent fetches. It is meant to be
+// called once at startup, before any fetch is made.
+func SetFetchObserver(o FetchObserver) {
+	if o == nil {
+		o = noopFetchObserver{}
+	}
+	fetchObserver = o
+}
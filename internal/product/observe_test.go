@@ -0,0 +1,92 @@
+package product
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResultOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want FetchResult
+	}{
+		{nil, FetchOK},
+		{ErrAdDeactivated, FetchDeactivated},
+		{ErrJSONLDNotFound, FetchParseError},
+		{fmt.Errorf("failed to parse product info: %w: %w", ErrInvalidJSONLD, errors.New("eof")), FetchParseError},
+		{&StatusError{StatusCode: http.StatusTooManyRequests}, FetchHTTPStatus},
+		{errors.New("connection refused"), FetchRequestError},
+	}
+
+	for _, tt := range tests {
+		if got := ResultOf(tt.err); got != tt.want {
+			t.Errorf("ResultOf(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+type recordingObserver struct {
+	results     []FetchResult
+	statusCodes []int
+}
+
+func (o *recordingObserver) ObserveFetch(result FetchResult, statusCode int, _ time.Duration) {
+	o.results = append(o.results, result)
+	o.statusCodes = append(o.statusCodes, statusCode)
+}
+
+func TestFetchProductObserver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		case "/throttled":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			fmt.Fprint(w, `<html><script type="application/ld+json">{"@type":"Product","name":"Mouse"}</script></html>`)
+		}
+	}))
+	defer server.Close()
+
+	observer := &recordingObserver{}
+	SetFetchObserver(observer)
+	defer SetFetchObserver(nil)
+
+	ctx := context.Background()
+	for _, path := range []string{"/ok", "/gone", "/throttled"} {
+		FetchProduct(ctx, server.Client(), server.URL+path)
+	}
+
+	wantResults := []FetchResult{FetchOK, FetchDeactivated, FetchHTTPStatus}
+	wantCodes := []int{http.StatusOK, http.StatusGone, http.StatusTooManyRequests}
+	for i := range wantResults {
+		if observer.results[i] != wantResults[i] || observer.statusCodes[i] != wantCodes[i] {
+			t.Errorf("fetch %d observed as %s/%d, want %s/%d",
+				i, observer.results[i], observer.statusCodes[i], wantResults[i], wantCodes[i])
+		}
+	}
+
+	var statusErr *StatusError
+	_, err := FetchProduct(ctx, server.Client(), server.URL+"/throttled")
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected a StatusError with 429, got %v", err)
+	}
+}
+
+func TestFetchProductTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte(" "), maxPageSize+1))
+	}))
+	defer server.Close()
+
+	_, err := FetchProduct(context.Background(), server.Client(), server.URL)
+	if err == nil || ResultOf(err) != FetchRequestError {
+		t.Errorf("expected the page to be rejected as too large, got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package product
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Ozoniuss/olx-tracker/internal/money"
+)
+
+// PriceKind tells what kind of price an offer has.
+type PriceKind string
+
+const (
+	// PriceFixed is a single price.
+	PriceFixed PriceKind = "fixed"
+	// PriceRange is a range of prices, from an AggregateOffer or a list of
+	// offers with different prices.
+	PriceRange PriceKind = "range"
+	// PriceFree is an item given away, with a zero price.
+	PriceFree PriceKind = "free"
+	// PriceOnRequest is an offer without a price.
+	PriceOnRequest PriceKind = "on_request"
+)
+
+// freePrices are the prices written as text that mean the item is free.
+var freePrices = []string{"free", "gratuit", "gratis"}
+
+// offerFields has the fields of Offer without its UnmarshalJSON.
+type offerFields Offer
+
+// UnmarshalJSON decodes the offers of a product, which may be:
+//
+//   - an Offer, with a price that is a number or a string like "449.00"
+//   - an AggregateOffer, with lowPrice and highPrice, or with its offers
+//   - an array of offers, merged into a single one
+//   - an offer without a price, or with a zero price
+//
+// Prices are parsed from their decimal text straight into small units.
+func (o *Offer) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		var offers []Offer
+		if err := json.Unmarshal(data, &offers); err != nil {
+			return err
+		}
+		merged, err := mergeOffers(offers)
+		if err != nil {
+			return err
+		}
+		*o = merged
+		return nil
+	}
+
+	var raw struct {
+		offerFields
+		Price     json.RawMessage `json:"price"`
+		LowPrice  json.RawMessage `json:"lowPrice"`
+		HighPrice json.RawMessage `json:"highPrice"`
+		Offers    json.RawMessage `json:"offers"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*o = Offer(raw.offerFields)
+
+	price, err := parsePrice(raw.Price)
+	if err != nil {
+		return err
+	}
+	low, err := parsePrice(raw.LowPrice)
+	if err != nil {
+		return err
+	}
+	high, err := parsePrice(raw.HighPrice)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case low.ok || high.ok:
+		// an AggregateOffer may give only one end of the range
+		if !low.ok {
+			low = price
+		}
+		if !low.ok {
+			low = high
+		}
+		if !high.ok {
+			high = low
+		}
+		if low.smallUnit > high.smallUnit {
+			return fmt.Errorf("invalid price range %s-%s", money.MajorUnits(low.smallUnit), money.MajorUnits(high.smallUnit))
+		}
+		o.setPrices(low.smallUnit, high.smallUnit)
+	case price.ok:
+		o.setPrices(price.smallUnit, price.smallUnit)
+	case len(raw.Offers) > 0 && string(raw.Offers) != "null":
+		var nested Offer
+		if err := json.Unmarshal(raw.Offers, &nested); err != nil {
+			return err
+		}
+		o.PriceKind = nested.PriceKind
+		o.PriceSmallUnit, o.HighPriceSmallUnit = nested.PriceSmallUnit, nested.HighPriceSmallUnit
+		if o.PriceCurrency == "" {
+			o.PriceCurrency = nested.PriceCurrency
+		}
+		if o.Availability == "" {
+			o.Availability = nested.Availability
+		}
+	case o.PriceKind != "":
+		// an offer encoded by this package, with the prices already parsed
+	default:
+		o.setPrices(0, 0)
+		o.PriceKind = PriceOnRequest
+	}
+	return nil
+}
+
+// setPrices sets the prices and the matching kind.
+func (o *Offer) setPrices(low, high int64) {
+	o.PriceSmallUnit, o.HighPriceSmallUnit = low, 0
+	switch {
+	case low != high:
+		o.PriceKind = PriceRange
+		o.HighPriceSmallUnit = high
+	case low == 0:
+		o.PriceKind = PriceFree
+	default:
+		o.PriceKind = PriceFixed
+	}
+}
+
+// mergeOffers turns a list of offers into one, with the price range of all
+// of them and the other details of the first one.
+func mergeOffers(offers []Offer) (Offer, error) {
+	if len(offers) == 0 {
+		return Offer{PriceKind: PriceOnRequest}, nil
+	}
+
+	merged := offers[0]
+	var priced []Offer
+	for _, offer := range offers {
+		if offer.PriceKind != PriceOnRequest {
+			priced = append(priced, offer)
+		}
+	}
+	if len(priced) == 0 {
+		return merged, nil
+	}
+
+	low, high := priced[0].PriceSmallUnit, priced[0].PriceSmallUnit
+	currency := priced[0].PriceCurrency
+	for _, offer := range priced {
+		if offer.PriceCurrency != currency {
+			return Offer{}, fmt.Errorf("offers are priced in both %s and %s", currency, offer.PriceCurrency)
+		}
+		low = min(low, offer.PriceSmallUnit)
+		high = max(high, offer.PriceSmallUnit, offer.HighPriceSmallUnit)
+	}
+
+	merged.PriceCurrency = currency
+	merged.setPrices(low, high)
+	return merged, nil
+}
+
+type parsedPrice struct {
+	smallUnit int64
+	ok        bool
+}
+
+// parsePrice parses a price given as a JSON number or string. A missing,
+// null or empty price is not an error, it's just not there.
+func parsePrice(raw json.RawMessage) (parsedPrice, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return parsedPrice{}, nil
+	}
+
+	text := string(raw)
+	if raw[0] == '"' {
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return parsedPrice{}, err
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return parsedPrice{}, nil
+		}
+		for _, free := range freePrices {
+			if strings.EqualFold(text, free) {
+				return parsedPrice{ok: true}, nil
+			}
+		}
+	}
+
+	smallUnit, err := parseDecimal(text)
+	if err != nil {
+		return parsedPrice{}, err
+	}
+	return parsedPrice{smallUnit: smallUnit, ok: true}, nil
+}
+
+// parseDecimal parses a price in major units into small units. Unlike
+// money.ParseMajorUnits it accepts the "449.000" of some JSON encoders and
+// spaces between the thousands, as long as the digits past the second
+// decimal are zeros.
+func parseDecimal(s string) (int64, error) {
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\u00a0' {
+			return -1
+		}
+		return r
+	}, s)
+
+	if whole, frac, ok := strings.Cut(strings.ReplaceAll(s, ",", "."), "."); ok && len(frac) > 2 {
+		if strings.Trim(frac[2:], "0") != "" {
+			return 0, fmt.Errorf("invalid price %q: more than two decimals", s)
+		}
+		s = whole + "." + frac[:2]
+	}
+	return money.ParseMajorUnits(s)
+}
+
+// FormatPrice formats a stored price according to its kind, e.g.
+// "150.00 - 220.50 RON" for a range. high is only used for ranges.
+func FormatPrice(locale money.Locale, kind PriceKind, smallUnit int64, high sql.NullInt64, currency string) string {
+	switch kind {
+	case PriceOnRequest:
+		return "on request"
+	case PriceFree:
+		return "free"
+	case PriceRange:
+		if high.Valid {
+			return locale.MajorUnits(smallUnit) + " - " + locale.Format(high.Int64, currency)
+		}
+	}
+	return locale.Format(smallUnit, currency)
+}
@@ -0,0 +1,49 @@
+package product
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	valid := map[string]int64{
+		"19.99":    1999,
+		"449":      44900,
+		"449.000":  44900,
+		"1 234,50": 123450,
+		"1 234":    123400,
+		"0.1":      10,
+	}
+	for in, want := range valid {
+		got, err := parseDecimal(in)
+		if err != nil || got != want {
+			t.Errorf("parseDecimal(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"449.999", "1e3", "-5", "1.234,56", "abc"} {
+		if _, err := parseDecimal(in); err == nil {
+			t.Errorf("parseDecimal(%q) should fail", in)
+		}
+	}
+}
+
+func TestOfferRoundTrip(t *testing.T) {
+	// snapshots store the product as encoded by this package, which must
+	// decode to the same offer
+	var offer Offer
+	if err := json.Unmarshal([]byte(`{"@type":"AggregateOffer","priceCurrency":"RON","lowPrice":10,"highPrice":"25"}`), &offer); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Offer
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != offer {
+		t.Errorf("got %+v, want %+v", decoded, offer)
+	}
+}
@@ -1,66 +1,152 @@
 package product
 
 import (
+	"bytes"
+	"cmp"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"strings"
+	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/html"
+
+	"github.com/Ozoniuss/olx-tracker/internal/tracing"
+)
+
+var (
+	ErrAdDeactivated  = errors.New("olx ad was deactivated")
+	ErrJSONLDNotFound = errors.New("product json-ld not found")
+	ErrInvalidJSONLD  = errors.New("invalid product json-ld")
 )
 
-var ErrAdDeactivated = errors.New("olx ad was deactivated")
+// StatusError is returned when OLX answers with an unexpected status code.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request responded with status %d", e.StatusCode)
+}
+
+const tracerName = "github.com/Ozoniuss/olx-tracker/internal/product"
+
+// maxPageSize caps the size of a downloaded ad page. Ad pages are a few
+// hundred kilobytes, anything bigger isn't an ad.
+const maxPageSize = 10 << 20
 
 func FetchProduct(
 	ctx context.Context,
 	client *http.Client,
 	url string,
-) (*Product, error) {
+) (_ *Product, err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "FetchProduct",
+		trace.WithAttributes(semconv.URLFull(url)),
+	)
+	defer tracing.End(span, &err)
+
+	start := time.Now()
+	product, statusCode, err := fetchProduct(ctx, client, url)
+	fetchObserver.ObserveFetch(ResultOf(err), statusCode, time.Since(start))
+	return product, err
+}
+
+func fetchProduct(
+	ctx context.Context,
+	client *http.Client,
+	url string,
+) (*Product, int, error) {
+	page, statusCode, err := fetchPage(ctx, client, url)
+	if err != nil {
+		return nil, statusCode, err
+	}
+	product, err := parsePage(ctx, page)
+	return product, statusCode, err
+}
+
+// fetchPage downloads the ad page and returns its body along with the status
+// code of the response.
+func fetchPage(
+	ctx context.Context,
+	client *http.Client,
+	url string,
+) (_ []byte, _ int, err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "GET",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPRequestMethodGet, semconv.URLFull(url)),
+	)
+	defer tracing.End(span, &err)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, 0, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
 
 	// OLX sends 410 for deactivated ads
 	if resp.StatusCode == http.StatusGone {
-		return nil, ErrAdDeactivated
+		return nil, resp.StatusCode, ErrAdDeactivated
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("request responded with status %d", resp.StatusCode)
+		return nil, resp.StatusCode, &StatusError{StatusCode: resp.StatusCode}
 	}
 
-	z := html.NewTokenizer(resp.Body)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize+1))
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(body) > maxPageSize {
+		return nil, resp.StatusCode, fmt.Errorf("page is larger than %d bytes", maxPageSize)
+	}
+	span.SetAttributes(semconv.HTTPResponseBodySize(len(body)))
+
+	return body, resp.StatusCode, nil
+}
+
+// parsePage collects the JSON-LD blocks of the ad page and parses the
+// product out of them.
+func parsePage(ctx context.Context, page []byte) (_ *Product, err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "tokenize html")
+	defer tracing.End(span, &err)
+
+	var blocks []string
+	z := html.NewTokenizer(bytes.NewReader(page))
 	for {
-		switch z.Next() {
-		case html.ErrorToken:
-			// some AD urls may return a 200 even though the page never existed
-			// and eventually OLX will redirect to a 404 page. But it's written
-			// as a garbage SPA and this redirect is implemented with javascript.
-			// Moreover it will return different error messages depending on
-			// the URL (IDxxx fails differently than simple xxxx)
-			return nil, errors.New("product json-ld not found")
-
-		case html.StartTagToken:
-			t := z.Token()
-			if t.Data == "script" && hasJSONLDType(t.Attr) {
-				if z.Next() == html.TextToken {
-					raw := strings.TrimSpace(z.Token().Data)
-					return parseJSONLD(raw)
-				}
-			}
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt != html.StartTagToken {
+			continue
+		}
+		t := z.Token()
+		if t.Data == "script" && hasJSONLDType(t.Attr) && z.Next() == html.TextToken {
+			blocks = append(blocks, strings.TrimSpace(z.Token().Data))
 		}
 	}
+
+	if len(blocks) == 0 {
+		// some AD urls may return a 200 even though the page never existed
+		// and eventually OLX will redirect to a 404 page. But it's written
+		// as a garbage SPA and this redirect is implemented with javascript.
+		// Moreover it will return different error messages depending on
+		// the URL (IDxxx fails differently than simple xxxx)
+		return nil, ErrJSONLDNotFound
+	}
+	return parseJSONLD(ctx, blocks)
 }
 
 func hasJSONLDType(attrs []html.Attribute) bool {
@@ -72,12 +158,50 @@ func hasJSONLDType(attrs []html.Attribute) bool {
 	return false
 }
 
-func parseJSONLD(data string) (*Product, error) {
-	var productInfo Product
-	if err := json.Unmarshal([]byte(data), &productInfo); err != nil {
-		log.Println("Invalid JSON-LD:", err)
-		return nil, fmt.Errorf("failed to parse product info: %w", err)
+// parseJSONLD picks the first Product node out of the JSON-LD blocks, along
+// with the category path of the first BreadcrumbList. Blocks that fail to
+// parse only matter if no product is found in the others.
+func parseJSONLD(ctx context.Context, blocks []string) (_ *Product, err error) {
+	_, span := otel.Tracer(tracerName).Start(ctx, "parse json-ld",
+		trace.WithAttributes(attribute.Int("jsonld.blocks", len(blocks))),
+	)
+	defer tracing.End(span, &err)
+
+	var (
+		product    *Product
+		crumbs     []Breadcrumb
+		invalidErr error
+	)
+	for _, block := range blocks {
+		nodes, err := jsonLDNodes([]byte(block))
+		if err != nil {
+			invalidErr = cmp.Or(invalidErr, err)
+			continue
+		}
+
+		for _, node := range nodes {
+			switch {
+			case product == nil && node.hasType("Product"):
+				p, err := node.decodeProduct()
+				if err != nil {
+					invalidErr = cmp.Or(invalidErr, err)
+					continue
+				}
+				product = p
+			case crumbs == nil && node.hasType("BreadcrumbList"):
+				// the category path is nice to have, a broken one is skipped
+				crumbs, _ = node.decodeBreadcrumbs()
+			}
+		}
+	}
+
+	if product == nil {
+		if invalidErr != nil {
+			return nil, fmt.Errorf("failed to parse product info: %w: %w", ErrInvalidJSONLD, invalidErr)
+		}
+		return nil, ErrJSONLDNotFound
 	}
 
-	return &productInfo, nil
+	product.CategoryPath = crumbs
+	return product, nil
 }
@@ -0,0 +1,78 @@
+package product
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestFetchProductSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(prev)
+
+	const page = `<html><script type="application/ld+json">{"@type":"Product","name":"Mouse"}</script></html>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			fmt.Fprint(w, `<html><script type="application/ld+json">{</script></html>`)
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+	defer server.Close()
+
+	if _, err := FetchProduct(context.Background(), server.Client(), server.URL+"/ok"); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans().Snapshots()
+	byName := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range spans {
+		byName[s.Name()] = s
+	}
+	for _, name := range []string{"FetchProduct", "GET", "tokenize html", "parse json-ld"} {
+		if _, ok := byName[name]; !ok {
+			t.Fatalf("missing span %q, got %d spans", name, len(spans))
+		}
+	}
+
+	root := byName["FetchProduct"]
+	for _, name := range []string{"GET", "tokenize html"} {
+		if byName[name].Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("span %q is not a child of FetchProduct", name)
+		}
+	}
+	if byName["parse json-ld"].Parent().SpanID() != byName["tokenize html"].SpanContext().SpanID() {
+		t.Error(`span "parse json-ld" is not a child of "tokenize html"`)
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range byName["GET"].Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if got := attrs["http.response.status_code"].AsInt64(); got != http.StatusOK {
+		t.Errorf("got status attribute %d, want 200", got)
+	}
+	if got := attrs["http.response.body.size"].AsInt64(); got != int64(len(page)) {
+		t.Errorf("got size attribute %d, want %d", got, len(page))
+	}
+
+	exporter.Reset()
+	if _, err := FetchProduct(context.Background(), server.Client(), server.URL+"/broken"); err == nil {
+		t.Fatal("expected a parse error")
+	}
+	for _, s := range exporter.GetSpans().Snapshots() {
+		if s.Name() != "GET" && s.Status().Code != codes.Error {
+			t.Errorf("span %q has status %v, want error", s.Name(), s.Status().Code)
+		}
+	}
+}
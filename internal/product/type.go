@@ -1,7 +1,5 @@
 package product
 
-import "fmt"
-
 type Product struct {
 	Context     string   `json:"@context"`
 	Type        string   `json:"@type"`
@@ -12,16 +10,43 @@ type Product struct {
 	Category    string   `json:"category"`
 	SKU         string   `json:"sku"`
 	Offers      Offer    `json:"offers"`
+	// CategoryPath is taken from the BreadcrumbList next to the product,
+	// from the home page down to the category of the ad.
+	CategoryPath []Breadcrumb `json:"categoryPath,omitempty"`
 }
 
+type Breadcrumb struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Offer is decoded from any of the offer variants listed in offer.go, so the
+// prices are not the schema.org properties but what was made of them.
 type Offer struct {
-	Type          string   `json:"@type"`
-	Availability  string   `json:"availability"`
-	AreaServed    Area     `json:"areaServed"`
-	PriceCurrency string   `json:"priceCurrency"`
-	Price         float64  `json:"price"`
-	Shipping      Shipping `json:"shippingDetails"`
-	ItemCondition string   `json:"itemCondition"`
+	Type          string `json:"@type"`
+	Availability  string `json:"availability"`
+	AreaServed    Area   `json:"areaServed"`
+	PriceCurrency string `json:"priceCurrency"`
+	// PriceKind tells how to read the prices, which are in small units.
+	PriceKind PriceKind `json:"priceKind"`
+	// PriceSmallUnit is the price, or the lowest price of a range.
+	PriceSmallUnit int64 `json:"priceSmallUnit"`
+	// HighPriceSmallUnit is the highest price of a range.
+	HighPriceSmallUnit int64    `json:"highPriceSmallUnit,omitempty"`
+	Shipping           Shipping `json:"shippingDetails"`
+	ItemCondition      string   `json:"itemCondition"`
+	// Seller is nil when the ad doesn't name one.
+	Seller *Seller `json:"seller,omitempty"`
+}
+
+// Seller is the Person or Organization selling the item.
+type Seller struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+	// FoundingDate is when an Organization was founded, which for a seller
+	// on OLX is when its account was created. Most ads don't have it.
+	FoundingDate string `json:"foundingDate,omitempty"`
 }
 
 type Area struct {
@@ -44,12 +69,3 @@ type Region struct {
 	Type           string `json:"@type"`
 	AddressCountry string `json:"addressCountry"`
 }
-
-func PrintRelevantProductInfo(p *Product) {
-	fmt.Printf("Name: %s\n", p.Name)
-	fmt.Printf("Description: %s\n", p.Description)
-	fmt.Printf("URL: %s\n", p.URL)
-	fmt.Printf("Price: %.2f %s\n", p.Offers.Price, p.Offers.PriceCurrency)
-	fmt.Printf("Availability: %s\n", p.Offers.Availability)
-	fmt.Printf("Condition: %s\n", p.Offers.ItemCondition)
-}
@@ -0,0 +1,53 @@
+package product
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrInvalidURL     = errors.New("invalid url")
+	ErrUnsupportedURL = errors.New("not an olx.ro ad url")
+)
+
+// NormalizeURL turns an ad link into the canonical form OLX uses in the
+// JSON-LD of the ad, so that the same ad is never tracked twice under
+// different links. Query parameters and fragments (search position, tracking
+// ids) are dropped, the host is always www.olx.ro and the legacy /oferta/
+// path is rewritten to /d/oferta/.
+func NormalizeURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrInvalidURL
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", ErrInvalidURL
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", ErrInvalidURL
+	}
+
+	switch strings.ToLower(u.Hostname()) {
+	case "olx.ro", "www.olx.ro", "m.olx.ro":
+	default:
+		return "", ErrUnsupportedURL
+	}
+
+	path := u.Path
+	if strings.HasPrefix(path, "/oferta/") {
+		path = "/d" + path
+	}
+	if !strings.HasPrefix(path, "/d/oferta/") || !strings.HasSuffix(path, ".html") {
+		return "", ErrUnsupportedURL
+	}
+
+	normalized := url.URL{
+		Scheme: "https",
+		Host:   "www.olx.ro",
+		Path:   path,
+	}
+	return normalized.String(), nil
+}
@@ -0,0 +1,38 @@
+package product
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	const canonical = "https://www.olx.ro/d/oferta/mouse-gaming-logitech-pro-x-superlight-IDkbEDA.html"
+
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr error
+	}{
+		{raw: canonical, want: canonical},
+		{raw: "  " + canonical + "\n", want: canonical},
+		{raw: canonical + "?reason=extended_search#gallery", want: canonical},
+		{raw: "http://olx.ro/d/oferta/mouse-gaming-logitech-pro-x-superlight-IDkbEDA.html", want: canonical},
+		{raw: "https://m.olx.ro/oferta/mouse-gaming-logitech-pro-x-superlight-IDkbEDA.html", want: canonical},
+		{raw: "", wantErr: ErrInvalidURL},
+		{raw: "not a url", wantErr: ErrInvalidURL},
+		{raw: "ftp://www.olx.ro/d/oferta/x.html", wantErr: ErrInvalidURL},
+		{raw: "https://www.olx.pl/d/oferta/x.html", wantErr: ErrUnsupportedURL},
+		{raw: "https://www.olx.ro/electronice-si-electrocasnice/", wantErr: ErrUnsupportedURL},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeURL(tt.raw)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("NormalizeURL(%q) error = %v, want %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package repost recognizes ads that were deleted and posted again under a
+// new id, which sellers do to bump them to the top of the listings. An ad is
+// fingerprinted by perceptual hashes of its images, the shingles of its
+// description, its seller and its location, and a new ad matching the
+// fingerprint of a deactivated one is taken to be a repost of it.
+package repost
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+	"slices"
+	"strings"
+	"unicode"
+
+	_ "golang.org/x/image/webp"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Fingerprint is what two ads are compared by.
+type Fingerprint struct {
+	// ImageHashes are perceptual hashes of the images, see ImageHash.
+	ImageHashes []uint64
+	// ImageURLs are the urls of the hashed images, in the same order. They
+	// aren't compared, only kept to reuse the hashes of unchanged images.
+	ImageURLs []string
+	// Shingles are the hashes of the word shingles of the normalized title
+	// and description, sorted and without duplicates.
+	Shingles []uint64
+	// Seller and Location are empty when unknown.
+	Seller   string
+	Location string
+}
+
+// maxImagePixels caps the size of the images that are hashed. A small file
+// can claim huge dimensions, and decoding it would allocate all of them.
+const maxImagePixels = 50_000_000
+
+// ErrImageTooLarge is returned for images with more than maxImagePixels.
+var ErrImageTooLarge = errors.New("image too large")
+
+// ImageHash decodes an image and returns its difference hash: the image is
+// shrunk to 9x8 grayscale pixels and every bit tells whether a pixel is
+// brighter than its right neighbour. Resizing, recompressing or slightly
+// changing the colors of an image keep the hash within a few bits.
+func ImageHash(data []byte) (uint64, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	if int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return 0, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+
+	const w, h = 9, 8
+	var gray [h][w]float64
+	bounds := img.Bounds()
+	for y := range h {
+		for x := range w {
+			gray[y][x] = averageLuma(img, image.Rect(
+				bounds.Min.X+x*bounds.Dx()/w,
+				bounds.Min.Y+y*bounds.Dy()/h,
+				bounds.Min.X+(x+1)*bounds.Dx()/w,
+				bounds.Min.Y+(y+1)*bounds.Dy()/h,
+			))
+		}
+	}
+
+	var hash uint64
+	for y := range h {
+		for x := range w - 1 {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+// averageLuma is the mean brightness of the pixels in r, which is at least
+// one pixel even for images smaller than the hash.
+func averageLuma(img image.Image, r image.Rectangle) float64 {
+	if r.Dx() == 0 {
+		r.Max.X = r.Min.X + 1
+	}
+	if r.Dy() == 0 {
+		r.Max.Y = r.Min.Y + 1
+	}
+
+	var sum float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cr, cg, cb, _ := img.At(x, y).RGBA()
+			sum += 0.299*float64(cr) + 0.587*float64(cg) + 0.114*float64(cb)
+		}
+	}
+	return sum / float64(r.Dx()*r.Dy())
+}
+
+// HammingDistance is the number of bits two image hashes differ in.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// shingleSize is the number of words in a shingle.
+const shingleSize = 3
+
+// Shingles returns the hashes of every run of shingleSize words in the
+// normalized text. Texts shorter than that are a single shingle.
+func Shingles(text string) []uint64 {
+	words := strings.Fields(Normalize(text))
+	if len(words) == 0 {
+		return nil
+	}
+
+	var shingles []uint64
+	for i := 0; i+shingleSize <= max(len(words), shingleSize); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:min(i+shingleSize, len(words))], " ")))
+		shingles = append(shingles, h.Sum64())
+	}
+	slices.Sort(shingles)
+	return slices.Compact(shingles)
+}
+
+// Normalize lowercases the text, drops diacritics (so "ș" and "s" match, as
+// sellers use both) and replaces punctuation and runs of whitespace with a
+// single space.
+func Normalize(text string) string {
+	stripped, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), text)
+	if err != nil {
+		stripped = text
+	}
+
+	var b strings.Builder
+	space := true
+	for _, r := range strings.ToLower(stripped) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		if !space {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Jaccard is the share of shingles two sorted sets have in common.
+func Jaccard(a, b []uint64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	common := 0
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			common++
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
@@ -0,0 +1,88 @@
+package repost
+
+import "strings"
+
+const (
+	// maxImageDistance is the most bits the hashes of two images may differ
+	// in for them to be the same picture.
+	maxImageDistance = 10
+
+	// MatchThreshold is the lowest score of a repost.
+	MatchThreshold = 0.6
+)
+
+// The weights of the signals in a score. Signals that are unknown for
+// either ad are left out of it.
+const (
+	imagesWeight      = 0.5
+	descriptionWeight = 0.35
+	locationWeight    = 0.15
+	sellerWeight      = 0.2
+)
+
+// Score tells how likely it is that two ads are the same one, from 0 to 1.
+// Ads of different sellers never match, and neither do ads that can only be
+// compared by seller and location.
+func Score(a, b Fingerprint) float64 {
+	if a.Seller != "" && b.Seller != "" && !strings.EqualFold(a.Seller, b.Seller) {
+		return 0
+	}
+
+	var score, weight, contentWeight float64
+	if len(a.ImageHashes) > 0 && len(b.ImageHashes) > 0 {
+		score += imagesWeight * imageSimilarity(a.ImageHashes, b.ImageHashes)
+		weight += imagesWeight
+		contentWeight += imagesWeight
+	}
+	if len(a.Shingles) > 0 && len(b.Shingles) > 0 {
+		score += descriptionWeight * Jaccard(a.Shingles, b.Shingles)
+		weight += descriptionWeight
+		contentWeight += descriptionWeight
+	}
+	if contentWeight == 0 {
+		return 0
+	}
+
+	if a.Location != "" && b.Location != "" {
+		if Normalize(a.Location) == Normalize(b.Location) {
+			score += locationWeight
+		}
+		weight += locationWeight
+	}
+	if a.Seller != "" && b.Seller != "" {
+		score += sellerWeight
+		weight += sellerWeight
+	}
+	return score / weight
+}
+
+// imageSimilarity is the share of the images of the ad with fewer images
+// that also show up in the other one.
+func imageSimilarity(a, b []uint64) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+
+	found := 0
+	for _, ha := range a {
+		for _, hb := range b {
+			if HammingDistance(ha, hb) <= maxImageDistance {
+				found++
+				break
+			}
+		}
+	}
+	return float64(found) / float64(len(a))
+}
+
+// BestMatch returns the index of the candidate that fp is most likely a
+// repost of, and its score, or -1 if none scores at least MatchThreshold.
+func BestMatch(fp Fingerprint, candidates []Fingerprint) (int, float64) {
+	best, bestScore := -1, 0.0
+	for i, c := range candidates {
+		if score := Score(fp, c); score >= MatchThreshold && score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best, bestScore
+}
@@ -0,0 +1,146 @@
+package repost
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"testing"
+)
+
+// testImage draws a gradient with a dark square, at any size. A mirrored
+// image is a different picture as far as the hash is concerned.
+func testImage(w, h int, squareAt float64, mirrored bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			v := uint8(255 * x / w)
+			if mirrored {
+				v = 255 - v
+			}
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			if fx > squareAt && fx < squareAt+0.3 && fy > 0.3 && fy < 0.6 {
+				v = 20
+			}
+			img.Set(x, y, color.RGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+	return img
+}
+
+func TestImageHash(t *testing.T) {
+	var original, resized, other bytes.Buffer
+	png.Encode(&original, testImage(400, 300, 0.2, false))
+	// a repost usually has the same photo, resized and recompressed
+	jpeg.Encode(&resized, testImage(200, 150, 0.2, false), &jpeg.Options{Quality: 60})
+	png.Encode(&other, testImage(400, 300, 0.6, true))
+
+	hashes := make([]uint64, 3)
+	for i, data := range [][]byte{original.Bytes(), resized.Bytes(), other.Bytes()} {
+		hash, err := ImageHash(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[i] = hash
+	}
+
+	if d := HammingDistance(hashes[0], hashes[1]); d > maxImageDistance {
+		t.Errorf("resized image is %d bits away", d)
+	}
+	if d := HammingDistance(hashes[0], hashes[2]); d <= maxImageDistance {
+		t.Errorf("different image is only %d bits away", d)
+	}
+
+	if _, err := ImageHash([]byte("not an image")); err == nil {
+		t.Error("expected an error for invalid images")
+	}
+
+	// a valid header claiming 100000x100000 pixels is rejected before the
+	// pixels are allocated
+	bomb := slices.Clone(original.Bytes())
+	binary.BigEndian.PutUint32(bomb[16:], 100000)
+	binary.BigEndian.PutUint32(bomb[20:], 100000)
+	binary.BigEndian.PutUint32(bomb[29:], crc32.ChecksumIEEE(bomb[12:29]))
+	if _, err := ImageHash(bomb); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("expected ErrImageTooLarge, got %v", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"Bicicletă   copii, 16\"!":   "bicicleta copii 16",
+		"Șină ŞI ţeavă":              "sina si teava",
+		"  PREȚ FIX -- fără schimb ": "pret fix fara schimb",
+	}
+	for in, want := range tests {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestShingles(t *testing.T) {
+	a := Shingles("Vând bicicletă copii 16 inch, stare foarte bună")
+	b := Shingles("vand bicicleta copii 16 inch - stare foarte buna!!")
+	if Jaccard(a, b) != 1 {
+		t.Errorf("same text with other diacritics and punctuation should match, got %v", Jaccard(a, b))
+	}
+
+	c := Shingles("Vând bicicletă copii 16 inch, stare foarte bună, roți ajutătoare incluse")
+	if j := Jaccard(a, c); j < 0.5 || j == 1 {
+		t.Errorf("extended description got jaccard %v", j)
+	}
+
+	if len(Shingles("mouse")) != 1 || Shingles("") != nil {
+		t.Error("short texts should be a single shingle and empty ones none")
+	}
+}
+
+func TestScore(t *testing.T) {
+	ad := Fingerprint{
+		ImageHashes: []uint64{0xF0F0F0F0F0F0F0F0, 0x0123456789ABCDEF},
+		Shingles:    Shingles("Vând bicicletă copii 16 inch, stare foarte bună"),
+		Seller:      "Andrei",
+		Location:    "Cluj-Napoca",
+	}
+
+	repost := ad
+	// one bit off, as after recompressing, and only one of the images
+	repost.ImageHashes = []uint64{0xF0F0F0F0F0F0F0F1}
+	repost.Shingles = Shingles("Vand bicicleta copii 16 inch, stare foarte buna. Pret negociabil")
+	if score := Score(ad, repost); score < MatchThreshold {
+		t.Errorf("repost scored %v", score)
+	}
+
+	otherSeller := repost
+	otherSeller.Seller = "Maria"
+	if score := Score(ad, otherSeller); score != 0 {
+		t.Errorf("ad of another seller scored %v", score)
+	}
+
+	unrelated := Fingerprint{
+		ImageHashes: []uint64{0x0F0F0F0F0F0F0F0F},
+		Shingles:    Shingles("Canapea extensibilă, 3 locuri"),
+		Location:    "Cluj-Napoca",
+	}
+	if score := Score(ad, unrelated); score >= MatchThreshold {
+		t.Errorf("unrelated ad scored %v", score)
+	}
+
+	if score := Score(Fingerprint{Seller: "Andrei", Location: "Iasi"}, Fingerprint{Seller: "Andrei", Location: "Iasi"}); score != 0 {
+		t.Errorf("ads without content scored %v", score)
+	}
+
+	best, _ := BestMatch(repost, []Fingerprint{unrelated, otherSeller, ad})
+	if best != 2 {
+		t.Errorf("got best match %d, want 2", best)
+	}
+	if best, _ := BestMatch(repost, []Fingerprint{unrelated}); best != -1 {
+		t.Errorf("got best match %d, want none", best)
+	}
+}
@@ -0,0 +1,161 @@
+// Package risk scores how likely an ad is a scam, from heuristics that are
+// cheap enough to run on every snapshot. A score is a warning for the buyer
+// to be careful before contacting the seller, not a verdict.
+package risk
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Ozoniuss/olx-tracker/internal/money"
+	"github.com/Ozoniuss/olx-tracker/internal/repost"
+)
+
+// WarnScore is the score from which buyers are warned about an ad.
+const WarnScore = 40
+
+// Reason is a heuristic that matched, with how much it added to the score.
+type Reason struct {
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+	Points int    `json:"points"`
+}
+
+// Assessment is the outcome of Assess. Score goes from 0, nothing suspicious,
+// to 100.
+type Assessment struct {
+	Score   int
+	Reasons []Reason
+}
+
+// Input is what an ad is assessed on. Zero values mean unknown, and the
+// heuristics that need them are skipped.
+type Input struct {
+	Name        string
+	Description string
+	// PriceSmallUnit is the fixed price of the ad, zero for other kinds of
+	// prices.
+	PriceSmallUnit int64
+	Currency       string
+	// MedianSmallUnit is the median price of SimilarAds ads in the same
+	// category and currency.
+	MedianSmallUnit int64
+	SimilarAds      int
+	// SellerSince is when the account of the seller was created.
+	SellerSince time.Time
+	// ImageReuse is how many ads of other sellers show one of the images of
+	// this ad.
+	ImageReuse int
+	Now        time.Time
+}
+
+const (
+	// minSimilarAds is how many similar ads a median needs to be trusted.
+	minSimilarAds = 5
+	// newSellerAge is how young an account is considered brand new.
+	newSellerAge = 30 * 24 * time.Hour
+	// minImageReuse is in how many other ads an image must show up to be
+	// considered a stock or stolen photo.
+	minImageReuse = 3
+)
+
+var (
+	// the phrases are matched against the normalized text, without
+	// diacritics or punctuation
+	courierPhrases = []string{
+		"doar prin curier",
+		"numai prin curier",
+		"doar curier",
+		"numai curier",
+		"livrare doar prin",
+		"nu predau personal",
+		"fara predare personala",
+		"courier only",
+		"only by courier",
+	}
+	paymentLinkPhrases = []string{
+		"link de plata",
+		"link plata",
+		"link pentru plata",
+		"payment link",
+	}
+	abroadPhrases = []string{
+		"sunt plecat din tara",
+		"sunt in strainatate",
+		"ma aflu in strainatate",
+	}
+
+	// links and phones are matched against the raw text
+	linkPattern     = regexp.MustCompile(`(?i)\bhttps?://\S+|\bwww\.\S+|\b[a-z0-9-]+\.(?:ly|link|page|me)/\S*`)
+	phonePattern    = regexp.MustCompile(`(?:\+\s?40|\b0)\s?7\d{2}[\s.-]?\d{3}[\s.-]?\d{3}\b`)
+	whatsappPattern = regexp.MustCompile(`(?i)whats\s?app|\bwa\.me\b`)
+)
+
+// Assess scores an ad. The reasons are in a fixed order, so the same ad
+// always gets the same assessment.
+func Assess(in Input) Assessment {
+	var reasons []Reason
+	add := func(code string, points int, format string, args ...any) {
+		reasons = append(reasons, Reason{Code: code, Detail: fmt.Sprintf(format, args...), Points: points})
+	}
+
+	if in.PriceSmallUnit > 0 && in.SimilarAds >= minSimilarAds && in.MedianSmallUnit > 0 {
+		ratio := float64(in.PriceSmallUnit) / float64(in.MedianSmallUnit)
+		median := money.Format(in.MedianSmallUnit, in.Currency)
+		switch {
+		case ratio < 0.3:
+			add("price_below_median", 50, "price is %.0f%% below the median of %s of %d similar ads", (1-ratio)*100, median, in.SimilarAds)
+		case ratio < 0.5:
+			add("price_below_median", 35, "price is %.0f%% below the median of %s of %d similar ads", (1-ratio)*100, median, in.SimilarAds)
+		}
+	}
+
+	text := in.Name + "\n" + in.Description
+	normalized := " " + repost.Normalize(text) + " "
+	if phrase, ok := containsPhrase(normalized, courierPhrases); ok {
+		add("courier_only", 20, "only ships by courier (%q)", phrase)
+	}
+	if phrase, ok := containsPhrase(normalized, paymentLinkPhrases); ok {
+		add("payment_link", 30, "mentions a payment link (%q)", phrase)
+	} else if link := linkPattern.FindString(text); link != "" {
+		add("payment_link", 30, "contains a link (%s)", link)
+	}
+	if whatsappPattern.MatchString(text) {
+		if phone := phonePattern.FindString(text); phone != "" {
+			add("whatsapp", 25, "asks to be contacted on WhatsApp at %s", phone)
+		} else {
+			add("whatsapp", 20, "asks to be contacted on WhatsApp")
+		}
+	}
+	if phrase, ok := containsPhrase(normalized, abroadPhrases); ok {
+		add("seller_abroad", 20, "seller claims to be abroad (%q)", phrase)
+	}
+
+	if !in.SellerSince.IsZero() && !in.Now.IsZero() && in.Now.Sub(in.SellerSince) < newSellerAge {
+		add("new_seller", 15, "seller account was created on %s", in.SellerSince.Format(time.DateOnly))
+	}
+
+	if in.ImageReuse >= minImageReuse {
+		add("reused_images", 30, "images also show up in %d ads of other sellers", in.ImageReuse)
+	}
+
+	a := Assessment{Reasons: reasons}
+	for _, r := range reasons {
+		a.Score += r.Points
+	}
+	a.Score = min(a.Score, 100)
+	return a
+}
+
+// containsPhrase looks for whole words, text is expected to be normalized
+// and padded with spaces.
+func containsPhrase(text string, phrases []string) (string, bool) {
+	for _, p := range phrases {
+		if strings.Contains(text, " "+p+" ") {
+			return p, true
+		}
+	}
+	return "", false
+}
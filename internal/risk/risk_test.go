@@ -0,0 +1,90 @@
+package risk
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func codes(a Assessment) []string {
+	var out []string
+	for _, r := range a.Reasons {
+		out = append(out, r.Code)
+	}
+	return out
+}
+
+func TestAssess(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		in    Input
+		codes []string
+		score int
+	}{
+		{
+			name: "ordinary ad",
+			in: Input{
+				Name:            "Bicicleta copii 16 inch",
+				Description:     "Stare buna, predare personala in Cluj. Sunati la 0740 123 456.",
+				PriceSmallUnit:  25000,
+				MedianSmallUnit: 30000,
+				SimilarAds:      12,
+				SellerSince:     now.AddDate(-3, 0, 0),
+				ImageReuse:      1,
+				Now:             now,
+			},
+		},
+		{
+			name: "too cheap, courier and whatsapp",
+			in: Input{
+				Name:            "iPhone 15 Pro sigilat",
+				Description:     "Livrare DOAR prin curier, scrieți-mi pe WhatsApp: +40 745-123-456",
+				PriceSmallUnit:  100000,
+				MedianSmallUnit: 450000,
+				Currency:        "RON",
+				SimilarAds:      8,
+				Now:             now,
+			},
+			codes: []string{"price_below_median", "courier_only", "whatsapp"},
+			score: 95,
+		},
+		{
+			name: "median from too few ads",
+			in:   Input{PriceSmallUnit: 100, MedianSmallUnit: 100000, SimilarAds: 2},
+		},
+		{
+			name: "payment link, new seller, stock photos",
+			in: Input{
+				Description: "Plata prin link: https://olx-livrare.example/pay/123",
+				SellerSince: now.AddDate(0, 0, -3),
+				ImageReuse:  5,
+				Now:         now,
+			},
+			codes: []string{"payment_link", "new_seller", "reused_images"},
+			score: 75,
+		},
+		{
+			name: "everything is capped",
+			in: Input{
+				Description:     "Link de plata pe WhatsApp, doar curier, sunt plecat din tara",
+				PriceSmallUnit:  100,
+				MedianSmallUnit: 100000,
+				SimilarAds:      10,
+				ImageReuse:      10,
+			},
+			codes: []string{"price_below_median", "courier_only", "payment_link", "whatsapp", "seller_abroad", "reused_images"},
+			score: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Assess(tt.in)
+			if !slices.Equal(codes(a), tt.codes) || a.Score != tt.score {
+				t.Errorf("got %v with score %d, want %v with score %d", a.Reasons, a.Score, tt.codes, tt.score)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Package tracing sets up OpenTelemetry tracing. The instrumented packages
+// only use the global tracer provider, so nothing is recorded until Setup
+// installs one.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+const serviceName = "olx-tracker"
+
+// Exporter names accepted by Setup.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// NewExporter creates the span exporter with the given name. The stdout
+// exporter writes to w. It returns nil for ExporterNone.
+func NewExporter(ctx context.Context, name string, w io.Writer) (sdktrace.SpanExporter, error) {
+	switch name {
+	case ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(w))
+	case ExporterOTLP:
+		return otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", name)
+	}
+}
+
+// Setup installs a global tracer provider sending spans to exporter, and the
+// W3C trace context propagator. The returned function flushes the remaining
+// spans and should be called before exiting. A nil exporter disables
+// tracing.
+func Setup(exporter sdktrace.SpanExporter) func(context.Context) error {
+	if exporter == nil {
+		return func(context.Context) error { return nil }
+	}
+
+	res := resource.NewSchemaless(semconv.ServiceName(serviceName))
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return tp.Shutdown
+}
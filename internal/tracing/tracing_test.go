@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNewExporter(t *testing.T) {
+	ctx := context.Background()
+
+	exporter, err := NewExporter(ctx, ExporterNone, nil)
+	if err != nil || exporter != nil {
+		t.Errorf("got %v, %v for none, want no exporter", exporter, err)
+	}
+
+	exporter, err = NewExporter(ctx, ExporterStdout, &bytes.Buffer{})
+	if err != nil || exporter == nil {
+		t.Errorf("got %v, %v for stdout, want an exporter", exporter, err)
+	}
+
+	if _, err := NewExporter(ctx, "jaeger", nil); err == nil {
+		t.Error("expected an error for an unknown exporter")
+	}
+}
+
+func TestEnd(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+
+	_, span := tracer.Start(context.Background(), "ok")
+	var err error
+	End(span, &err)
+
+	_, span = tracer.Start(context.Background(), "failed")
+	err = errors.New("boom")
+	End(span, &err)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if spans[0].Status.Code != codes.Unset {
+		t.Errorf("got status %v for the successful span", spans[0].Status.Code)
+	}
+	if spans[1].Status.Code != codes.Error || len(spans[1].Events) != 1 {
+		t.Errorf("failed span wasn't marked as failed: %+v", spans[1].Status)
+	}
+}
@@ -0,0 +1,25 @@
+package tracker
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+
+	"github.com/Ozoniuss/olx-tracker/internal/digest"
+	"github.com/Ozoniuss/olx-tracker/internal/tracing"
+)
+
+// SendDigestsWith makes the tracker send the due digests of the users who
+// opted in to them at the end of every poll cycle, so they include its
+// changes. It must be called before polling starts.
+func (t *Tracker) SendDigestsWith(mailer digest.Mailer) {
+	t.mailer = mailer
+}
+
+func (t *Tracker) sendDigests(ctx context.Context) (err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "send digests")
+	defer tracing.End(span, &err)
+
+	return digest.SendDue(ctx, t.db, t.mailer, time.Now())
+}
@@ -0,0 +1,217 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/suite"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/fakeolx"
+	"github.com/Ozoniuss/olx-tracker/internal/lifecycle"
+)
+
+// EndToEndTestSuite polls ads served by the fake OLX server into a real
+// database.
+type EndToEndTestSuite struct {
+	suite.Suite
+	DB     *sql.DB
+	fake   *fakeolx.Server
+	server *httptest.Server
+}
+
+func TestEndToEndTestSuite(t *testing.T) {
+	suite.Run(t, new(EndToEndTestSuite))
+}
+
+func (s *EndToEndTestSuite) SetupSuite() {
+	if os.Getenv("RUN_INTEGRATION_TESTS") != "true" {
+		s.T().Skip("Skipping integration tests. Set RUN_INTEGRATION_TESTS=true to run them.")
+	}
+
+	db, err := sql.Open("postgres", testDatabaseURL())
+	s.Require().NoError(err)
+	s.Require().NoError(db.Ping())
+	s.DB = db
+}
+
+func (s *EndToEndTestSuite) SetupTest() {
+	s.fake = fakeolx.New()
+	s.server = httptest.NewServer(s.fake)
+}
+
+func (s *EndToEndTestSuite) AfterTest(suiteName, testName string) {
+	s.server.Close()
+
+	for _, table := range []string{"sessions", "product_versions", "images", "products", "users"} {
+		_, err := s.DB.Exec("DELETE FROM " + table)
+		s.Require().NoError(err)
+	}
+}
+
+func (s *EndToEndTestSuite) TearDownSuite() {
+	if s.DB != nil {
+		s.DB.Close()
+	}
+}
+
+// track puts an ad on the fake server and tracks it for a new user.
+func (s *EndToEndTestSuite) track(ad fakeolx.Ad) (userID, productID uuid.UUID) {
+	ctx := context.Background()
+	s.fake.Put(ad)
+
+	userID, err := dbpkg.NewUser(ctx, s.DB, "e2e-"+ad.ID, "e2e-password", false)
+	s.Require().NoError(err)
+	err = dbpkg.TrackAddForUser(ctx, s.DB, userID, s.server.URL+fakeolx.AdPath(ad.ID))
+	s.Require().NoError(err)
+
+	tracked, err := dbpkg.ListTrackedProductsForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	s.Require().Len(tracked, 1)
+	return userID, tracked[0].ID
+}
+
+func (s *EndToEndTestSuite) TestPollStoresChanges() {
+	ctx := context.Background()
+	userID, productID := s.track(fakeolx.Ad{ID: "mouse", Name: "Mouse", Price: 449.5})
+	tr := New(s.DB, s.server.Client(), nil)
+
+	// the first poll stores a snapshot, polling again without changes doesn't
+	s.Require().NoError(tr.PollOnce(ctx))
+	s.Require().NoError(tr.PollOnce(ctx))
+
+	snapshots, err := dbpkg.ListAddSnapshotsForUser(ctx, s.DB, userID, productID)
+	s.Require().NoError(err)
+	s.Require().Len(snapshots, 1)
+	s.Equal(int64(44950), snapshots[0].PriceSmallUnit)
+
+	// failures store nothing
+	for _, status := range []fakeolx.Status{fakeolx.StatusThrottled, fakeolx.StatusSoft404} {
+		s.fake.Update("mouse", func(ad *fakeolx.Ad) { ad.Status = status })
+		s.Require().NoError(tr.PollOnce(ctx))
+	}
+
+	s.fake.Update("mouse", func(ad *fakeolx.Ad) {
+		ad.Status = fakeolx.StatusActive
+		ad.Price = 399
+		ad.Availability = "OutOfStock"
+	})
+	s.Require().NoError(tr.PollOnce(ctx))
+
+	snapshots, err = dbpkg.ListAddSnapshotsForUser(ctx, s.DB, userID, productID)
+	s.Require().NoError(err)
+	s.Require().Len(snapshots, 2)
+	s.Equal(2, snapshots[0].Version)
+	s.Equal(int64(39900), snapshots[0].PriceSmallUnit)
+	s.Equal("https://schema.org/OutOfStock", snapshots[0].Availability)
+
+	ad, _ := s.fake.Get("mouse")
+	s.Equal(5, ad.Hits)
+}
+
+func (s *EndToEndTestSuite) TestPollDeactivatesGoneAds() {
+	ctx := context.Background()
+	s.track(fakeolx.Ad{ID: "bike", Name: "Bike", Price: 250})
+	tr := New(s.DB, s.server.Client(), nil)
+
+	s.Require().NoError(tr.PollOnce(ctx))
+	s.fake.Update("bike", func(ad *fakeolx.Ad) { ad.Status = fakeolx.StatusGone })
+	s.Require().NoError(tr.PollOnce(ctx))
+
+	counts, err := dbpkg.CountTrackedProductsByStatus(ctx, s.DB)
+	s.Require().NoError(err)
+	s.Equal(map[string]int{"active": 0, "deactivated": 1}, counts)
+
+	// deactivated ads aren't polled anymore
+	s.Require().NoError(tr.PollOnce(ctx))
+	ad, _ := s.fake.Get("bike")
+	s.Equal(2, ad.Hits)
+}
+
+func (s *EndToEndTestSuite) TestPollRecordsLifecycle() {
+	ctx := context.Background()
+	userID, productID := s.track(fakeolx.Ad{ID: "desk", Name: "Desk", Price: 300})
+	tr := New(s.DB, s.server.Client(), nil)
+
+	s.Require().NoError(tr.PollOnce(ctx))
+	s.fake.Update("desk", func(ad *fakeolx.Ad) { ad.Price = 250 })
+	s.Require().NoError(tr.PollOnce(ctx))
+	s.fake.Update("desk", func(ad *fakeolx.Ad) { ad.Status = fakeolx.StatusGone })
+	s.Require().NoError(tr.PollOnce(ctx))
+
+	events, err := dbpkg.ListProductEventsForUser(ctx, s.DB, userID, productID)
+	s.Require().NoError(err)
+	var kinds []dbpkg.EventKind
+	for _, e := range events {
+		kinds = append(kinds, e.Kind)
+	}
+	s.Equal([]dbpkg.EventKind{dbpkg.EventFirstSeen, dbpkg.EventPriceChange, dbpkg.EventLastSeen, dbpkg.EventDeactivated}, kinds)
+
+	summary, ok := lifecycle.Summarize(events, time.Now())
+	s.Require().True(ok)
+	s.True(summary.Sold)
+	s.Equal(1, summary.PriceCuts)
+	s.Equal(int64(30000), summary.FirstPriceSmallUnit)
+	s.Equal(int64(25000), summary.FinalPriceSmallUnit)
+}
+
+func (s *EndToEndTestSuite) TestPollLinksReposts() {
+	ctx := context.Background()
+	ad := fakeolx.Ad{
+		ID:          "bike",
+		Name:        "Bicicleta copii 16 inch",
+		Description: "Bicicleta in stare buna, roti ajutatoare incluse. Predare in Sectorul 4.",
+		Price:       250,
+	}
+	userID, productID := s.track(ad)
+	tr := New(s.DB, s.server.Client(), nil)
+
+	s.Require().NoError(tr.PollOnce(ctx))
+	s.fake.Update("bike", func(ad *fakeolx.Ad) { ad.Status = fakeolx.StatusGone })
+	s.Require().NoError(tr.PollOnce(ctx))
+
+	// the seller deletes the ad and posts it again, cheaper
+	repost := ad
+	repost.ID, repost.Price = "bike-repost", 220
+	s.fake.Put(repost)
+	err := dbpkg.TrackAddForUser(ctx, s.DB, userID, s.server.URL+fakeolx.AdPath(repost.ID))
+	s.Require().NoError(err)
+	s.Require().NoError(tr.PollOnce(ctx))
+
+	tracked, err := dbpkg.ListTrackedProductsForUser(ctx, s.DB, userID)
+	s.Require().NoError(err)
+	chain, err := dbpkg.ListRepostChainForUser(ctx, s.DB, userID, tracked[0].ID)
+	s.Require().NoError(err)
+	s.Require().Len(chain, 1)
+	s.Equal(productID, chain[0].ID)
+}
+
+func testDatabaseURL() string {
+	if databaseURL := os.Getenv("TEST_DATABASE_URL"); databaseURL != "" {
+		return databaseURL
+	}
+
+	return fmt.Sprintf(
+		"postgres://%s:%s@%s:%s/%s?sslmode=disable&search_path=%s",
+		getenvOrDefault("OLXTRACKER_POSTGRES_USER", "olxtracker"),
+		getenvOrDefault("OLXTRACKER_POSTGRES_PASSWORD", "olxtracker"),
+		getenvOrDefault("OLXTRACKER_POSTGRES_HOST", "127.0.0.1"),
+		getenvOrDefault("OLXTRACKER_POSTGRES_PORT", "5433"),
+		getenvOrDefault("OLXTRACKER_POSTGRES_DATABASE", "olxtracker"),
+		getenvOrDefault("OLXTRACKER_POSTGRES_SCHEMA", "olxtracker"),
+	)
+}
+
+func getenvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
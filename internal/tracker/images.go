@@ -0,0 +1,150 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Ozoniuss/olx-tracker/internal/blob"
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/tracing"
+)
+
+// maxImageSize caps the size of an archived image. The images of an ad are
+// resized by OLX and are nowhere near as big.
+const maxImageSize = 20 << 20
+
+// ArchiveImagesTo makes the tracker download the images of every new
+// snapshot into store, since they disappear from the OLX CDN once the ad is
+// removed. It must be called before polling starts.
+func (t *Tracker) ArchiveImagesTo(store blob.Store) {
+	t.images = store
+}
+
+// archiveImages downloads the images of a snapshot into the blob store and
+// links them to it. Images archived for an older snapshot of the product are
+// reused, and images that fail to download are left out. It returns every
+// image archived for the product by its source url.
+func (t *Tracker) archiveImages(ctx context.Context, productID uuid.UUID, version int, urls []string) (_ map[string]dbpkg.Image, err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "archive images",
+		trace.WithAttributes(attribute.Int("images.count", len(urls))),
+	)
+	defer tracing.End(span, &err)
+
+	archived, err := dbpkg.ListArchivedImages(ctx, t.db, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]dbpkg.SnapshotImage, 0, len(urls))
+	for i, url := range urls {
+		img, ok := archived[url]
+		if !ok {
+			img, err = t.downloadImage(ctx, url)
+			if err != nil {
+				slog.WarnContext(ctx, "failed to archive image", "image_url", url, "error", err)
+				continue
+			}
+			archived[url] = img
+		}
+		images = append(images, dbpkg.SnapshotImage{Image: img, Position: i, SourceURL: url})
+	}
+	span.SetAttributes(attribute.Int("images.archived", len(images)))
+
+	return archived, dbpkg.StoreSnapshotImages(ctx, t.db, productID, version, images)
+}
+
+// imageData returns the content of an image, read from the blob store if it
+// is in archived and downloaded otherwise.
+func (t *Tracker) imageData(ctx context.Context, archived map[string]dbpkg.Image, url string) ([]byte, error) {
+	if img, ok := archived[url]; ok {
+		content, err := t.images.Open(ctx, img.Hash)
+		if err == nil {
+			defer content.Close()
+			return io.ReadAll(content)
+		}
+		slog.DebugContext(ctx, "archived image missing", "image_url", url, "error", err)
+	}
+	data, _, err := t.fetchImage(ctx, url)
+	return data, err
+}
+
+func (t *Tracker) downloadImage(ctx context.Context, url string) (dbpkg.Image, error) {
+	data, contentType, err := t.fetchImage(ctx, url)
+	if err != nil {
+		return dbpkg.Image{}, err
+	}
+
+	key, size, err := t.images.Put(ctx, bytes.NewReader(data))
+	if err != nil {
+		return dbpkg.Image{}, err
+	}
+	return dbpkg.Image{Hash: key, ContentType: contentType, Size: size}, nil
+}
+
+// fetchImage downloads an image and returns it with its content type.
+func (t *Tracker) fetchImage(ctx context.Context, url string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to download image: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download image: %w", err)
+	}
+	if len(data) > maxImageSize {
+		return nil, "", fmt.Errorf("image is larger than %d bytes", maxImageSize)
+	}
+
+	contentType, err := imageContentType(data, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, "", err
+	}
+	return data, contentType, nil
+}
+
+// imageTypes are the raster formats that are archived. Anything else, SVG
+// in particular, could run scripts once it is served from our origin.
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+	"image/gif":  true,
+	"image/avif": true,
+}
+
+// imageContentType sniffs the type of the image, and trusts the header only
+// for the formats that can't be sniffed, like AVIF.
+func imageContentType(data []byte, header string) (string, error) {
+	sniffed := http.DetectContentType(data)
+	if imageTypes[sniffed] {
+		return sniffed, nil
+	}
+	if strings.HasPrefix(sniffed, "image/") {
+		return "", fmt.Errorf("unsupported image type %s", sniffed)
+	}
+	if mediaType, _, err := mime.ParseMediaType(header); err == nil && imageTypes[mediaType] {
+		return mediaType, nil
+	}
+	return "", fmt.Errorf("not a supported image: %s", header)
+}
@@ -0,0 +1,129 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Ozoniuss/olx-tracker/internal/blob"
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+func TestDownloadImage(t *testing.T) {
+	// the signature is enough for the type to be sniffed
+	png := []byte("\x89PNG\r\n\x1a\n rest of the image")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.png":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(png)
+		case "/image.avif":
+			w.Header().Set("Content-Type", "image/avif")
+			w.Write([]byte("not sniffable"))
+		case "/image.svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`))
+		case "/image.bmp":
+			w.Header().Set("Content-Type", "image/bmp")
+			w.Write([]byte("BM rest of the image"))
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	store, err := blob.NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := New(nil, server.Client(), nil)
+	tr.ArchiveImagesTo(store)
+	ctx := context.Background()
+
+	img, err := tr.downloadImage(ctx, server.URL+"/image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.ContentType != "image/png" || img.Size != int64(len(png)) || !blob.ValidKey(img.Hash) {
+		t.Errorf("unexpected image %+v", img)
+	}
+	if _, err := store.Open(ctx, img.Hash); err != nil {
+		t.Errorf("image not in the store: %v", err)
+	}
+
+	img, err = tr.downloadImage(ctx, server.URL+"/image.avif")
+	if err != nil || img.ContentType != "image/avif" {
+		t.Errorf("got %+v, %v for an image that can't be sniffed", img, err)
+	}
+
+	for _, path := range []string{"/image.svg", "/image.bmp", "/page.html", "/missing.jpg"} {
+		if _, err := tr.downloadImage(ctx, server.URL+path); err == nil {
+			t.Errorf("%s should fail", path)
+		}
+	}
+}
+
+func TestFingerprintReadsArchivedImages(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	store, err := blob.NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := New(nil, server.Client(), nil)
+	tr.ArchiveImagesTo(store)
+	ctx := context.Background()
+
+	key, _, err := store.Put(ctx, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := server.URL + "/image.png"
+	p := &productpkg.Product{Name: "Mouse", Image: []string{url}}
+
+	archived := tr.fingerprint(ctx, p, map[string]dbpkg.Image{url: {Hash: key}}, nil)
+	if len(archived.ImageHashes) != 1 || downloads.Load() != 0 {
+		t.Fatalf("expected the archived image to be hashed without a download, got %d hashes and %d downloads",
+			len(archived.ImageHashes), downloads.Load())
+	}
+
+	downloaded := tr.fingerprint(ctx, p, nil, nil)
+	if len(downloaded.ImageHashes) != 1 || downloads.Load() != 1 {
+		t.Fatalf("expected the image to be downloaded, got %d hashes and %d downloads",
+			len(downloaded.ImageHashes), downloads.Load())
+	}
+	if downloaded.ImageHashes[0] != archived.ImageHashes[0] {
+		t.Error("the same image should hash the same")
+	}
+
+	reused := tr.fingerprint(ctx, p, nil, map[string]uint64{url: 42})
+	if !slices.Equal(reused.ImageHashes, []uint64{42}) || !slices.Equal(reused.ImageURLs, []string{url}) || downloads.Load() != 1 {
+		t.Fatalf("expected the previous hash to be reused without a download, got %v for %v and %d downloads",
+			reused.ImageHashes, reused.ImageURLs, downloads.Load())
+	}
+}
@@ -0,0 +1,19 @@
+package tracker
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/tracing"
+)
+
+// refreshMarketStats materializes the market stats from the snapshots the
+// cycle stored, see db.RefreshMarketStats.
+func (t *Tracker) refreshMarketStats(ctx context.Context) (err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "refresh market stats")
+	defer tracing.End(span, &err)
+
+	return dbpkg.RefreshMarketStats(ctx, t.db)
+}
@@ -0,0 +1,43 @@
+package tracker
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/exchange"
+	"github.com/Ozoniuss/olx-tracker/internal/tracing"
+)
+
+// ImportExchangeRatesFrom makes the tracker import the ECB or BNR reference
+// rates published at url at the start of every poll cycle, so prices are
+// converted at the rates of the day. It must be called before polling
+// starts.
+func (t *Tracker) ImportExchangeRatesFrom(url string) {
+	t.ratesURL = url
+}
+
+// importExchangeRates fetches and stores the latest reference rates. Rates
+// that were already imported are overwritten, they don't change once
+// published.
+func (t *Tracker) importExchangeRates(ctx context.Context) (err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "import exchange rates")
+	defer tracing.End(span, &err)
+	span.SetAttributes(semconv.URLFull(t.ratesURL))
+
+	source, rates, err := exchange.Fetch(ctx, t.client, t.ratesURL)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.Int("exchange.rates", len(rates)))
+
+	if err := dbpkg.StoreExchangeRates(ctx, t.db, source, rates); err != nil {
+		return err
+	}
+	slog.DebugContext(ctx, "exchange rates imported", "source", source, "rates", len(rates))
+	return nil
+}
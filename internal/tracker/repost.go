@@ -0,0 +1,161 @@
+package tracker
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+	"github.com/Ozoniuss/olx-tracker/internal/repost"
+	"github.com/Ozoniuss/olx-tracker/internal/tracing"
+)
+
+// maxFingerprintImages is how many of the images of an ad are hashed. The
+// first few are enough to recognize a repost, which usually keeps them.
+const maxFingerprintImages = 4
+
+// detectRepost stores the fingerprint of a new snapshot. On the first
+// snapshot of a product it also looks for a deactivated product of the same
+// user that this one is a repost of, and links them so the price history
+// continues across the repost. archived are the archived images of the
+// product, nil if images aren't archived.
+func (t *Tracker) detectRepost(ctx context.Context, productID uuid.UUID, version int, p *productpkg.Product, archived map[string]dbpkg.Image) (err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "detect repost")
+	defer tracing.End(span, &err)
+
+	// without an archive the images would be downloaded again for every
+	// snapshot, even though they rarely change
+	var previous map[string]uint64
+	if t.images == nil && version > 1 {
+		previous, err = t.previousImageHashes(ctx, productID)
+		if err != nil {
+			return err
+		}
+	}
+
+	fp := t.fingerprint(ctx, p, archived, previous)
+	err = dbpkg.StoreFingerprint(ctx, t.db, dbpkg.ProductFingerprint{
+		ProductID:   productID,
+		ImageHashes: toSigned(fp.ImageHashes),
+		ImageURLs:   fp.ImageURLs,
+		Shingles:    toSigned(fp.Shingles),
+		Seller:      fp.Seller,
+		Location:    fp.Location,
+	})
+	if err != nil || version != 1 {
+		return err
+	}
+
+	stored, err := dbpkg.ListRepostCandidates(ctx, t.db, productID)
+	if err != nil {
+		return err
+	}
+	candidates := make([]repost.Fingerprint, len(stored))
+	for i, c := range stored {
+		candidates[i] = repost.Fingerprint{
+			ImageHashes: toUnsigned(c.ImageHashes),
+			Shingles:    toUnsigned(c.Shingles),
+			Seller:      c.Seller,
+			Location:    c.Location,
+		}
+	}
+	span.SetAttributes(attribute.Int("repost.candidates", len(candidates)))
+
+	best, score := repost.BestMatch(fp, candidates)
+	if best < 0 {
+		return nil
+	}
+	previousID := stored[best].ProductID
+
+	err = dbpkg.LinkRepost(ctx, t.db, productID, previousID)
+	if errors.Is(err, dbpkg.ErrAlreadyExists) {
+		// another product was linked to it first
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "repost detected", "reposted_from", previousID, "score", score)
+	span.SetAttributes(attribute.String("repost.reposted_from", previousID.String()))
+	return nil
+}
+
+// previousImageHashes returns the image hashes of the stored fingerprint of a
+// product by the url of their image.
+func (t *Tracker) previousImageHashes(ctx context.Context, productID uuid.UUID) (map[string]uint64, error) {
+	stored, err := dbpkg.GetFingerprint(ctx, t.db, productID)
+	if errors.Is(err, dbpkg.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[string]uint64, len(stored.ImageURLs))
+	for i, url := range stored.ImageURLs {
+		if i < len(stored.ImageHashes) {
+			hashes[url] = uint64(stored.ImageHashes[i])
+		}
+	}
+	return hashes, nil
+}
+
+// fingerprint fingerprints a product. The hashes in previous are reused for
+// images with the same url, archived images are read from the blob store
+// instead of being downloaded again, and images that fail to download are
+// left out.
+func (t *Tracker) fingerprint(ctx context.Context, p *productpkg.Product, archived map[string]dbpkg.Image, previous map[string]uint64) repost.Fingerprint {
+	fp := repost.Fingerprint{
+		Shingles: repost.Shingles(p.Name + " " + p.Description),
+		Location: p.Offers.AreaServed.Name,
+	}
+	if seller := p.Offers.Seller; seller != nil {
+		fp.Seller = cmp.Or(seller.URL, seller.Name)
+	}
+
+	for _, url := range p.Image[:min(len(p.Image), maxFingerprintImages)] {
+		if hash, ok := previous[url]; ok {
+			fp.ImageHashes = append(fp.ImageHashes, hash)
+			fp.ImageURLs = append(fp.ImageURLs, url)
+			continue
+		}
+
+		data, err := t.imageData(ctx, archived, url)
+		if err == nil {
+			var hash uint64
+			hash, err = repost.ImageHash(data)
+			if err == nil {
+				fp.ImageHashes = append(fp.ImageHashes, hash)
+				fp.ImageURLs = append(fp.ImageURLs, url)
+				continue
+			}
+		}
+		slog.DebugContext(ctx, "failed to hash image", "image_url", url, "error", err)
+	}
+	return fp
+}
+
+// toSigned and toUnsigned convert hashes to the signed integers Postgres
+// stores, keeping every bit.
+func toSigned(hashes []uint64) []int64 {
+	out := make([]int64, len(hashes))
+	for i, h := range hashes {
+		out[i] = int64(h)
+	}
+	return out
+}
+
+func toUnsigned(hashes []int64) []uint64 {
+	out := make([]uint64, len(hashes))
+	for i, h := range hashes {
+		out[i] = uint64(h)
+	}
+	return out
+}
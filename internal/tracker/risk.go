@@ -0,0 +1,68 @@
+package tracker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+	"github.com/Ozoniuss/olx-tracker/internal/risk"
+	"github.com/Ozoniuss/olx-tracker/internal/tracing"
+)
+
+// assessRisk scores how likely a new snapshot is a scam and stores the
+// score with it. It runs after the fingerprint is stored, which the image
+// reuse is computed from.
+func (t *Tracker) assessRisk(ctx context.Context, productID uuid.UUID, version int, p *productpkg.Product) (err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "assess risk")
+	defer tracing.End(span, &err)
+
+	in := risk.Input{
+		Name:        p.Name,
+		Description: p.Description,
+		Currency:    p.Offers.PriceCurrency,
+		Now:         time.Now(),
+	}
+
+	if p.Offers.PriceKind == productpkg.PriceFixed {
+		in.PriceSmallUnit = p.Offers.PriceSmallUnit
+		if p.Category != "" {
+			in.MedianSmallUnit, in.SimilarAds, err = dbpkg.GetCategoryPriceMedian(ctx, t.db, productID, p.Category, p.Offers.PriceCurrency)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if seller := p.Offers.Seller; seller != nil && seller.FoundingDate != "" {
+		// a date that doesn't parse is the same as no date
+		if since, err := time.Parse(time.DateOnly, seller.FoundingDate[:min(len(seller.FoundingDate), len(time.DateOnly))]); err == nil {
+			in.SellerSince = since
+		}
+	}
+
+	in.ImageReuse, err = dbpkg.CountImageReuse(ctx, t.db, productID)
+	if err != nil {
+		return err
+	}
+
+	a := risk.Assess(in)
+	reasons := make(dbpkg.RiskReasons, len(a.Reasons))
+	for i, r := range a.Reasons {
+		reasons[i] = dbpkg.RiskReason{Code: r.Code, Detail: r.Detail, Points: r.Points}
+	}
+	span.SetAttributes(attribute.Int("risk.score", a.Score))
+
+	if err := dbpkg.SetSnapshotRisk(ctx, t.db, productID, version, a.Score, reasons); err != nil {
+		return err
+	}
+	if a.Score >= risk.WarnScore {
+		slog.InfoContext(ctx, "risky ad", "version", version, "risk_score", a.Score)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Ozoniuss/olx-tracker/internal/blob"
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/digest"
+	"github.com/Ozoniuss/olx-tracker/internal/exchange"
+	"github.com/Ozoniuss/olx-tracker/internal/logging"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+	"github.com/Ozoniuss/olx-tracker/internal/tracing"
+)
+
+const tracerName = "github.com/Ozoniuss/olx-tracker/internal/tracker"
+
+// Observer is told about the outcome of every poll, so the caller can
+// collect metrics without this package depending on a metrics library.
+type Observer interface {
+	// ObserveSnapshot is called for every successful fetch. stored is false
+	// when nothing changed since the latest snapshot and none was stored.
+	ObserveSnapshot(stored bool)
+	// ObservePollCycle is called after PollOnce went through all products.
+	ObservePollCycle(duration time.Duration)
+}
+
+type noopObserver struct{}
+
+func (noopObserver) ObserveSnapshot(bool)           {}
+func (noopObserver) ObservePollCycle(time.Duration) {}
+
+// Tracker periodically fetches every tracked ad and stores a new snapshot
+// for it whenever it changed.
+type Tracker struct {
+	db       *sql.DB
+	client   *http.Client
+	observer Observer
+	// images is where the images of new snapshots are archived, nil if they
+	// aren't
+	images blob.Store
+	// ratesURL is where exchange rates are imported from, empty if they
+	// aren't
+	ratesURL string
+	// mailer sends the digests, nil if they aren't sent
+	mailer digest.Mailer
+
+	// unix nanoseconds of the last completed poll cycle, or of the creation
+	// of the tracker before the first cycle finished
+	lastCycle atomic.Int64
+}
+
+// New creates a tracker. observer may be nil.
+func New(db *sql.DB, client *http.Client, observer Observer) *Tracker {
+	if observer == nil {
+		observer = noopObserver{}
+	}
+	t := &Tracker{
+		db:       db,
+		client:   client,
+		observer: observer,
+	}
+	t.lastCycle.Store(time.Now().UnixNano())
+	return t
+}
+
+// LastPollCycle returns when the last poll cycle completed, or when the
+// tracker was created if none completed yet.
+func (t *Tracker) LastPollCycle() time.Time {
+	return time.Unix(0, t.lastCycle.Load())
+}
+
+// Run polls all tracked products immediately and then once every interval,
+// until the context is cancelled.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.PollOnce(ctx); err != nil {
+			slog.ErrorContext(ctx, "poll failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PollOnce fetches every tracked product once, except for the products of
+// users with a longer poll interval that aren't due yet. A failure for a
+// single product doesn't stop the others from being polled. Every cycle and
+// every product within it gets its own correlation id in the logs.
+func (t *Tracker) PollOnce(ctx context.Context) (err error) {
+	start := time.Now()
+	ctx = logging.With(ctx, slog.String("cycle_id", logging.NewCorrelationID()))
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "PollOnce")
+	defer tracing.End(span, &err)
+
+	// without rates, prices are only compared in their own currency
+	if t.ratesURL != "" {
+		if err := t.importExchangeRates(ctx); err != nil {
+			slog.WarnContext(ctx, "failed to import exchange rates", "error", err)
+		}
+	}
+	rates, err := exchange.Load(ctx, t.db)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to load exchange rates", "error", err)
+	}
+
+	tracked, err := dbpkg.ListTrackedProductsDueForPoll(ctx, t.db)
+	if err != nil {
+		return fmt.Errorf("failed to list tracked products: %w", err)
+	}
+
+	for _, tp := range tracked {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		pctx := logging.With(ctx,
+			slog.String("job_id", logging.NewCorrelationID()),
+			slog.String("product_id", tp.ID.String()),
+			slog.String("url", tp.URL),
+		)
+		if err := t.poll(pctx, tp, rates); err != nil {
+			slog.ErrorContext(pctx, "failed to poll product", "error", err)
+		}
+	}
+
+	// stale stats only make the price ratings less accurate
+	if err := t.refreshMarketStats(ctx); err != nil {
+		slog.WarnContext(ctx, "failed to refresh market stats", "error", err)
+	}
+
+	if t.mailer != nil {
+		if err := t.sendDigests(ctx); err != nil {
+			slog.WarnContext(ctx, "failed to send digests", "error", err)
+		}
+	}
+
+	now := time.Now()
+	t.lastCycle.Store(now.UnixNano())
+	slog.InfoContext(ctx, "poll cycle finished",
+		"products", len(tracked),
+		"duration", now.Sub(start),
+	)
+	t.observer.ObservePollCycle(now.Sub(start))
+	return nil
+}
+
+// poll fetches a single product. Every poll job is traced on its own, linked
+// to the trace of the cycle, so a cycle over many products doesn't end up as
+// one huge trace. rates may be nil.
+func (t *Tracker) poll(ctx context.Context, tp dbpkg.ProductWithUrl, rates *exchange.Rates) (err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "poll",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithAttributes(
+			attribute.String("product.id", tp.ID.String()),
+			semconv.URLFull(tp.URL),
+		),
+	)
+	defer tracing.End(span, &err)
+
+	product, err := productpkg.FetchProduct(ctx, t.client, tp.URL)
+	if err != nil {
+		if errors.Is(err, productpkg.ErrAdDeactivated) {
+			// nothing to snapshot, the last stored version stays the latest
+			slog.InfoContext(ctx, "ad deactivated")
+			return dbpkg.MarkProductDeactivated(ctx, t.db, tp.ID)
+		}
+		return err
+	}
+
+	if tp.URL != product.URL {
+		return fmt.Errorf("fetched product URL (%s) does not match requested URL (%s)", product.URL, tp.URL)
+	}
+
+	if err := dbpkg.MarkProductChecked(ctx, t.db, tp.ID); err != nil {
+		return err
+	}
+
+	latest, err := dbpkg.GetLatestSnapshot(ctx, t.db, tp.ID)
+	if err != nil && !errors.Is(err, dbpkg.ErrNotFound) {
+		return err
+	}
+	if err == nil && !changed(latest, product) {
+		slog.DebugContext(ctx, "product unchanged", "version", latest.Version)
+		t.observer.ObserveSnapshot(false)
+		return nil
+	}
+
+	rawjson, err := json.Marshal(product)
+	if err != nil {
+		return fmt.Errorf("failed to marshal product: %w", err)
+	}
+
+	version, err := dbpkg.StoreNextAddSnapshot(ctx,
+		t.db,
+		tp.ID,
+		product.Name,
+		product.Description,
+		product.Offers.PriceSmallUnit,
+		highPrice(product.Offers),
+		string(product.Offers.PriceKind),
+		product.Offers.PriceCurrency,
+		product.Offers.Availability,
+		rawjson,
+	)
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "snapshot stored", "version", version)
+	t.observer.ObserveSnapshot(true)
+
+	// the snapshot is stored either way, missing images are only logged
+	var archived map[string]dbpkg.Image
+	if t.images != nil {
+		archived, err = t.archiveImages(ctx, tp.ID, version, product.Image)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to archive images", "version", version, "error", err)
+		}
+	}
+	if err := t.detectRepost(ctx, tp.ID, version, product, archived); err != nil {
+		slog.WarnContext(ctx, "failed to detect repost", "version", version, "error", err)
+	}
+	if err := t.assessRisk(ctx, tp.ID, version, product); err != nil {
+		slog.WarnContext(ctx, "failed to assess risk", "version", version, "error", err)
+	}
+	if err := t.matchWatchRules(ctx, tp.ID, version, product, rates); err != nil {
+		slog.WarnContext(ctx, "failed to match watch rules", "version", version, "error", err)
+	}
+	return nil
+}
+
+// changed reports whether the fetched product differs from the latest
+// snapshot in anything that is stored in its own column, or in its images,
+// which are archived per snapshot.
+func changed(latest dbpkg.ProductSnapshot, p *productpkg.Product) bool {
+	return latest.Name != p.Name ||
+		latest.Description != p.Description ||
+		latest.PriceKind != string(p.Offers.PriceKind) ||
+		latest.PriceSmallUnit != p.Offers.PriceSmallUnit ||
+		latest.HighPriceSmallUnit != highPrice(p.Offers) ||
+		latest.Currency != p.Offers.PriceCurrency ||
+		latest.Availability != p.Offers.Availability ||
+		!slices.Equal(snapshotImages(latest), p.Image)
+}
+
+// snapshotImages returns the image urls of a stored snapshot. A snapshot
+// that can't be read has none, so the product is stored again.
+func snapshotImages(s dbpkg.ProductSnapshot) []string {
+	var raw struct {
+		Image []string `json:"image"`
+	}
+	if err := json.Unmarshal(s.RawJSON, &raw); err != nil {
+		return nil
+	}
+	return raw.Image
+}
+
+// highPrice is the high end of the price range of an offer, if it has one.
+func highPrice(o productpkg.Offer) sql.NullInt64 {
+	if o.PriceKind != productpkg.PriceRange {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: o.HighPriceSmallUnit, Valid: true}
+}
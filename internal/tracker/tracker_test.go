@@ -0,0 +1,73 @@
+package tracker
+
+import (
+	"testing"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+func TestChanged(t *testing.T) {
+	latest := dbpkg.ProductSnapshot{
+		Name:           "Mouse",
+		Description:    "Like new",
+		PriceKind:      "fixed",
+		PriceSmallUnit: 44900,
+		Currency:       "RON",
+		Availability:   "https://schema.org/InStock",
+		RawJSON:        []byte(`{"name":"Mouse","image":["https://cdn.olx.ro/1.jpg"]}`),
+	}
+	product := func() *productpkg.Product {
+		return &productpkg.Product{
+			Name:        "Mouse",
+			Description: "Like new",
+			Image:       []string{"https://cdn.olx.ro/1.jpg"},
+			Offers: productpkg.Offer{
+				PriceCurrency:  "RON",
+				PriceKind:      productpkg.PriceFixed,
+				PriceSmallUnit: 44900,
+				Availability:   "https://schema.org/InStock",
+			},
+		}
+	}
+
+	if changed(latest, product()) {
+		t.Error("identical product should not be a change")
+	}
+
+	p := product()
+	p.Offers.PriceSmallUnit = 40000
+	if !changed(latest, p) {
+		t.Error("price drop should be a change")
+	}
+
+	p = product()
+	p.Offers.PriceKind, p.Offers.PriceSmallUnit = productpkg.PriceOnRequest, 0
+	if !changed(latest, p) {
+		t.Error("price removed should be a change")
+	}
+
+	p = product()
+	p.Offers.PriceKind, p.Offers.HighPriceSmallUnit = productpkg.PriceRange, 50000
+	if !changed(latest, p) {
+		t.Error("price turned into a range should be a change")
+	}
+
+	p = product()
+	p.Offers.Availability = "https://schema.org/OutOfStock"
+	if !changed(latest, p) {
+		t.Error("availability change should be a change")
+	}
+
+	p = product()
+	p.Description = "Like new, with box"
+	if !changed(latest, p) {
+		t.Error("description change should be a change")
+	}
+
+	p = product()
+	p.Image = append(p.Image, "https://cdn.olx.ro/2.jpg")
+	if !changed(latest, p) {
+		t.Error("new image should be a change")
+	}
+}
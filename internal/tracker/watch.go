@@ -0,0 +1,59 @@
+package tracker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/exchange"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+	"github.com/Ozoniuss/olx-tracker/internal/tracing"
+	"github.com/Ozoniuss/olx-tracker/internal/watch"
+)
+
+// matchWatchRules matches a new snapshot against the watch rules of every
+// user. Only new snapshots are matched, so a rule is evaluated once per
+// change of an ad, and an ad is only recorded the first time it matches a
+// rule of a user other than the one tracking it. Prices are converted to the
+// currency of a rule with rates, which may be nil.
+func (t *Tracker) matchWatchRules(ctx context.Context, productID uuid.UUID, version int, p *productpkg.Product, rates *exchange.Rates) (err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "match watch rules")
+	defer tracing.End(span, &err)
+
+	rules, err := dbpkg.ListAllWatchRules(ctx, t.db)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.Int("watch.rules", len(rules)))
+
+	now := time.Now()
+	for _, stored := range rules {
+		rule, err := watch.Compile(stored)
+		if err != nil {
+			// rules are validated when they are created
+			slog.WarnContext(ctx, "skipping invalid watch rule", "rule_id", stored.ID, "error", err)
+			continue
+		}
+		if !rule.Match(p, rates, now) {
+			continue
+		}
+
+		created, err := dbpkg.RecordWatchMatch(ctx, t.db, rule.ID, productID, version)
+		if err != nil {
+			return err
+		}
+		if created {
+			slog.InfoContext(ctx, "watch rule matched",
+				"rule_id", rule.ID,
+				"rule_user_id", rule.UserID,
+				"version", version,
+			)
+		}
+	}
+	return nil
+}
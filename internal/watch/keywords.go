@@ -0,0 +1,71 @@
+package watch
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Ozoniuss/olx-tracker/internal/repost"
+)
+
+// ErrUnterminatedQuote is returned for keywords with an odd number of
+// quotes.
+var ErrUnterminatedQuote = errors.New("unterminated quote")
+
+// term is a normalized word or phrase the text of an ad must contain, or
+// must not contain when negated.
+type term struct {
+	text    string
+	negated bool
+}
+
+// parseKeywords splits keywords into terms: words, phrases in double quotes,
+// and either of them prefixed by "-" to exclude them, e.g.
+// `superlight "g pro" -defect`. Terms without letters or digits are
+// dropped.
+func parseKeywords(keywords string) ([]term, error) {
+	var terms []term
+	rest := keywords
+	for {
+		rest = strings.TrimLeft(rest, " \t\r\n")
+		if rest == "" {
+			return terms, nil
+		}
+
+		var t term
+		if strings.HasPrefix(rest, "-") {
+			t.negated = true
+			rest = rest[1:]
+		}
+
+		var raw string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, ErrUnterminatedQuote
+			}
+			raw, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, " \t\r\n")
+			if end < 0 {
+				end = len(rest)
+			}
+			raw, rest = rest[:end], rest[end:]
+		}
+
+		t.text = repost.Normalize(raw)
+		if t.text != "" {
+			terms = append(terms, t)
+		}
+	}
+}
+
+// matchTerms tells whether a normalized text, padded with spaces, contains
+// every term that isn't negated as whole words and none of the negated ones.
+func matchTerms(text string, terms []term) bool {
+	for _, t := range terms {
+		if strings.Contains(text, " "+t.text+" ") == t.negated {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+// Package watch matches newly fetched ads against the saved searches of the
+// users, so they are notified about ads they don't track yet. A rule
+// matches an ad when every criterion it sets matches: keywords in the name
+// or description, a price range, a category, a location and the condition of
+// the item.
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/exchange"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+	"github.com/Ozoniuss/olx-tracker/internal/repost"
+)
+
+// Conditions are the item conditions a rule can ask for, as the names of the
+// schema.org OfferItemCondition values without the "Condition" suffix.
+var Conditions = []string{"new", "used", "refurbished", "damaged"}
+
+var (
+	ErrNoCriteria       = errors.New("a rule needs at least one criterion")
+	ErrInvalidPrice     = errors.New("the minimum price is above the maximum")
+	ErrMissingCurrency  = errors.New("a price range needs a currency")
+	ErrUnknownCondition = fmt.Errorf("the condition must be one of %s", strings.Join(Conditions, ", "))
+)
+
+// Rule is a watch rule ready to be matched.
+type Rule struct {
+	dbpkg.WatchRule
+
+	terms    []term
+	category string
+	location string
+}
+
+// Compile checks a stored rule and prepares it for matching.
+func Compile(r dbpkg.WatchRule) (*Rule, error) {
+	terms, err := parseKeywords(r.Keywords)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keywords: %w", err)
+	}
+
+	c := &Rule{
+		WatchRule: r,
+		terms:     terms,
+		category:  normalizeCategory(r.Category),
+		location:  repost.Normalize(r.Location),
+	}
+
+	if len(c.terms) == 0 && !r.MinPrice.Valid && !r.MaxPrice.Valid &&
+		c.category == "" && c.location == "" && r.Condition == "" {
+		return nil, ErrNoCriteria
+	}
+	if r.MinPrice.Valid && r.MaxPrice.Valid && r.MinPrice.Int64 > r.MaxPrice.Int64 {
+		return nil, ErrInvalidPrice
+	}
+	if (r.MinPrice.Valid || r.MaxPrice.Valid) && r.Currency == "" {
+		return nil, ErrMissingCurrency
+	}
+	if r.Condition != "" && !validCondition(r.Condition) {
+		return nil, ErrUnknownCondition
+	}
+	return c, nil
+}
+
+// Match tells whether an ad seen at a time matches the rule. Prices in
+// another currency than the bounds of the rule are converted with rates at
+// the rate of that day, rates may be nil.
+func (r *Rule) Match(p *productpkg.Product, rates *exchange.Rates, at time.Time) bool {
+	if len(r.terms) > 0 {
+		text := " " + repost.Normalize(p.Name+"\n"+p.Description) + " "
+		if !matchTerms(text, r.terms) {
+			return false
+		}
+	}
+	if (r.MinPrice.Valid || r.MaxPrice.Valid) && !r.matchPrice(p.Offers, rates, at) {
+		return false
+	}
+	if r.category != "" && !r.matchCategory(p) {
+		return false
+	}
+	if r.location != "" && repost.Normalize(p.Offers.AreaServed.Name) != r.location {
+		return false
+	}
+	if r.Condition != "" && !strings.EqualFold(conditionName(p.Offers.ItemCondition), r.Condition) {
+		return false
+	}
+	return true
+}
+
+// matchPrice checks the price of an ad against the bounds of the rule. A
+// range matches if it overlaps the bounds. Ads without a price, or whose
+// price can't be converted to the currency of the rule, never match.
+func (r *Rule) matchPrice(o productpkg.Offer, rates *exchange.Rates, at time.Time) bool {
+	var low, high int64
+	switch o.PriceKind {
+	case productpkg.PriceFixed, productpkg.PriceFree:
+		low, high = o.PriceSmallUnit, o.PriceSmallUnit
+	case productpkg.PriceRange:
+		low, high = o.PriceSmallUnit, o.HighPriceSmallUnit
+	default:
+		return false
+	}
+
+	if o.PriceCurrency != r.Currency {
+		var err error
+		if low, err = rates.Convert(low, o.PriceCurrency, r.Currency, at); err != nil {
+			return false
+		}
+		if high, err = rates.Convert(high, o.PriceCurrency, r.Currency, at); err != nil {
+			return false
+		}
+	}
+
+	if r.MinPrice.Valid && high < r.MinPrice.Int64 {
+		return false
+	}
+	if r.MaxPrice.Valid && low > r.MaxPrice.Int64 {
+		return false
+	}
+	return true
+}
+
+// matchCategory matches the category of the rule and its subcategories,
+// whose URLs are nested under it.
+func (r *Rule) matchCategory(p *productpkg.Product) bool {
+	if strings.HasPrefix(normalizeCategory(p.Category), r.category) {
+		return true
+	}
+	for _, b := range p.CategoryPath {
+		if normalizeCategory(b.URL) == r.category {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeCategory ends category URLs in a slash, so a category is a
+// prefix of its subcategories but not of its siblings.
+func normalizeCategory(category string) string {
+	category = strings.TrimSpace(category)
+	if category == "" || strings.HasSuffix(category, "/") {
+		return category
+	}
+	return category + "/"
+}
+
+// conditionName turns "https://schema.org/UsedCondition" into "Used".
+func conditionName(condition string) string {
+	return strings.TrimSuffix(path.Base(condition), "Condition")
+}
+
+func validCondition(condition string) bool {
+	for _, c := range Conditions {
+		if strings.EqualFold(c, condition) {
+			return true
+		}
+	}
+	return false
+}
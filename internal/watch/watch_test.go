@@ -0,0 +1,178 @@
+package watch
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/exchange"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+// loadProducts reads the sample ads rules are matched against, keyed by a
+// short name.
+func loadProducts(t *testing.T) map[string]*productpkg.Product {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/products.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var products map[string]*productpkg.Product
+	if err := json.Unmarshal(data, &products); err != nil {
+		t.Fatal(err)
+	}
+	return products
+}
+
+func price(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: true}
+}
+
+func TestMatch(t *testing.T) {
+	products := loadProducts(t)
+
+	at := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	rates, err := exchange.New([]dbpkg.ExchangeRate{
+		{Currency: "EUR", Quote: "RON", Day: at.Truncate(24 * time.Hour), Rate: "5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		rule dbpkg.WatchRule
+		want []string
+	}{
+		{
+			name: "keyword",
+			rule: dbpkg.WatchRule{Keywords: "superlight"},
+			want: []string{"superlight", "superlight-broken"},
+		},
+		{
+			name: "negated keyword",
+			rule: dbpkg.WatchRule{Keywords: "superlight -defect"},
+			want: []string{"superlight"},
+		},
+		{
+			name: "diacritics and description",
+			rule: dbpkg.WatchRule{Keywords: "garantie"},
+			want: []string{"keyboard", "superlight"},
+		},
+		{
+			name: "phrase",
+			rule: dbpkg.WatchRule{Keywords: `"g pro x"`},
+			want: []string{"superlight"},
+		},
+		{
+			name: "negated phrase",
+			rule: dbpkg.WatchRule{Keywords: `-"pentru piese" logitech`},
+			want: []string{"superlight"},
+		},
+		{
+			name: "whole words only",
+			rule: dbpkg.WatchRule{Keywords: "super"},
+			want: nil,
+		},
+		{
+			name: "price range",
+			rule: dbpkg.WatchRule{MinPrice: price(10000), MaxPrice: price(40000), Currency: "RON"},
+			want: []string{"superlight", "tires"},
+		},
+		{
+			name: "maximum price includes free ads",
+			rule: dbpkg.WatchRule{MaxPrice: price(10000), Currency: "RON"},
+			want: []string{"free-desk", "superlight-broken"},
+		},
+		{
+			name: "converted to the currency of the rule",
+			rule: dbpkg.WatchRule{MinPrice: price(6000), MaxPrice: price(8000), Currency: "EUR"},
+			want: []string{"superlight", "tires"},
+		},
+		{
+			name: "currency without a rate",
+			rule: dbpkg.WatchRule{MinPrice: price(1), Currency: "USD"},
+			want: nil,
+		},
+		{
+			name: "category and subcategories",
+			rule: dbpkg.WatchRule{Category: "https://www.olx.ro/electronice-si-electrocasnice/periferice"},
+			want: []string{"keyboard", "superlight", "superlight-broken"},
+		},
+		{
+			name: "location",
+			rule: dbpkg.WatchRule{Location: "cluj napoca"},
+			want: []string{"apartment", "keyboard", "superlight"},
+		},
+		{
+			name: "location with diacritics",
+			rule: dbpkg.WatchRule{Location: "Bucuresti"},
+			want: []string{"superlight-broken"},
+		},
+		{
+			name: "condition",
+			rule: dbpkg.WatchRule{Condition: "new"},
+			want: []string{"keyboard"},
+		},
+		{
+			name: "every criterion",
+			rule: dbpkg.WatchRule{
+				Keywords:  "logitech",
+				MaxPrice:  price(40000),
+				Currency:  "RON",
+				Category:  "https://www.olx.ro/electronice-si-electrocasnice/",
+				Location:  "Cluj-Napoca",
+				Condition: "used",
+			},
+			want: []string{"superlight"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Compile(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for name, p := range products {
+				if rule.Match(p, rates, at) {
+					got = append(got, name)
+				}
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got matches %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule dbpkg.WatchRule
+		want error
+	}{
+		{"no criteria", dbpkg.WatchRule{Keywords: " - "}, ErrNoCriteria},
+		{"unterminated quote", dbpkg.WatchRule{Keywords: `"g pro`}, ErrUnterminatedQuote},
+		{"inverted prices", dbpkg.WatchRule{MinPrice: price(2), MaxPrice: price(1), Currency: "RON"}, ErrInvalidPrice},
+		{"price without currency", dbpkg.WatchRule{MaxPrice: price(1)}, ErrMissingCurrency},
+		{"unknown condition", dbpkg.WatchRule{Condition: "mint"}, ErrUnknownCondition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Compile(tt.rule); !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/exchange"
+	"github.com/Ozoniuss/olx-tracker/internal/export"
+	"github.com/Ozoniuss/olx-tracker/internal/preferences"
+	"github.com/Ozoniuss/olx-tracker/internal/risk"
+)
+
+// requireAPIUser authenticates API requests either with the dashboard session
+// cookie or with HTTP basic auth, so scripts can call the API directly.
+// Unlike requireUser it answers with 401 instead of redirecting.
+func (s *Server) requireAPIUser(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := s.apiUser(r)
+		if err != nil {
+			if !errors.Is(err, dbpkg.ErrNotFound) {
+				s.serverError(w, r, err)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="olx-tracker"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r.WithContext(withUser(r.Context(), userID)))
+	})
+}
+
+func (s *Server) apiUser(r *http.Request) (uuid.UUID, error) {
+	if username, password, ok := r.BasicAuth(); ok {
+		return dbpkg.AuthenticateUser(r.Context(), s.db, username, password)
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		return dbpkg.GetSessionUserID(r.Context(), s.db, cookie.Value)
+	}
+	return uuid.Nil, dbpkg.ErrNotFound
+}
+
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	formatParam := r.URL.Query().Get("format")
+	if formatParam == "" {
+		formatParam = string(export.FormatCSV)
+	}
+	format, err := export.ParseFormat(formatParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prefs, err := preferences.Load(r.Context(), s.db, userFromContext(r.Context()))
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+	// prices are converted to the preferred currency unless another one, or
+	// none with an empty ?currency=, is asked for
+	opts := export.Options{
+		IncludeRawJSON: r.URL.Query().Get("raw_json") == "true",
+		Currency:       prefs.Currency,
+		Location:       prefs.Location,
+	}
+	if r.URL.Query().Has("currency") {
+		opts.Currency = strings.ToUpper(r.URL.Query().Get("currency"))
+	}
+	if opts.Currency != "" && !exchange.ValidCurrency(opts.Currency) {
+		http.Error(w, "currency must be a currency code such as EUR", http.StatusBadRequest)
+		return
+	}
+
+	filename := fmt.Sprintf("olx-tracker-%s.%s", time.Now().Format("20060102"), format)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// The status line is already sent once the first row is written, so a
+	// failure halfway through can only be logged.
+	err = export.WriteForUser(r.Context(), s.db, w, userFromContext(r.Context()), format, opts)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "export failed", "format", format, "error", err)
+	}
+}
+
+// riskResponse is the risk assessment of the latest snapshot of an ad.
+type riskResponse struct {
+	Version int `json:"version"`
+	// Score is null until the snapshot was assessed.
+	Score   *int64             `json:"score"`
+	Warn    bool               `json:"warn"`
+	Reasons []dbpkg.RiskReason `json:"reasons"`
+}
+
+func (s *Server) handleRisk(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// the snapshot lookup isn't scoped to a user
+	if _, err := dbpkg.GetTrackedProductForUser(r.Context(), s.db, userFromContext(r.Context()), productID); err != nil {
+		if errors.Is(err, dbpkg.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		s.serverError(w, r, err)
+		return
+	}
+
+	latest, err := dbpkg.GetLatestSnapshot(r.Context(), s.db, productID)
+	if err != nil {
+		if errors.Is(err, dbpkg.ErrNotFound) {
+			http.Error(w, "ad was not fetched yet", http.StatusNotFound)
+			return
+		}
+		s.serverError(w, r, err)
+		return
+	}
+
+	resp := riskResponse{
+		Version: latest.Version,
+		Reasons: latest.RiskReasons,
+	}
+	if latest.RiskScore.Valid {
+		resp.Score = &latest.RiskScore.Int64
+		resp.Warn = latest.RiskScore.Int64 >= risk.WarnScore
+	}
+	if resp.Reasons == nil {
+		resp.Reasons = []dbpkg.RiskReason{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
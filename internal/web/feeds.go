@@ -0,0 +1,126 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/feed"
+	"github.com/Ozoniuss/olx-tracker/internal/preferences"
+)
+
+const feedEntries = 50
+
+// feedPath is the token-authenticated path of the feed of a user, or of a
+// single product when productID is valid.
+func (s *Server) feedPath(userID uuid.UUID, productID uuid.NullUUID) string {
+	path := "/feeds/" + userID.String()
+	if productID.Valid {
+		path += "/products/" + productID.UUID.String()
+	}
+	return path + "?token=" + s.feedSigner.Token(userID, productID)
+}
+
+func (s *Server) handleUserFeed(w http.ResponseWriter, r *http.Request) {
+	s.serveFeed(w, r, r.PathValue("user"), "")
+}
+
+func (s *Server) handleProductFeed(w http.ResponseWriter, r *http.Request) {
+	s.serveFeed(w, r, r.PathValue("user"), r.PathValue("product"))
+}
+
+func (s *Server) serveFeed(w http.ResponseWriter, r *http.Request, rawUserID, rawProductID string) {
+	userID, err := uuid.Parse(rawUserID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var productID uuid.NullUUID
+	if rawProductID != "" {
+		id, err := uuid.Parse(rawProductID)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		productID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	if !s.feedSigner.Valid(userID, productID, r.URL.Query().Get("token")) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	title := "OLX Tracker: all tracked ads"
+	if productID.Valid {
+		product, err := dbpkg.GetTrackedProductForUser(r.Context(), s.db, userID, productID.UUID)
+		if err != nil {
+			if errors.Is(err, dbpkg.ErrNotFound) {
+				http.NotFound(w, r)
+				return
+			}
+			s.serverError(w, r, err)
+			return
+		}
+		title = "OLX Tracker: " + product.URL
+	}
+
+	prefs, err := preferences.Load(r.Context(), s.db, userID)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	changes, err := dbpkg.ListProductChangesForUser(r.Context(), s.db, userID, productID, feedEntries)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+	if !productID.Valid {
+		// Matches of the user's watch rules are about ads they may not
+		// track, so they only show up in the feed of all ads.
+		matches, err := dbpkg.ListWatchMatchesForUser(r.Context(), s.db, userID, feedEntries)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+		changes = append(changes, matches...)
+		slices.SortStableFunc(changes, func(a, b dbpkg.ProductChange) int {
+			return b.At.Compare(a.At)
+		})
+	}
+	// During the quiet hours of the user the changes since they started are
+	// held back, so the reader gets them all at once when they end.
+	if start, _, ok := prefs.Quiet(time.Now()); ok {
+		changes = slices.DeleteFunc(changes, func(c dbpkg.ProductChange) bool {
+			return !c.At.Before(start)
+		})
+	}
+	changes = changes[:min(len(changes), feedEntries)]
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	selfURL := fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.RequestURI())
+	feedID := "tag:olx-tracker,2026:feed/" + userID.String()
+	if productID.Valid {
+		feedID += "/" + productID.UUID.String()
+	}
+
+	body, err := feed.New(feedID, title, selfURL, changes, prefs.Locale).Marshal()
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	if _, err := w.Write(body); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write feed", "error", err)
+	}
+}
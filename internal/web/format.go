@@ -0,0 +1,205 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"slices"
+	"strings"
+	"time"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/lifecycle"
+	"github.com/Ozoniuss/olx-tracker/internal/money"
+	"github.com/Ozoniuss/olx-tracker/internal/preferences"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+// formatter formats prices and times for the pages of a user, according to
+// their locale and time zone. The zero value formats like money.Format and in
+// the local time zone of the server.
+type formatter struct {
+	locale money.Locale
+	loc    *time.Location
+}
+
+func newFormatter(prefs preferences.Preferences) formatter {
+	return formatter{locale: prefs.Locale, loc: prefs.Location}
+}
+
+// funcs are the template functions of the pages.
+func (f formatter) funcs() template.FuncMap {
+	return template.FuncMap{
+		"snapshotPrice": f.snapshotPrice,
+		"images":        imagesFromRawJSON,
+		"chart":         f.chart,
+		"time":          f.time,
+	}
+}
+
+func (f formatter) price(smallUnit int64, currency string) string {
+	return f.locale.Format(smallUnit, currency)
+}
+
+// priceChange describes how the price moved between two snapshots, e.g.
+// "-49.00 RON (-9.8%)".
+func (f formatter) priceChange(from, to int64, currency string) string {
+	diff := to - from
+	if diff == 0 {
+		return "no change"
+	}
+
+	sign := ""
+	if diff > 0 {
+		sign = "+"
+	}
+	if from == 0 {
+		return sign + f.price(diff, currency)
+	}
+	return fmt.Sprintf("%s%s (%s%.1f%%)", sign, f.price(diff, currency), sign, float64(diff)*100/float64(from))
+}
+
+// snapshotPrice formats the price of a snapshot according to its kind, e.g.
+// "150.00 - 220.50 RON" for a range.
+func (f formatter) snapshotPrice(s dbpkg.ProductSnapshot) string {
+	return productpkg.FormatPrice(f.locale, productpkg.PriceKind(s.PriceKind), s.PriceSmallUnit, s.HighPriceSmallUnit, s.Currency)
+}
+
+// summaryPrice formats the latest price of a tracked ad according to its
+// kind.
+func (f formatter) summaryPrice(s dbpkg.ProductSummary) string {
+	return productpkg.FormatPrice(f.locale, productpkg.PriceKind(s.LatestPriceKind), s.LatestPriceSmallUnit, s.LatestHighPriceSmallUnit, s.Currency)
+}
+
+// lifecycle describes how long an ad is or was on the market, e.g. "Sold
+// after 12 days for 800.00 RON (2 price cuts)".
+func (f formatter) lifecycle(s lifecycle.Summary) string {
+	days := int(s.DaysOnMarket)
+	duration := fmt.Sprintf("%d days", days)
+	if days == 1 {
+		duration = "1 day"
+	}
+	cuts := fmt.Sprintf("%d price cuts", s.PriceCuts)
+	switch s.PriceCuts {
+	case 0:
+		cuts = "no price cuts"
+	case 1:
+		cuts = "1 price cut"
+	}
+	var high sql.NullInt64
+	if s.FinalHighPriceSmallUnit != nil {
+		high = sql.NullInt64{Int64: *s.FinalHighPriceSmallUnit, Valid: true}
+	}
+	price := productpkg.FormatPrice(f.locale, productpkg.PriceKind(s.FinalPriceKind), s.FinalPriceSmallUnit, high, s.Currency)
+
+	switch {
+	case s.Sold:
+		return fmt.Sprintf("Sold after %s for %s (%s)", duration, price, cuts)
+	case !s.DeactivatedAt.IsZero():
+		return fmt.Sprintf("Withdrawn after %s at %s (%s)", duration, price, cuts)
+	default:
+		return fmt.Sprintf("On the market for %s (%s so far)", duration, cuts)
+	}
+}
+
+func (f formatter) time(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	loc := f.loc
+	if loc == nil {
+		loc = time.Local
+	}
+	return t.In(loc).Format("2006-01-02 15:04")
+}
+
+// imagesFromRawJSON extracts the image URLs from a stored snapshot. Invalid
+// or empty JSON simply yields no images.
+func imagesFromRawJSON(raw []byte) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var p productpkg.Product
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil
+	}
+	return p.Image
+}
+
+const (
+	chartWidth   = 640
+	chartHeight  = 200
+	chartPadding = 24
+)
+
+// chart draws the snapshots as an inline SVG line chart. Snapshots may be
+// passed in any order, the x axis is always the retrieval time. Snapshots in
+// another currency than the latest one, e.g. of an earlier ad the product is
+// a repost of, are left out.
+func (f formatter) chart(snapshots []dbpkg.ProductSnapshot) template.HTML {
+	if len(snapshots) == 0 {
+		return ""
+	}
+
+	// versions only order the snapshots of a single ad, while the history
+	// may continue with the ads it is a repost of
+	points := slices.Clone(snapshots)
+	slices.SortStableFunc(points, func(a, b dbpkg.ProductSnapshot) int {
+		return a.RetrievedAt.Compare(b.RetrievedAt)
+	})
+	latest := points[len(points)-1].Currency
+	points = slices.DeleteFunc(points, func(p dbpkg.ProductSnapshot) bool {
+		return p.Currency != latest
+	})
+
+	minPrice, maxPrice := points[0].PriceSmallUnit, points[0].PriceSmallUnit
+	for _, p := range points {
+		minPrice = min(minPrice, p.PriceSmallUnit)
+		maxPrice = max(maxPrice, p.PriceSmallUnit)
+	}
+	start := points[0].RetrievedAt
+	span := points[len(points)-1].RetrievedAt.Sub(start)
+
+	x := func(p dbpkg.ProductSnapshot) float64 {
+		if span <= 0 {
+			return chartWidth / 2
+		}
+		return chartPadding + float64(p.RetrievedAt.Sub(start))/float64(span)*(chartWidth-2*chartPadding)
+	}
+	y := func(p dbpkg.ProductSnapshot) float64 {
+		if maxPrice == minPrice {
+			return chartHeight / 2
+		}
+		return chartHeight - chartPadding - float64(p.PriceSmallUnit-minPrice)/float64(maxPrice-minPrice)*(chartHeight-2*chartPadding)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" viewBox="0 0 %d %d" role="img" aria-label="Price history">`, chartWidth, chartHeight)
+
+	currency := html.EscapeString(latest)
+	fmt.Fprintf(&b, `<text x="4" y="14">%s</text>`, f.price(maxPrice, currency))
+	fmt.Fprintf(&b, `<text x="4" y="%d">%s</text>`, chartHeight-4, f.price(minPrice, currency))
+
+	b.WriteString(`<polyline points="`)
+	for i, p := range points {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%.1f,%.1f", x(p), y(p))
+	}
+	b.WriteString(`"/>`)
+
+	for _, p := range points {
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3"><title>%s: %s</title></circle>`,
+			x(p), y(p),
+			f.time(p.RetrievedAt),
+			html.EscapeString(f.price(p.PriceSmallUnit, p.Currency)),
+		)
+	}
+
+	b.WriteString(`</svg>`)
+
+	return template.HTML(b.String())
+}
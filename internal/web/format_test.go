@@ -0,0 +1,148 @@
+package web
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/lifecycle"
+	"github.com/Ozoniuss/olx-tracker/internal/money"
+)
+
+func TestFormatPriceChange(t *testing.T) {
+	tests := []struct {
+		from, to int64
+		want     string
+	}{
+		{50000, 45000, "-50.00 RON (-10.0%)"},
+		{40000, 44000, "+40.00 RON (+10.0%)"},
+		{45000, 45000, "no change"},
+		{0, 100, "+1.00 RON"},
+	}
+
+	for _, tt := range tests {
+		if got := (formatter{}).priceChange(tt.from, tt.to, "RON"); got != tt.want {
+			t.Errorf("formatPriceChange(%d, %d) = %q, want %q", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestFormatLifecycle(t *testing.T) {
+	deactivated := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	high := int64(90000)
+	tests := []struct {
+		summary lifecycle.Summary
+		want    string
+	}{
+		{lifecycle.Summary{DaysOnMarket: 3.5, PriceCuts: 1}, "On the market for 3 days (1 price cut so far)"},
+		{lifecycle.Summary{DaysOnMarket: 12.2, PriceCuts: 2, FinalPriceSmallUnit: 80000, Currency: "RON", DeactivatedAt: deactivated, Sold: true}, "Sold after 12 days for 800.00 RON (2 price cuts)"},
+		{lifecycle.Summary{DaysOnMarket: 1, FinalPriceSmallUnit: 80000, Currency: "RON", DeactivatedAt: deactivated}, "Withdrawn after 1 day at 800.00 RON (no price cuts)"},
+		{lifecycle.Summary{DaysOnMarket: 5, FinalPriceSmallUnit: 70000, FinalHighPriceSmallUnit: &high, FinalPriceKind: "range", Currency: "RON", DeactivatedAt: deactivated, Sold: true}, "Sold after 5 days for 700.00 - 900.00 RON (no price cuts)"},
+	}
+
+	for _, tt := range tests {
+		if got := (formatter{}).lifecycle(tt.summary); got != tt.want {
+			t.Errorf("formatLifecycle() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestFormatSnapshotPrice(t *testing.T) {
+	tests := []struct {
+		snapshot dbpkg.ProductSnapshot
+		want     string
+	}{
+		{dbpkg.ProductSnapshot{PriceKind: "fixed", PriceSmallUnit: 44900, Currency: "RON"}, "449.00 RON"},
+		{dbpkg.ProductSnapshot{PriceKind: "range", PriceSmallUnit: 15000, HighPriceSmallUnit: sql.NullInt64{Int64: 22050, Valid: true}, Currency: "RON"}, "150.00 - 220.50 RON"},
+		{dbpkg.ProductSnapshot{PriceKind: "free", Currency: "RON"}, "free"},
+		{dbpkg.ProductSnapshot{PriceKind: "on_request", Currency: "EUR"}, "on request"},
+	}
+
+	for _, tt := range tests {
+		if got := (formatter{}).snapshotPrice(tt.snapshot); got != tt.want {
+			t.Errorf("formatSnapshotPrice(%+v) = %q, want %q", tt.snapshot, got, tt.want)
+		}
+	}
+}
+
+func TestImagesFromRawJSON(t *testing.T) {
+	images := imagesFromRawJSON([]byte(`{"image":["https://a/1","https://a/2"]}`))
+	if len(images) != 2 || images[0] != "https://a/1" {
+		t.Errorf("unexpected images: %v", images)
+	}
+
+	if images := imagesFromRawJSON([]byte(`not json`)); images != nil {
+		t.Errorf("expected no images for invalid json, got %v", images)
+	}
+}
+
+func TestPriceChart(t *testing.T) {
+	if got := (formatter{}).chart(nil); got != "" {
+		t.Errorf("expected empty chart without snapshots, got %q", got)
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// newest first, the same order ListAddSnapshotsForUser returns
+	snapshots := []dbpkg.ProductSnapshot{
+		{Version: 3, RetrievedAt: start.Add(48 * time.Hour), PriceSmallUnit: 40000, Currency: "RON"},
+		{Version: 2, RetrievedAt: start.Add(24 * time.Hour), PriceSmallUnit: 45000, Currency: "RON"},
+		{Version: 1, RetrievedAt: start, PriceSmallUnit: 50000, Currency: "RON"},
+	}
+
+	chart := string((formatter{}).chart(snapshots))
+
+	if !strings.HasPrefix(chart, "<svg") || !strings.HasSuffix(chart, "</svg>") {
+		t.Fatalf("chart is not an svg element: %s", chart)
+	}
+	// oldest and most expensive point is top left, newest and cheapest is
+	// bottom right
+	if !strings.Contains(chart, `points="24.0,24.0 320.0,100.0 616.0,176.0"`) {
+		t.Errorf("unexpected polyline in chart: %s", chart)
+	}
+	if strings.Count(chart, "<circle") != len(snapshots) {
+		t.Errorf("expected one point per snapshot: %s", chart)
+	}
+	if !strings.Contains(chart, "500.00 RON") || !strings.Contains(chart, "400.00 RON") {
+		t.Errorf("expected min and max labels: %s", chart)
+	}
+
+	// a repost continues the history of the earlier ad, whose versions start
+	// over, and whose snapshots in another currency can't be drawn
+	repost := []dbpkg.ProductSnapshot{
+		{Version: 1, RetrievedAt: start.Add(48 * time.Hour), PriceSmallUnit: 40000, Currency: "RON"},
+		{Version: 2, RetrievedAt: start.Add(24 * time.Hour), PriceSmallUnit: 45000, Currency: "RON"},
+		{Version: 1, RetrievedAt: start, PriceSmallUnit: 50000, Currency: "RON"},
+		{Version: 5, RetrievedAt: start.Add(-24 * time.Hour), PriceSmallUnit: 10000, Currency: "EUR"},
+	}
+	chart = string((formatter{}).chart(repost))
+	if !strings.Contains(chart, `points="24.0,24.0 320.0,100.0 616.0,176.0"`) {
+		t.Errorf("unexpected polyline in chart of a repost: %s", chart)
+	}
+	if strings.Contains(chart, "EUR") {
+		t.Errorf("expected snapshots in another currency to be left out: %s", chart)
+	}
+}
+
+func TestFormatterPreferences(t *testing.T) {
+	bucharest, err := time.LoadLocation("Europe/Bucharest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := formatter{locale: money.LocaleRO, loc: bucharest}
+
+	if got, want := f.priceChange(150000, 123456, "RON"), "-265,44 lei (-17.7%)"; got != want {
+		t.Errorf("priceChange() = %q, want %q", got, want)
+	}
+	snapshot := dbpkg.ProductSnapshot{PriceKind: "range", PriceSmallUnit: 150000, HighPriceSmallUnit: sql.NullInt64{Int64: 220050, Valid: true}, Currency: "EUR"}
+	if got, want := f.snapshotPrice(snapshot), "1.500,00 - 2.200,50 €"; got != want {
+		t.Errorf("snapshotPrice() = %q, want %q", got, want)
+	}
+	if got, want := f.time(time.Date(2026, 10, 18, 21, 30, 0, 0, time.UTC)), "2026-10-19 00:30"; got != want {
+		t.Errorf("time() = %q, want %q", got, want)
+	}
+	if got := f.time(time.Time{}); got != "never" {
+		t.Errorf("time() of the zero time = %q, want never", got)
+	}
+}
@@ -0,0 +1,113 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+
+	"github.com/Ozoniuss/olx-tracker/internal/blob"
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+)
+
+// snapshotImage is an archived image as listed by the API.
+type snapshotImage struct {
+	Position    int    `json:"position"`
+	SourceURL   string `json:"source_url"`
+	Hash        string `json:"hash"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// URL is where the archived copy is served.
+	URL string `json:"url"`
+}
+
+// handleSnapshotImages lists the archived images of a snapshot. Snapshots
+// stored while archiving was disabled have none.
+func (s *Server) handleSnapshotImages(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	images, err := dbpkg.ListSnapshotImagesForUser(r.Context(), s.db, userFromContext(r.Context()), productID, version)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	out := make([]snapshotImage, 0, len(images))
+	for _, img := range images {
+		out = append(out, snapshotImage{
+			Position:    img.Position,
+			SourceURL:   img.SourceURL,
+			Hash:        img.Hash,
+			ContentType: img.ContentType,
+			Size:        img.Size,
+			URL:         "/api/images/" + img.Hash,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// handleImage serves an archived image to the users tracking an ad that had
+// it. The content of a hash never changes, so it may be cached forever.
+func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
+	if s.images == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	hash := r.PathValue("hash")
+	if !blob.ValidKey(hash) {
+		http.NotFound(w, r)
+		return
+	}
+
+	img, err := dbpkg.GetImageForUser(r.Context(), s.db, userFromContext(r.Context()), hash)
+	if err != nil {
+		if errors.Is(err, dbpkg.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		s.serverError(w, r, err)
+		return
+	}
+
+	content, err := s.images.Open(r.Context(), img.Hash)
+	if err != nil {
+		if errors.Is(err, blob.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		s.serverError(w, r, err)
+		return
+	}
+	defer content.Close()
+
+	etag := strconv.Quote(img.Hash)
+	// the content comes from the ads, so browsers must neither guess its
+	// type nor run anything in it, should an older archive hold more than
+	// the raster images archived now
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", img.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(img.Size, 10))
+	io.Copy(w, content)
+}
@@ -0,0 +1,159 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/lifecycle"
+)
+
+// lifecycleEvent is a lifecycle event of an ad as listed by the API.
+type lifecycleEvent struct {
+	Kind           dbpkg.EventKind `json:"kind"`
+	At             time.Time       `json:"at"`
+	Version        int             `json:"version"`
+	PriceSmallUnit int64           `json:"price_small_unit"`
+	// HighPriceSmallUnit is only set for ranges.
+	HighPriceSmallUnit *int64 `json:"high_price_small_unit,omitempty"`
+	PriceKind          string `json:"price_kind"`
+	// The previous prices are only set for price changes.
+	PreviousPriceSmallUnit     *int64 `json:"previous_price_small_unit,omitempty"`
+	PreviousHighPriceSmallUnit *int64 `json:"previous_high_price_small_unit,omitempty"`
+	PreviousPriceKind          string `json:"previous_price_kind,omitempty"`
+	Currency                   string `json:"currency"`
+	Availability               string `json:"availability"`
+}
+
+type lifecycleResponse struct {
+	// Summary is null until the ad was fetched.
+	Summary *lifecycle.Summary `json:"summary"`
+	Events  []lifecycleEvent   `json:"events"`
+}
+
+// handleLifecycle serves the lifecycle events of an ad and their summary.
+func (s *Server) handleLifecycle(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	userID := userFromContext(r.Context())
+	if _, err := dbpkg.GetTrackedProductForUser(r.Context(), s.db, userID, productID); err != nil {
+		if errors.Is(err, dbpkg.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		s.serverError(w, r, err)
+		return
+	}
+
+	events, err := dbpkg.ListProductEventsForUser(r.Context(), s.db, userID, productID)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	resp := lifecycleResponse{Events: make([]lifecycleEvent, 0, len(events))}
+	if summary, ok := lifecycle.Summarize(events, time.Now()); ok {
+		resp.Summary = &summary
+	}
+	for _, e := range events {
+		le := lifecycleEvent{
+			Kind:              e.Kind,
+			At:                e.At,
+			Version:           e.Version,
+			PriceSmallUnit:    e.PriceSmallUnit,
+			PriceKind:         e.PriceKind,
+			PreviousPriceKind: e.PreviousPriceKind.String,
+			Currency:          e.Currency,
+			Availability:      e.Availability,
+		}
+		if e.HighPriceSmallUnit.Valid {
+			le.HighPriceSmallUnit = &e.HighPriceSmallUnit.Int64
+		}
+		if e.PreviousPriceSmallUnit.Valid {
+			le.PreviousPriceSmallUnit = &e.PreviousPriceSmallUnit.Int64
+		}
+		if e.PreviousHighPriceSmallUnit.Valid {
+			le.PreviousHighPriceSmallUnit = &e.PreviousHighPriceSmallUnit.Int64
+		}
+		resp.Events = append(resp.Events, le)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type sellThroughBand struct {
+	MinPriceSmallUnit int64   `json:"min_price_small_unit"`
+	MaxPriceSmallUnit int64   `json:"max_price_small_unit"`
+	Sold              int     `json:"sold"`
+	MedianDaysToSell  float64 `json:"median_days_to_sell"`
+	AvgPriceCuts      float64 `json:"avg_price_cuts"`
+}
+
+type sellThroughReport struct {
+	Category                  string            `json:"category"`
+	Currency                  string            `json:"currency"`
+	Active                    int               `json:"active"`
+	Sold                      int               `json:"sold"`
+	Withdrawn                 int               `json:"withdrawn"`
+	MedianDaysToSell          float64           `json:"median_days_to_sell"`
+	AvgPriceCuts              float64           `json:"avg_price_cuts"`
+	MedianFirstPriceSmallUnit int64             `json:"median_first_price_small_unit"`
+	MedianFinalPriceSmallUnit int64             `json:"median_final_price_small_unit"`
+	MedianDaysActive          float64           `json:"median_days_active"`
+	Bands                     []sellThroughBand `json:"bands"`
+}
+
+// handleSellThrough reports how fast the ads of every category sell, or of
+// the one given as ?category=<url>, optionally only for the ads first seen
+// in the last ?days=<n> days.
+func (s *Server) handleSellThrough(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "days must be a positive number", http.StatusBadRequest)
+			return
+		}
+		since = time.Now().AddDate(0, 0, -n)
+	}
+
+	reports, err := dbpkg.ListSellThrough(r.Context(), s.db, r.URL.Query().Get("category"), since)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	out := make([]sellThroughReport, 0, len(reports))
+	for _, rep := range reports {
+		o := sellThroughReport{
+			Category:                  rep.Category,
+			Currency:                  rep.Currency,
+			Active:                    rep.Active,
+			Sold:                      rep.Sold,
+			Withdrawn:                 rep.Withdrawn,
+			MedianDaysToSell:          rep.MedianDaysToSell,
+			AvgPriceCuts:              rep.AvgPriceCuts,
+			MedianFirstPriceSmallUnit: rep.MedianFirstPriceSmallUnit,
+			MedianFinalPriceSmallUnit: rep.MedianFinalPriceSmallUnit,
+			MedianDaysActive:          rep.MedianDaysActive,
+			Bands:                     make([]sellThroughBand, 0, len(rep.Bands)),
+		}
+		for _, b := range rep.Bands {
+			o.Bands = append(o.Bands, sellThroughBand(b))
+		}
+		out = append(out, o)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
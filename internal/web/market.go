@@ -0,0 +1,195 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/market"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+// defaultMarketDays is how far back the market trend goes by default.
+const defaultMarketDays = 30
+
+// marketStat is the stats of a market segment on a day as listed by the API.
+type marketStat struct {
+	Day      string `json:"day"`
+	Listings int    `json:"listings"`
+	Min      int64  `json:"min_small_unit"`
+	P10      int64  `json:"p10_small_unit"`
+	P25      int64  `json:"p25_small_unit"`
+	Median   int64  `json:"median_small_unit"`
+	P75      int64  `json:"p75_small_unit"`
+	P90      int64  `json:"p90_small_unit"`
+	Max      int64  `json:"max_small_unit"`
+}
+
+func newMarketStat(s dbpkg.MarketStat) marketStat {
+	return marketStat{
+		Day:      s.Day.Format(time.DateOnly),
+		Listings: s.Listings,
+		Min:      s.MinSmallUnit,
+		P10:      s.P10SmallUnit,
+		P25:      s.P25SmallUnit,
+		Median:   s.MedianSmallUnit,
+		P75:      s.P75SmallUnit,
+		P90:      s.P90SmallUnit,
+		Max:      s.MaxSmallUnit,
+	}
+}
+
+// marketResponse is the price trend of a market segment, the oldest day
+// first.
+type marketResponse struct {
+	Kind     string `json:"kind"`
+	Key      string `json:"key"`
+	Currency string `json:"currency"`
+	// TrendPercent is how much the median changed over the days.
+	TrendPercent float64      `json:"trend_percent"`
+	Days         []marketStat `json:"days"`
+}
+
+// handleMarket serves the stats of a category, given as ?category=<url>, or
+// of a keyword, given as ?keyword=<query>. Keywords are only materialized
+// once they were added with the market command.
+func (s *Server) handleMarket(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var kind, key string
+	switch {
+	case q.Get("category") != "" && q.Get("keyword") == "":
+		kind, key = dbpkg.MarketCategory, q.Get("category")
+	case q.Get("keyword") != "" && q.Get("category") == "":
+		kind, key = dbpkg.MarketKeyword, market.NormalizeKeyword(q.Get("keyword"))
+	default:
+		http.Error(w, "exactly one of category or keyword is required", http.StatusBadRequest)
+		return
+	}
+
+	currency := q.Get("currency")
+	if currency == "" {
+		currency = "RON"
+	}
+
+	days := defaultMarketDays
+	if v := q.Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "days must be a positive number", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	since := time.Now().AddDate(0, 0, -days+1)
+
+	stats, err := dbpkg.ListMarketStats(r.Context(), s.db, kind, key, currency, since)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	resp := marketResponse{
+		Kind:         kind,
+		Key:          key,
+		Currency:     currency,
+		TrendPercent: market.Trend(stats),
+		Days:         make([]marketStat, 0, len(stats)),
+	}
+	for _, st := range stats {
+		resp.Days = append(resp.Days, newMarketStat(st))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// productMarketResponse rates the latest price of an ad against its
+// category.
+type productMarketResponse struct {
+	Category       string `json:"category"`
+	Currency       string `json:"currency"`
+	PriceSmallUnit int64  `json:"price_small_unit"`
+	market.Rating
+	Description string `json:"description"`
+	// Stats is null when the category has no stats yet.
+	Stats *marketStat `json:"stats"`
+}
+
+func (s *Server) handleProductMarket(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// the snapshot lookup isn't scoped to a user
+	if _, err := dbpkg.GetTrackedProductForUser(r.Context(), s.db, userFromContext(r.Context()), productID); err != nil {
+		if errors.Is(err, dbpkg.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		s.serverError(w, r, err)
+		return
+	}
+
+	latest, err := dbpkg.GetLatestSnapshot(r.Context(), s.db, productID)
+	if err != nil {
+		if errors.Is(err, dbpkg.ErrNotFound) {
+			http.Error(w, "ad was not fetched yet", http.StatusNotFound)
+			return
+		}
+		s.serverError(w, r, err)
+		return
+	}
+
+	resp, err := s.rateSnapshot(r, latest)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// rateSnapshot compares the price of a snapshot to the latest stats of its
+// category. Prices that aren't fixed, and ads without a category or stats,
+// are rated unknown.
+func (s *Server) rateSnapshot(r *http.Request, snapshot dbpkg.ProductSnapshot) (productMarketResponse, error) {
+	var p productpkg.Product
+	// the category is only stored in the raw snapshot, a snapshot that
+	// doesn't decode simply has none
+	_ = json.Unmarshal(snapshot.RawJSON, &p)
+
+	resp := productMarketResponse{
+		Category:       p.Category,
+		Currency:       snapshot.Currency,
+		PriceSmallUnit: snapshot.PriceSmallUnit,
+		Rating:         market.Rating{Verdict: market.VerdictUnknown},
+	}
+	if p.Category == "" || productpkg.PriceKind(snapshot.PriceKind) != productpkg.PriceFixed {
+		resp.Description = market.Describe(resp.Rating, dbpkg.MarketStat{})
+		return resp, nil
+	}
+
+	stat, err := dbpkg.GetLatestMarketStat(r.Context(), s.db, dbpkg.MarketCategory, p.Category, snapshot.Currency)
+	if err != nil {
+		if errors.Is(err, dbpkg.ErrNotFound) {
+			resp.Description = market.Describe(resp.Rating, dbpkg.MarketStat{})
+			return resp, nil
+		}
+		return productMarketResponse{}, err
+	}
+
+	resp.Rating = market.Rate(snapshot.PriceSmallUnit, stat)
+	resp.Description = market.Describe(resp.Rating, stat)
+	st := newMarketStat(stat)
+	resp.Stats = &st
+	return resp, nil
+}
@@ -0,0 +1,122 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/preferences"
+)
+
+const maxPreferencesBytes = 4 << 10
+
+// userPreferences are the preferences as read and replaced by the API. Empty
+// values are the defaults.
+type userPreferences struct {
+	Currency string `json:"currency"`
+	Timezone string `json:"timezone"`
+	Locale   string `json:"locale"`
+	// PollInterval is a duration such as "6h", empty to poll every cycle.
+	PollInterval string          `json:"poll_interval"`
+	QuietHours   *quietHoursJSON `json:"quiet_hours"`
+	Email        string          `json:"email"`
+	// Digest is daily or weekly to opt in to digests of the changes by
+	// email, empty for none.
+	Digest string `json:"digest"`
+}
+
+// quietHoursJSON are times of the day such as "22:00".
+type quietHoursJSON struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+func newUserPreferences(p preferences.Preferences) userPreferences {
+	out := userPreferences{
+		Currency: p.Currency,
+		Timezone: p.Timezone,
+		Locale:   string(p.Locale),
+		Email:    p.Email,
+		Digest:   string(p.Digest),
+	}
+	if p.PollInterval > 0 {
+		out.PollInterval = p.PollInterval.String()
+	}
+	if p.QuietHours.Enabled() {
+		out.QuietHours = &quietHoursJSON{
+			Start: preferences.FormatClock(p.QuietHours.Start),
+			End:   preferences.FormatClock(p.QuietHours.End),
+		}
+	}
+	return out
+}
+
+func (s *Server) handleGetPreferences(w http.ResponseWriter, r *http.Request) {
+	prefs, err := preferences.Load(r.Context(), s.db, userFromContext(r.Context()))
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserPreferences(prefs))
+}
+
+// handleSetPreferences replaces the preferences of the user, omitted values
+// are reset to the defaults.
+func (s *Server) handleSetPreferences(w http.ResponseWriter, r *http.Request) {
+	var in userPreferences
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPreferencesBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		http.Error(w, "invalid preferences: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stored := dbpkg.UserPreferences{
+		Currency: strings.ToUpper(strings.TrimSpace(in.Currency)),
+		Timezone: strings.TrimSpace(in.Timezone),
+		Locale:   strings.ToLower(strings.TrimSpace(in.Locale)),
+		Email:    strings.TrimSpace(in.Email),
+		Digest:   strings.ToLower(strings.TrimSpace(in.Digest)),
+	}
+	if in.PollInterval != "" {
+		interval, err := time.ParseDuration(in.PollInterval)
+		if err != nil {
+			http.Error(w, "invalid preferences: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		stored.PollInterval = interval
+	}
+	if in.QuietHours != nil {
+		start, err := preferences.ParseClock(in.QuietHours.Start)
+		if err != nil {
+			http.Error(w, "invalid preferences: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		end, err := preferences.ParseClock(in.QuietHours.End)
+		if err != nil {
+			http.Error(w, "invalid preferences: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		stored.QuietStart = sql.NullInt16{Int16: int16(start), Valid: true}
+		stored.QuietEnd = sql.NullInt16{Int16: int16(end), Valid: true}
+	}
+
+	prefs, err := preferences.FromDB(stored)
+	if err != nil {
+		http.Error(w, "invalid preferences: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := dbpkg.SetUserPreferences(r.Context(), s.db, userFromContext(r.Context()), prefs.ToDB()); err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserPreferences(prefs))
+}
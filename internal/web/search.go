@@ -0,0 +1,98 @@
+package web
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// searchResult is a matching product as listed by the API. The highlights
+// are HTML, with the matched words in <mark> elements.
+type searchResult struct {
+	ProductID        uuid.UUID `json:"product_id"`
+	URL              string    `json:"url"`
+	Version          int       `json:"version"`
+	RetrievedAt      time.Time `json:"retrieved_at"`
+	MatchingVersions int       `json:"matching_versions"`
+	Rank             float64   `json:"rank"`
+	PriceSmallUnit   int64     `json:"price_small_unit"`
+	// HighPriceSmallUnit is only set for ranges.
+	HighPriceSmallUnit *int64 `json:"high_price_small_unit,omitempty"`
+	PriceKind          string `json:"price_kind"`
+	Currency           string `json:"currency"`
+	// Price is formatted according to the kind and the user's locale.
+	Price                string `json:"price"`
+	NameHighlight        string `json:"name_highlight"`
+	DescriptionHighlight string `json:"description_highlight"`
+}
+
+// highlightHTML escapes a search highlight and marks the matched words.
+var highlightHTML = strings.NewReplacer(
+	dbpkg.HighlightStart, "<mark>",
+	dbpkg.HighlightEnd, "</mark>",
+)
+
+// handleSearch searches the names and descriptions of the user's ads and
+// their history, given as ?q=<query>.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	results, err := dbpkg.SearchProductsForUser(r.Context(), s.db, userFromContext(r.Context()), query, limit)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	f := newFormatter(preferencesFromContext(r.Context()))
+	out := make([]searchResult, 0, len(results))
+	for _, res := range results {
+		sr := searchResult{
+			ProductID:            res.ProductID,
+			URL:                  res.URL,
+			Version:              res.Version,
+			RetrievedAt:          res.RetrievedAt,
+			MatchingVersions:     res.MatchingVersions,
+			Rank:                 res.Rank,
+			PriceSmallUnit:       res.PriceSmallUnit,
+			PriceKind:            res.PriceKind,
+			Currency:             res.Currency,
+			Price:                productpkg.FormatPrice(f.locale, productpkg.PriceKind(res.PriceKind), res.PriceSmallUnit, res.HighPriceSmallUnit, res.Currency),
+			NameHighlight:        highlightHTML.Replace(html.EscapeString(res.NameHighlight)),
+			DescriptionHighlight: highlightHTML.Replace(html.EscapeString(res.DescriptionHighlight)),
+		}
+		if res.HighPriceSmallUnit.Valid {
+			sr.HighPriceSmallUnit = &res.HighPriceSmallUnit.Int64
+		}
+		out = append(out, sr)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
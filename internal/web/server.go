@@ -0,0 +1,485 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/Ozoniuss/olx-tracker/internal/blob"
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/exchange"
+	"github.com/Ozoniuss/olx-tracker/internal/feed"
+	"github.com/Ozoniuss/olx-tracker/internal/lifecycle"
+	"github.com/Ozoniuss/olx-tracker/internal/logging"
+	"github.com/Ozoniuss/olx-tracker/internal/preferences"
+	productpkg "github.com/Ozoniuss/olx-tracker/internal/product"
+)
+
+//go:embed templates static
+var assets embed.FS
+
+const (
+	sessionCookieName = "olxtracker_session"
+	sessionTTL        = 30 * 24 * time.Hour
+)
+
+type contextKey int
+
+const (
+	userIDKey contextKey = iota
+	preferencesKey
+)
+
+// Server renders the dashboard. Every page except login requires a session.
+type Server struct {
+	db         *sql.DB
+	feedSigner feed.Signer
+	// images serves the archived images, nil if they aren't archived
+	images  blob.Store
+	pages   map[string]*template.Template
+	mux     *http.ServeMux
+	handler http.Handler
+}
+
+// NewServer creates the dashboard. images may be nil when images aren't
+// archived.
+func NewServer(db *sql.DB, feedSecret string, images blob.Store) (*Server, error) {
+	pages, err := parsePages()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		db:         db,
+		feedSigner: feed.NewSigner(feedSecret),
+		images:     images,
+		pages:      pages,
+		mux:        http.NewServeMux(),
+	}
+	s.routes()
+
+	// spans are renamed to the matched route pattern once the mux ran
+	s.handler = otelhttp.NewHandler(s.mux, "web",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			if r.Pattern != "" {
+				return r.Pattern
+			}
+			return r.Method
+		}),
+	)
+
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+func (s *Server) routes() {
+	static, _ := fs.Sub(assets, "static")
+	s.mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServerFS(static)))
+
+	s.mux.HandleFunc("GET /login", s.handleLoginPage)
+	s.mux.HandleFunc("POST /login", s.handleLogin)
+	s.mux.HandleFunc("POST /logout", s.handleLogout)
+
+	s.mux.Handle("GET /{$}", s.requireUser(s.handleProducts))
+	s.mux.Handle("POST /products", s.requireUser(s.handleTrackProduct))
+	s.mux.Handle("GET /products/{id}", s.requireUser(s.handleProduct))
+
+	s.mux.Handle("GET /api/export", s.requireAPIUser(s.handleExport))
+	s.mux.Handle("GET /api/products/{id}/versions/{version}/images", s.requireAPIUser(s.handleSnapshotImages))
+	s.mux.Handle("GET /api/images/{hash}", s.requireAPIUser(s.handleImage))
+	s.mux.Handle("GET /api/products/{id}/risk", s.requireAPIUser(s.handleRisk))
+	s.mux.Handle("GET /api/products/{id}/market", s.requireAPIUser(s.handleProductMarket))
+	s.mux.Handle("GET /api/products/{id}/lifecycle", s.requireAPIUser(s.handleLifecycle))
+	s.mux.Handle("GET /api/market", s.requireAPIUser(s.handleMarket))
+	s.mux.Handle("GET /api/reports/sell-through", s.requireAPIUser(s.handleSellThrough))
+	s.mux.Handle("GET /api/search", s.requireAPIUser(s.handleSearch))
+	s.mux.Handle("GET /api/watch/rules", s.requireAPIUser(s.handleListWatchRules))
+	s.mux.Handle("POST /api/watch/rules", s.requireAPIUser(s.handleCreateWatchRule))
+	s.mux.Handle("DELETE /api/watch/rules/{id}", s.requireAPIUser(s.handleDeleteWatchRule))
+	s.mux.Handle("GET /api/watch/matches", s.requireAPIUser(s.handleListWatchMatches))
+	s.mux.Handle("GET /api/preferences", s.requireAPIUser(s.handleGetPreferences))
+	s.mux.Handle("PUT /api/preferences", s.requireAPIUser(s.handleSetPreferences))
+
+	// feed readers can't log in, these are authenticated by the url token
+	s.mux.HandleFunc("GET /feeds/{user}", s.handleUserFeed)
+	s.mux.HandleFunc("GET /feeds/{user}/products/{product}", s.handleProductFeed)
+}
+
+// parsePages parses the page templates with the default formatting. They are
+// never executed directly, render clones them with the formatting of the user.
+func parsePages() (map[string]*template.Template, error) {
+	funcs := formatter{}.funcs()
+
+	pages := make(map[string]*template.Template)
+	for _, page := range []string{"login", "products", "product"} {
+		t, err := template.New("layout.html").Funcs(funcs).ParseFS(
+			assets,
+			"templates/layout.html",
+			"templates/"+page+".html",
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s template: %w", page, err)
+		}
+		pages[page] = t
+	}
+
+	return pages, nil
+}
+
+type pageData struct {
+	Title    string
+	LoggedIn bool
+	Error    string
+	Data     any
+}
+
+func (s *Server) render(w http.ResponseWriter, r *http.Request, status int, page string, data pageData) {
+	t, err := s.pages[page].Clone()
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+	t.Funcs(newFormatter(preferencesFromContext(r.Context())).funcs())
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := t.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "failed to render page", "page", page, "error", err)
+	}
+}
+
+func (s *Server) requireUser(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(sessionCookieName)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		userID, err := dbpkg.GetSessionUserID(r.Context(), s.db, cookie.Value)
+		if err != nil {
+			if !errors.Is(err, dbpkg.ErrNotFound) {
+				slog.ErrorContext(r.Context(), "failed to look up session", "error", err)
+			}
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		prefs, err := preferences.Load(r.Context(), s.db, userID)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+		ctx := withUser(r.Context(), userID)
+		next(w, r.WithContext(context.WithValue(ctx, preferencesKey, prefs)))
+	})
+}
+
+// withUser stores the authenticated user in the context, both for the
+// handlers and for the log records of the request.
+func withUser(ctx context.Context, userID uuid.UUID) context.Context {
+	ctx = context.WithValue(ctx, userIDKey, userID)
+	return logging.With(ctx, slog.String("user_id", userID.String()))
+}
+
+func userFromContext(ctx context.Context) uuid.UUID {
+	userID, _ := ctx.Value(userIDKey).(uuid.UUID)
+	return userID
+}
+
+// preferencesFromContext returns the preferences of the user of a dashboard
+// page, the defaults on pages that don't require a session.
+func preferencesFromContext(ctx context.Context) preferences.Preferences {
+	prefs, ok := ctx.Value(preferencesKey).(preferences.Preferences)
+	if !ok {
+		return preferences.Default()
+	}
+	return prefs
+}
+
+func (s *Server) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	s.render(w, r, http.StatusOK, "login", pageData{Title: "Log in"})
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	username := r.PostFormValue("username")
+	password := r.PostFormValue("password")
+
+	userID, err := dbpkg.AuthenticateUser(r.Context(), s.db, username, password)
+	if err != nil {
+		if errors.Is(err, dbpkg.ErrNotFound) {
+			s.render(w, r, http.StatusUnauthorized, "login", pageData{
+				Title: "Log in",
+				Error: "Invalid username or password.",
+			})
+			return
+		}
+		s.serverError(w, r, err)
+		return
+	}
+
+	token, err := dbpkg.CreateSession(r.Context(), s.db, userID, sessionTTL)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if err := dbpkg.DeleteSession(r.Context(), s.db, cookie.Value); err != nil {
+			slog.ErrorContext(r.Context(), "failed to delete session", "error", err)
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:   sessionCookieName,
+		Value:  "",
+		Path:   "/",
+		MaxAge: -1,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (s *Server) handleProducts(w http.ResponseWriter, r *http.Request) {
+	s.renderProducts(w, r, http.StatusOK, "")
+}
+
+type productsPage struct {
+	Summaries []productSummary
+	FeedPath  string
+	// Currency is what prices are converted to, empty if they aren't.
+	Currency string
+}
+
+type productSummary struct {
+	dbpkg.ProductSummary
+	// Price is the latest price formatted according to its kind.
+	Price string
+	// PriceChange is how the price moved since tracking started. Empty
+	// unless the first and latest prices are both fixed and in the same
+	// currency.
+	PriceChange string
+	// ConvertedPrice is the latest price in the currency of the page, at
+	// the rate of the day it was seen. Empty if it is in that currency
+	// already, there is no rate, or the price isn't fixed.
+	ConvertedPrice string
+}
+
+// renderProducts lists the tracked ads, with their prices also converted to
+// the currency given as ?currency=<code>, or else the preferred currency of
+// the user.
+func (s *Server) renderProducts(w http.ResponseWriter, r *http.Request, status int, formError string) {
+	userID := userFromContext(r.Context())
+	summaries, err := dbpkg.ListProductSummariesForUser(r.Context(), s.db, userID)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	prefs := preferencesFromContext(r.Context())
+	currency := prefs.Currency
+	if r.URL.Query().Has("currency") {
+		currency = strings.ToUpper(r.URL.Query().Get("currency"))
+	}
+	if !exchange.ValidCurrency(currency) {
+		currency = ""
+	}
+	var rates *exchange.Rates
+	if currency != "" {
+		if rates, err = exchange.Load(r.Context(), s.db); err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+	}
+
+	f := newFormatter(prefs)
+	rows := make([]productSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		row := productSummary{ProductSummary: summary}
+		if summary.Versions == 0 {
+			rows = append(rows, row)
+			continue
+		}
+
+		row.Price = f.summaryPrice(summary)
+		fixed := summary.FirstPriceKind == string(productpkg.PriceFixed) &&
+			summary.LatestPriceKind == string(productpkg.PriceFixed)
+		if fixed && summary.FirstCurrency == summary.Currency {
+			row.PriceChange = f.priceChange(summary.FirstPriceSmallUnit, summary.LatestPriceSmallUnit, summary.Currency)
+		}
+		if currency != "" && summary.LatestPriceKind == string(productpkg.PriceFixed) && summary.Currency != currency {
+			converted, err := rates.Convert(summary.LatestPriceSmallUnit, summary.Currency, currency, summary.LatestRetrievedAt)
+			if err == nil {
+				row.ConvertedPrice = prefs.FormatPrice(converted, currency)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	s.render(w, r, status, "products", pageData{
+		Title:    "Tracked ads",
+		LoggedIn: true,
+		Error:    formError,
+		Data: productsPage{
+			Summaries: rows,
+			FeedPath:  s.feedPath(userID, uuid.NullUUID{}),
+			Currency:  currency,
+		},
+	})
+}
+
+func (s *Server) handleTrackProduct(w http.ResponseWriter, r *http.Request) {
+	adURL, err := productpkg.NormalizeURL(r.PostFormValue("url"))
+	if err != nil {
+		s.renderProducts(w, r, http.StatusBadRequest, "Please paste the link of an olx.ro ad.")
+		return
+	}
+
+	err = dbpkg.TrackAddForUser(r.Context(), s.db, userFromContext(r.Context()), adURL)
+	if err != nil {
+		if errors.Is(err, dbpkg.ErrAlreadyExists) {
+			s.renderProducts(w, r, http.StatusConflict, "This ad is already being tracked.")
+			return
+		}
+		s.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+type productPage struct {
+	Product dbpkg.ProductWithUrl
+	// RepostedFrom are the earlier ads this one is a repost of, whose
+	// snapshots are part of Snapshots.
+	RepostedFrom []dbpkg.ProductWithUrl
+	Snapshots    []dbpkg.ProductSnapshot
+	// Market compares the latest price to the other ads in the category.
+	Market string
+	// Lifecycle tells how long the ad is on the market, empty until it was
+	// fetched.
+	Lifecycle string
+	// TargetPrice and Notes are what the user noted when importing the ad.
+	TargetPrice string
+	Notes       string
+	FeedPath    string
+}
+
+func (s *Server) handleProduct(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	userID := userFromContext(r.Context())
+	product, err := dbpkg.GetTrackedProductForUser(r.Context(), s.db, userID, productID)
+	if err != nil {
+		if errors.Is(err, dbpkg.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		s.serverError(w, r, err)
+		return
+	}
+
+	snapshots, err := dbpkg.ListAddSnapshotsForUser(r.Context(), s.db, userID, productID)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	// the history continues with the ads this one is a repost of
+	chain, err := dbpkg.ListRepostChainForUser(r.Context(), s.db, userID, productID)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+	for _, previous := range chain {
+		previousSnapshots, err := dbpkg.ListAddSnapshotsForUser(r.Context(), s.db, userID, previous.ID)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+		snapshots = append(snapshots, previousSnapshots...)
+	}
+
+	title := product.URL
+	var marketRating string
+	if len(snapshots) > 0 {
+		title = snapshots[0].Name
+		rating, err := s.rateSnapshot(r, snapshots[0])
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+		marketRating = rating.Description
+	}
+
+	events, err := dbpkg.ListProductEventsForUser(r.Context(), s.db, userID, productID)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+	f := newFormatter(preferencesFromContext(r.Context()))
+	var lifecycleSummary string
+	if summary, ok := lifecycle.Summarize(events, time.Now()); ok {
+		lifecycleSummary = f.lifecycle(summary)
+	}
+
+	notes, err := dbpkg.GetProductNotesForUser(r.Context(), s.db, userID, productID)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+	var targetPrice string
+	if notes.TargetPriceSmallUnit.Valid {
+		targetPrice = f.price(notes.TargetPriceSmallUnit.Int64, notes.TargetPriceCurrency)
+	}
+
+	s.render(w, r, http.StatusOK, "product", pageData{
+		Title:    title,
+		LoggedIn: true,
+		Data: productPage{
+			Product:      product,
+			RepostedFrom: chain,
+			Snapshots:    snapshots,
+			Market:       marketRating,
+			Lifecycle:    lifecycleSummary,
+			TargetPrice:  targetPrice,
+			Notes:        notes.Notes,
+			FeedPath:     s.feedPath(userID, uuid.NullUUID{UUID: productID, Valid: true}),
+		},
+	})
+}
+
+func (s *Server) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "request failed", "error", err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
@@ -0,0 +1,188 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbpkg "github.com/Ozoniuss/olx-tracker/internal/db"
+	"github.com/Ozoniuss/olx-tracker/internal/watch"
+)
+
+const maxWatchRuleBytes = 4 << 10
+
+// watchRule is a watch rule as created and listed by the API. Omitted
+// criteria don't restrict the ads that match.
+type watchRule struct {
+	ID                uuid.UUID `json:"id"`
+	Name              string    `json:"name"`
+	Keywords          string    `json:"keywords,omitempty"`
+	MinPriceSmallUnit *int64    `json:"min_price_small_unit,omitempty"`
+	MaxPriceSmallUnit *int64    `json:"max_price_small_unit,omitempty"`
+	Currency          string    `json:"currency,omitempty"`
+	Category          string    `json:"category,omitempty"`
+	Location          string    `json:"location,omitempty"`
+	Condition         string    `json:"condition,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// watchMatch is an ad that matched a watch rule, with the values of the
+// snapshot that matched.
+type watchMatch struct {
+	RuleID         uuid.UUID         `json:"rule_id"`
+	Rule           string            `json:"rule"`
+	ProductID      uuid.UUID         `json:"product_id"`
+	URL            string            `json:"url"`
+	Version        int               `json:"version"`
+	MatchedAt      time.Time         `json:"matched_at"`
+	Name           string            `json:"name"`
+	PriceSmallUnit int64             `json:"price_small_unit"`
+	Currency       string            `json:"currency"`
+	RiskScore      int               `json:"risk_score"`
+	RiskReasons    dbpkg.RiskReasons `json:"risk_reasons"`
+}
+
+func (s *Server) handleListWatchRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := dbpkg.ListWatchRulesForUser(r.Context(), s.db, userFromContext(r.Context()))
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	out := make([]watchRule, 0, len(rules))
+	for _, rule := range rules {
+		out = append(out, newWatchRule(rule))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// handleCreateWatchRule creates a rule from a JSON watchRule, whose id and
+// creation time are ignored.
+func (s *Server) handleCreateWatchRule(w http.ResponseWriter, r *http.Request) {
+	var in watchRule
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWatchRuleBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		http.Error(w, "invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule := dbpkg.WatchRule{
+		UserID:    userFromContext(r.Context()),
+		Name:      strings.TrimSpace(in.Name),
+		Keywords:  strings.TrimSpace(in.Keywords),
+		Currency:  strings.ToUpper(strings.TrimSpace(in.Currency)),
+		Category:  strings.TrimSpace(in.Category),
+		Location:  strings.TrimSpace(in.Location),
+		Condition: strings.ToLower(strings.TrimSpace(in.Condition)),
+	}
+	if in.MinPriceSmallUnit != nil {
+		rule.MinPrice = sql.NullInt64{Int64: *in.MinPriceSmallUnit, Valid: true}
+	}
+	if in.MaxPriceSmallUnit != nil {
+		rule.MaxPrice = sql.NullInt64{Int64: *in.MaxPriceSmallUnit, Valid: true}
+	}
+
+	if rule.Name == "" {
+		http.Error(w, "invalid rule: name is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := watch.Compile(rule); err != nil {
+		http.Error(w, "invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := dbpkg.CreateWatchRule(r.Context(), s.db, rule)
+	if err != nil {
+		if errors.Is(err, dbpkg.ErrAlreadyExists) {
+			http.Error(w, "a rule with this name already exists", http.StatusConflict)
+			return
+		}
+		s.serverError(w, r, err)
+		return
+	}
+	rule.ID, rule.CreatedAt = id, time.Now()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newWatchRule(rule))
+}
+
+func (s *Server) handleDeleteWatchRule(w http.ResponseWriter, r *http.Request) {
+	ruleID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := dbpkg.DeleteWatchRuleForUser(r.Context(), s.db, userFromContext(r.Context()), ruleID); err != nil {
+		if errors.Is(err, dbpkg.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		s.serverError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListWatchMatches lists the latest ads that matched the user's rules,
+// newest first.
+func (s *Server) handleListWatchMatches(w http.ResponseWriter, r *http.Request) {
+	matches, err := dbpkg.ListWatchMatchesForUser(r.Context(), s.db, userFromContext(r.Context()), feedEntries)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	out := make([]watchMatch, 0, len(matches))
+	for _, m := range matches {
+		reasons := m.RiskReasons
+		if reasons == nil {
+			reasons = dbpkg.RiskReasons{}
+		}
+		out = append(out, watchMatch{
+			RuleID:         m.WatchRuleID,
+			Rule:           m.WatchRule,
+			ProductID:      m.ProductID,
+			URL:            m.URL,
+			Version:        m.Version,
+			MatchedAt:      m.At,
+			Name:           m.Name,
+			PriceSmallUnit: m.PriceSmallUnit,
+			Currency:       m.Currency,
+			RiskScore:      m.RiskScore,
+			RiskReasons:    reasons,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func newWatchRule(r dbpkg.WatchRule) watchRule {
+	out := watchRule{
+		ID:        r.ID,
+		Name:      r.Name,
+		Keywords:  r.Keywords,
+		Currency:  r.Currency,
+		Category:  r.Category,
+		Location:  r.Location,
+		Condition: r.Condition,
+		CreatedAt: r.CreatedAt,
+	}
+	if r.MinPrice.Valid {
+		out.MinPriceSmallUnit = &r.MinPrice.Int64
+	}
+	if r.MaxPrice.Valid {
+		out.MaxPriceSmallUnit = &r.MaxPrice.Int64
+	}
+	return out
+}
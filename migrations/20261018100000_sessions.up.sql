@@ -0,0 +1,10 @@
+CREATE TABLE sessions (
+    -- sha256 of the token stored in the cookie, so a leaked table can't be
+    -- used to hijack sessions
+    token_hash  BYTEA PRIMARY KEY,
+    user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
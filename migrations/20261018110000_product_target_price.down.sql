@@ -0,0 +1,4 @@
+ALTER TABLE products
+    DROP COLUMN IF EXISTS notes,
+    DROP COLUMN IF EXISTS target_price_currency,
+    DROP COLUMN IF EXISTS target_price_small_unit;
@@ -0,0 +1,7 @@
+-- the price a user waits for and their notes, both set by bulk imports
+ALTER TABLE products
+    ADD COLUMN target_price_small_unit BIGINT,
+    ADD COLUMN target_price_currency TEXT,
+    ADD COLUMN notes TEXT,
+    ADD CONSTRAINT products_target_price_currency
+        CHECK ((target_price_small_unit IS NULL) = (target_price_currency IS NULL));
@@ -0,0 +1,2 @@
+ALTER TABLE products
+    ADD COLUMN deactivated_at TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+ALTER TABLE products
+    ADD COLUMN last_checked_at TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+ALTER TABLE product_versions
+    DROP COLUMN IF EXISTS high_price_small_unit,
+    DROP COLUMN IF EXISTS price_kind;
@@ -0,0 +1,3 @@
+ALTER TABLE product_versions
+    ADD COLUMN price_kind TEXT NOT NULL DEFAULT 'fixed',
+    ADD COLUMN high_price_small_unit BIGINT;
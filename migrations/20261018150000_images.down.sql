@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_product_version_images_image_hash;
+DROP TABLE IF EXISTS product_version_images;
+DROP TABLE IF EXISTS images;
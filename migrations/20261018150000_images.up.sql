@@ -0,0 +1,19 @@
+-- archived images, stored in the blob store under their sha256
+CREATE TABLE images (
+    hash          TEXT PRIMARY KEY,
+    content_type  TEXT NOT NULL,
+    size          BIGINT NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE product_version_images (
+    product_version_id  UUID NOT NULL REFERENCES product_versions(id) ON DELETE CASCADE,
+    -- index of the image in the image list of the snapshot
+    position            INTEGER NOT NULL,
+    source_url          TEXT NOT NULL,
+    image_hash          TEXT NOT NULL REFERENCES images(hash),
+
+    PRIMARY KEY (product_version_id, position)
+);
+
+CREATE INDEX idx_product_version_images_image_hash ON product_version_images(image_hash);
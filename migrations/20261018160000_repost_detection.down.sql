@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS product_fingerprints;
+DROP INDEX IF EXISTS idx_products_reposted_from;
+ALTER TABLE products
+    DROP COLUMN IF EXISTS reposted_from;
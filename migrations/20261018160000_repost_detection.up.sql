@@ -0,0 +1,21 @@
+-- the deactivated product this one is a repost of, so its history continues
+ALTER TABLE products
+    ADD COLUMN reposted_from UUID REFERENCES products(id);
+
+-- an ad is continued by a single repost
+CREATE UNIQUE INDEX idx_products_reposted_from ON products(reposted_from);
+
+-- the fingerprint of the latest snapshot of every product, see internal/repost
+CREATE TABLE product_fingerprints (
+    product_id    UUID PRIMARY KEY REFERENCES products(id) ON DELETE CASCADE,
+    -- perceptual hashes of the images, as signed 64 bit integers
+    image_hashes  BIGINT[] NOT NULL,
+    -- the urls of the hashed images, in the same order, so the hashes are
+    -- reused while the images don't change
+    image_urls    TEXT[] NOT NULL,
+    -- hashes of the word shingles of the title and description
+    shingles      BIGINT[] NOT NULL,
+    seller        TEXT NOT NULL,
+    location      TEXT NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,3 @@
+ALTER TABLE product_versions
+    DROP COLUMN IF EXISTS risk_reasons,
+    DROP COLUMN IF EXISTS risk_score;
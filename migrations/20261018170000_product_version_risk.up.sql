@@ -0,0 +1,5 @@
+-- the risk assessment of the snapshot, see internal/risk, NULL until it is
+-- assessed
+ALTER TABLE product_versions
+    ADD COLUMN risk_score SMALLINT,
+    ADD COLUMN risk_reasons JSONB NOT NULL DEFAULT '[]';
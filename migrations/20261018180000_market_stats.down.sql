@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS market_stats;
+DROP TABLE IF EXISTS market_keywords;
+
+-- the unaccent extension is left installed, other schemas may use it
@@ -0,0 +1,35 @@
+-- the keywords are matched against the names of the ads without diacritics.
+-- Needs a role allowed to create extensions, the superuser in
+-- docker-compose.yaml is
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- keyword queries market stats are materialized for, next to the categories
+-- of the tracked ads
+CREATE TABLE market_keywords (
+    -- normalized: lowercase words without diacritics, separated by a space
+    keyword       TEXT PRIMARY KEY,
+    -- false until the stats of the keyword were computed for the whole
+    -- history of the tracked ads
+    materialized  BOOLEAN NOT NULL DEFAULT false,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- the fixed prices of the ads listed in a category or matching a keyword,
+-- per day, across the ads of all users
+CREATE TABLE market_stats (
+    kind                 TEXT NOT NULL CHECK (kind IN ('category', 'keyword')),
+    -- the category URL or the keyword
+    key                  TEXT NOT NULL,
+    currency             TEXT NOT NULL,
+    day                  DATE NOT NULL,
+    listings             INTEGER NOT NULL,
+    min_small_unit       BIGINT NOT NULL,
+    p10_small_unit       BIGINT NOT NULL,
+    p25_small_unit       BIGINT NOT NULL,
+    median_small_unit    BIGINT NOT NULL,
+    p75_small_unit       BIGINT NOT NULL,
+    p90_small_unit       BIGINT NOT NULL,
+    max_small_unit       BIGINT NOT NULL,
+    computed_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (kind, key, currency, day)
+);
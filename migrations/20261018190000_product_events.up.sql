@@ -0,0 +1,76 @@
+-- the lifecycle of every tracked ad: when it was first seen, its price
+-- changes, when it was last seen online and when it was deactivated
+CREATE TABLE product_events (
+    id                         BIGSERIAL PRIMARY KEY,
+    product_id                 UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    kind                       TEXT NOT NULL CHECK (kind IN ('first_seen', 'price_change', 'last_seen', 'deactivated')),
+    at                         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- the snapshot the event was recorded from, the latest one for the
+    -- last_seen and deactivated events
+    version                    INTEGER,
+    price_small_unit           BIGINT,
+    -- the high end of a range, see product.PriceKind
+    high_price_small_unit      BIGINT,
+    price_kind                 TEXT NOT NULL DEFAULT 'fixed',
+    -- only set for price changes
+    previous_price_small_unit       BIGINT,
+    previous_high_price_small_unit  BIGINT,
+    previous_price_kind             TEXT,
+    currency                   TEXT NOT NULL DEFAULT '',
+    availability               TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_product_events_product_id ON product_events(product_id, at);
+
+-- an ad is born and dies once
+CREATE UNIQUE INDEX idx_product_events_once
+    ON product_events(product_id, kind)
+    WHERE kind IN ('first_seen', 'last_seen', 'deactivated');
+
+-- backfill the events of the ads tracked so far from their snapshots
+INSERT INTO product_events (
+    product_id, kind, at, version,
+    price_small_unit, high_price_small_unit, price_kind,
+    previous_price_small_unit, previous_high_price_small_unit, previous_price_kind,
+    currency, availability
+)
+SELECT product_id,
+    CASE WHEN prev_price IS NULL THEN 'first_seen' ELSE 'price_change' END,
+    retrieved_at, version,
+    price_small_unit, high_price_small_unit, price_kind,
+    prev_price, prev_high_price, prev_price_kind,
+    currency, COALESCE(availability, '')
+FROM (
+    SELECT product_id, version, retrieved_at, price_small_unit, high_price_small_unit, price_kind,
+        currency, availability,
+        LAG(price_small_unit) OVER w AS prev_price,
+        LAG(high_price_small_unit) OVER w AS prev_high_price,
+        LAG(price_kind) OVER w AS prev_price_kind,
+        LAG(currency) OVER w AS prev_currency
+    FROM product_versions
+    WINDOW w AS (PARTITION BY product_id ORDER BY version)
+) versions
+WHERE prev_price IS NULL
+    OR prev_price <> price_small_unit
+    OR prev_high_price IS DISTINCT FROM high_price_small_unit
+    OR prev_price_kind <> price_kind
+    OR prev_currency <> currency;
+
+INSERT INTO product_events (product_id, kind, at, version, price_small_unit, high_price_small_unit, price_kind, currency, availability)
+SELECT p.id, e.kind,
+    CASE e.kind
+        WHEN 'last_seen' THEN COALESCE(p.last_checked_at, latest.retrieved_at, p.deactivated_at)
+        ELSE p.deactivated_at
+    END,
+    latest.version, latest.price_small_unit, latest.high_price_small_unit, COALESCE(latest.price_kind, 'fixed'),
+    COALESCE(latest.currency, ''), COALESCE(latest.availability, '')
+FROM products p
+LEFT JOIN LATERAL (
+    SELECT version, retrieved_at, price_small_unit, high_price_small_unit, price_kind, currency, availability
+    FROM product_versions
+    WHERE product_id = p.id
+    ORDER BY version DESC
+    LIMIT 1
+) latest ON true
+CROSS JOIN (VALUES ('last_seen'), ('deactivated')) AS e(kind)
+WHERE p.deactivated_at IS NOT NULL;
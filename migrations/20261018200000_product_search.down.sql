@@ -0,0 +1,7 @@
+ALTER TABLE product_versions
+    DROP COLUMN IF EXISTS search_vector;
+
+DROP TEXT SEARCH CONFIGURATION IF EXISTS olx_simple;
+DROP TEXT SEARCH CONFIGURATION IF EXISTS olx_romanian;
+
+-- the extension is left installed, other schemas may use it
@@ -0,0 +1,26 @@
+-- needs a role allowed to create extensions, the superuser in
+-- docker-compose.yaml is
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- Romanian stemming for the words of the ads, so "garanția" finds
+-- "garantie", and a simple configuration for model names and other words
+-- the stemmer would mangle. Both drop diacritics, which sellers use
+-- inconsistently.
+CREATE TEXT SEARCH CONFIGURATION olx_romanian (COPY = romanian);
+ALTER TEXT SEARCH CONFIGURATION olx_romanian
+    ALTER MAPPING FOR hword, hword_part, word WITH unaccent, romanian_stem;
+
+CREATE TEXT SEARCH CONFIGURATION olx_simple (COPY = simple);
+ALTER TEXT SEARCH CONFIGURATION olx_simple
+    ALTER MAPPING FOR hword, hword_part, word WITH unaccent, simple;
+
+-- the name weighs more than the description
+ALTER TABLE product_versions
+    ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('olx_romanian', name), 'A') ||
+        setweight(to_tsvector('olx_simple', name), 'A') ||
+        setweight(to_tsvector('olx_romanian', COALESCE(description, '')), 'B') ||
+        setweight(to_tsvector('olx_simple', COALESCE(description, '')), 'B')
+    ) STORED;
+
+CREATE INDEX idx_product_versions_search_vector ON product_versions USING GIN (search_vector);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS watch_matches;
+DROP TABLE IF EXISTS watch_rules;
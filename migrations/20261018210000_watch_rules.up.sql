@@ -0,0 +1,34 @@
+-- saved searches a user is notified about when a newly fetched ad matches
+-- them, see internal/watch
+CREATE TABLE watch_rules (
+    id                    UUID PRIMARY KEY,
+    user_id               UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name                  TEXT NOT NULL,
+    -- words and quoted phrases, a leading "-" excludes them
+    keywords              TEXT NOT NULL DEFAULT '',
+    min_price_small_unit  BIGINT,
+    max_price_small_unit  BIGINT,
+    -- required with a price bound
+    currency              TEXT NOT NULL DEFAULT '',
+    -- a category URL, its subcategories match too
+    category              TEXT NOT NULL DEFAULT '',
+    location              TEXT NOT NULL DEFAULT '',
+    -- new, used, refurbished or damaged
+    item_condition        TEXT NOT NULL DEFAULT '',
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    UNIQUE (user_id, name)
+);
+
+-- an ad is only notified about once per rule, at the snapshot that first
+-- matched
+CREATE TABLE watch_matches (
+    rule_id     UUID NOT NULL REFERENCES watch_rules(id) ON DELETE CASCADE,
+    product_id  UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    version     INTEGER NOT NULL,
+    matched_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (rule_id, product_id)
+);
+
+CREATE INDEX idx_watch_matches_product_id ON watch_matches(product_id);
@@ -0,0 +1,15 @@
+-- reference exchange rates as published by a central bank, see
+-- internal/exchange. Rates aren't published on weekends and holidays, the
+-- latest rate on or before a day applies to it.
+CREATE TABLE exchange_rates (
+    currency     TEXT NOT NULL,
+    quote        TEXT NOT NULL,
+    day          DATE NOT NULL,
+    -- the price of one unit of currency in quote
+    rate         NUMERIC NOT NULL CHECK (rate > 0),
+    -- ecb or bnr
+    source       TEXT NOT NULL,
+    imported_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (currency, quote, day)
+);
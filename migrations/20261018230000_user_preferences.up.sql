@@ -0,0 +1,20 @@
+-- preferences of a user, see internal/preferences. Users without a row use
+-- the defaults, which are the empty values.
+CREATE TABLE user_preferences (
+    user_id                UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    -- the currency prices are also shown in, empty to show them as listed
+    currency               TEXT NOT NULL DEFAULT '',
+    -- an IANA time zone, empty for the time zone of the server
+    timezone               TEXT NOT NULL DEFAULT '',
+    -- en or ro, empty for plain decimals
+    locale                 TEXT NOT NULL DEFAULT '',
+    -- how often the ads of the user are polled, null for every poll cycle
+    poll_interval_seconds  INTEGER CHECK (poll_interval_seconds >= 60),
+    -- minutes after midnight in the time zone of the user, notifications
+    -- are held back from start until end, which may be on the next day
+    quiet_start_minute     SMALLINT CHECK (quiet_start_minute BETWEEN 0 AND 1439),
+    quiet_end_minute       SMALLINT CHECK (quiet_end_minute BETWEEN 0 AND 1439),
+    updated_at             TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    CHECK ((quiet_start_minute IS NULL) = (quiet_end_minute IS NULL))
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS digests;
+
+ALTER TABLE user_preferences
+    DROP COLUMN IF EXISTS digest,
+    DROP COLUMN IF EXISTS email;
@@ -0,0 +1,24 @@
+-- digests are opt-in, sent to the address of the user
+ALTER TABLE user_preferences
+    ADD COLUMN email   TEXT NOT NULL DEFAULT '',
+    -- daily or weekly, empty for no digest
+    ADD COLUMN digest  TEXT NOT NULL DEFAULT '' CHECK (digest IN ('', 'daily', 'weekly')),
+    ADD CHECK (digest = '' OR email <> '');
+
+-- one row per digest period of a user, claimed before the digest is sent so
+-- it is sent at most once, see internal/digest
+CREATE TABLE digests (
+    user_id       UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    frequency     TEXT NOT NULL CHECK (frequency IN ('daily', 'weekly')),
+    period_start  TIMESTAMPTZ NOT NULL,
+    period_end    TIMESTAMPTZ NOT NULL,
+    -- sending until it is sent, failed or skipped for lack of changes; only
+    -- failed digests are tried again
+    status        TEXT NOT NULL CHECK (status IN ('sending', 'sent', 'failed', 'skipped')),
+    attempts      INTEGER NOT NULL DEFAULT 1,
+    error         TEXT NOT NULL DEFAULT '',
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (user_id, frequency, period_start),
+    CHECK (period_start < period_end)
+);
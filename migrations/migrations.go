@@ -0,0 +1,58 @@
+// Package migrations embeds the schema migrations, so the application can
+// tell which version the database is expected to be at.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed *.up.sql
+var files embed.FS
+
+// Latest returns the version of the newest migration, which is the version
+// golang-migrate records in schema_migrations once all of them are applied.
+func Latest() (uint64, error) {
+	names, err := fs.Glob(files, "*.up.sql")
+	if err != nil {
+		return 0, err
+	}
+
+	var latest uint64
+	for _, name := range names {
+		version, err := parseVersion(name)
+		if err != nil {
+			return 0, err
+		}
+		latest = max(latest, version)
+	}
+	if latest == 0 {
+		return 0, fmt.Errorf("no migrations found")
+	}
+	return latest, nil
+}
+
+// versionLayout is the timestamp `just new-migration` prefixes migrations
+// with.
+const versionLayout = "20060102150405"
+
+// parseVersion returns the version of a migration file. Versions have to be
+// valid timestamps, which catches hand-picked ones such as 20261018240000.
+func parseVersion(name string) (uint64, error) {
+	prefix, _, ok := strings.Cut(name, "_")
+	if !ok {
+		return 0, fmt.Errorf("invalid migration name %s", name)
+	}
+	if _, err := time.Parse(versionLayout, prefix); err != nil {
+		return 0, fmt.Errorf("invalid migration name %s: version is not a timestamp: %w", name, err)
+	}
+	version, err := strconv.ParseUint(prefix, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid migration name %s: %w", name, err)
+	}
+	return version, nil
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLatest(t *testing.T) {
+	latest, err := Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest < 20260131161913 {
+		t.Errorf("got latest version %d, want at least the init migration", latest)
+	}
+}
+
+func TestEveryUpHasDown(t *testing.T) {
+	ups, err := fs.Glob(files, "*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, up := range ups {
+		down := strings.TrimSuffix(up, ".up.sql") + ".down.sql"
+		// down migrations aren't embedded, so check next to the source
+		if _, err := os.Stat(down); err != nil {
+			t.Errorf("%s has no down migration", up)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	version, err := parseVersion("20261018235900_digests.up.sql")
+	if err != nil || version != 20261018235900 {
+		t.Errorf("got %d, %v, want 20261018235900", version, err)
+	}
+
+	for _, name := range []string{
+		"digests.up.sql",
+		"20261018240000_digests.up.sql",
+		"2026101823_digests.up.sql",
+		"1_digests.up.sql",
+	} {
+		if _, err := parseVersion(name); err == nil {
+			t.Errorf("parseVersion(%q) should fail", name)
+		}
+	}
+}